@@ -1,6 +1,6 @@
 // Агент (HTTP-клиент) для сбора рантайм-метрик и их последующей отправки на сервер по протоколу HTTP.
 //
-// Агент собирает метрики двух типов: gauge и counter.
+// Агент собирает метрики трех типов: gauge, counter и histogram.
 // В качестве источника метрик использованы пакеты runtime и gopsutil.
 //
 // Приложение обновляет метрики из пакета runtime с заданной во флаге -p или в переменной окружения  POLL_INTERVAL в частотой.
@@ -8,6 +8,12 @@
 // Агент получает адрес эндпоинта HTTP-сервера из флага -a или переменной окружения ADDRESS.
 // Флаг -k и переменная окружения KEY содержат в себе секретный ключ для хэширования данных.
 // Количество одновременно исходящих запросов на сервер задается через флаг -l и переменную окружения RATE_LIMIT.
+// Распределение пауз сборщика мусора отправляется как histogram GCPauseNs, границы корзин в наносекундах
+// задаются через флаг -gc-buckets и переменную окружения GC_PAUSE_BUCKETS.
+// Адрес сервера может быть задан со схемой, например https://localhost:8080. Сертификаты CA для проверки сервера
+// задаются через флаг -tls-ca и переменную окружения TLS_CA, сертификат и ключ агента для mTLS - через флаги
+// -tls-cert и -tls-key (переменные окружения TLS_CERT и TLS_KEY). Если задан хотя бы один из них,
+// адрес без схемы считается адресом HTTPS.
 package main
 
 import (
@@ -34,7 +40,10 @@ func main() {
 		panic(err)
 	}
 
-	agent := agent.New(cfg)
+	agent, err := agent.New(cfg)
+	if err != nil {
+		panic(err)
+	}
 
 	go agent.CollectRuntimeMetricsAtInterval()
 	go agent.CollectAdditionalMetricsAtInterval()
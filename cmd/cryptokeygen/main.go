@@ -25,8 +25,9 @@ func main() {
 			Organization: []string{"metrics"},
 			Country:      []string{"RU"},
 		},
-		// разрешение на использование сертификата для 127.0.0.1 и ::1
+		// разрешение на использование сертификата для 127.0.0.1, ::1 и localhost (адрес сервера по умолчанию)
 		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:    []string{"localhost"},
 		// сертификат верен, начиная со времени создания
 		NotBefore: time.Now(),
 		// время жизни сертификата — 10 лет
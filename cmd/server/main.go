@@ -10,37 +10,201 @@
 //	Флаг -r, переменная окружения RESTORE определяют загружать или нет ранее сохранённые значения из указанного файла при старте сервера.
 //	Флаг -k и переменная окружения KEY содержат в себе секретный ключ для хэширования данных.
 //	Флаг -d и переменная окружения DATABASE_DSN содержат адресом подключения к БД.
+//	Флаг -g и переменная окружения GRPC_ADDRESS содержат адрес gRPC-сервера. Если адрес не указан, gRPC-сервер не запускается.
+//	Флаг -statsd-address и переменная окружения STATSD_ADDRESS содержат адрес UDP-порта для приема метрик в формате StatsD.
+//	Флаг -history-size и переменная окружения HISTORY_SIZE задают количество точек истории каждой метрики при хранении в памяти.
+//	При хранении в БД история сохраняется в таблицу metrics_history.
+//	Флаг -retention-interval и переменная окружения RETENTION_INTERVAL задают интервал в секундах, с которым применяются
+//	политики хранения истории. Политики задаются в JSON-конфигурации в ключе retention, например:
+//
+//		"retention": [{"pattern": "CPU*", "raw": "1h", "minute": "24h", "hour": "720h"}]
+//
+//	Исходные точки старше raw сворачиваются в минутные агрегаты (min/max/avg/last), минутные агрегаты старше minute -
+//	в часовые, часовые агрегаты старше hour удаляются. Агрегаты хранятся в таблице metrics_rollup или в памяти.
+//
+// # Оповещения
+//
+//	Правила оповещений задаются в JSON-конфигурации в ключе alerts, например:
+//
+//		"alerts": {
+//			"rules": [
+//				{"name": "HighHeap", "expr": "HeapAlloc > 500MB for 2m"},
+//				{"name": "AgentStopped", "expr": "rate(PollCount) == 0 for 1m"}
+//			],
+//			"webhooks": ["http://alertmanager.local/hook"],
+//			"interval": "15s"
+//		}
+//
+//	Правила проверяются после каждого обновления метрик и по таймеру с интервалом interval (флаг -alert-interval,
+//	переменная окружения ALERT_INTERVAL). О срабатывании (firing) и завершении (resolved) алерта отправляется
+//	POST-запрос с описанием алерта в формате JSON на каждый адрес из webhooks.
 //
 // # Эндпоинты
 //
-//	GET / - вывод всех метрик в
+//	GET / - HTML-страница со всеми метриками: поиск, сортировка, группировка по префиксу, автообновление и графики истории
 //	GET /value/{metricType}/{metricName} - возврат текущего значения метрики в текстовом виде
 //	GET /ping - при запросе проверяет соединение с базой данных
+//	GET /metrics - вывод всех метрик в текстовом формате Prometheus
 //	POST /value/ - возврат текущего значения метрики в формате JSON
 //	POST /update/{metricType}/{metricName}/{metricValue} - получение метрики с использованием Content-Type: text/plain
 //	POST /update/ - получение метрики с использованием Content-Type: application/json
-//	POST /updates/ - получение множества метрики с использованием Content-Type: application/json
+//	POST /updates/?mode=atomic|best-effort - получение множества метрики с использованием Content-Type: application/json,
+//		в ответе - статус и ошибка для каждой метрики; в режиме best-effort сохраняются только корректные метрики
+//	POST /write - получение метрик в формате InfluxDB line protocol
+//	GET /api/v1/metrics?type=&prefix=&glob=&regex=&sort=&limit=&offset= - список метрик в формате JSON
+//	GET /api/v1/range?id=&type=&from=&to=&step=&resolution= - история значений gauge или counter за интервал в формате JSON
+//	GET /api/v1/alerts - активные алерты в формате JSON
+//	GET /api/v1/export?format=csv|ndjson - выгрузка всех метрик
+//	POST /api/v1/import?format=csv|ndjson&mode=merge|replace - загрузка метрик в одной транзакции;
+//		режим replace требует токен администратора и непустой набор метрик
+//	GET /api/v1/stream?type=&prefix=&glob=&regex=&label= - поток обновлений метрик в формате Server-Sent Events
+//	GET /api/v1/stream/ws?type=&prefix=&glob=&regex=&label= - поток обновлений метрик через WebSocket
+//
+// # Администрирование
+//
+//	Эндпоинты /admin/ доступны, если задан токен администратора (флаг -admin-token, переменная окружения ADMIN_TOKEN
+//	или ключ admin_token в JSON-конфигурации). Токен передается в заголовке Authorization: Bearer <token>.
+//
+//	DELETE /admin/metrics/{metricType}/{metricName} - удаление метрики вместе с историей
+//	DELETE /admin/metrics?pattern=&type= - удаление всех метрик, имена которых соответствуют шаблону glob
+//	POST /admin/metrics/counter/{metricName}/reset - обнуление counter
+//	POST /admin/metrics/{metricType}/{metricName}/rename?to= - переименование метрики
+//	POST /admin/snapshot?name= - снимок всех метрик в каталоге снимков (флаг -snapshot-dir, переменная окружения SNAPSHOT_DIR)
+//	GET /admin/snapshots - список снимков
+//	POST /admin/restore?name= - восстановление метрик из снимка без остановки сервера
+//	DELETE /admin/snapshots/{name} - удаление снимка
+//	DELETE /admin/snapshots?keep=&older_than= - удаление всех снимков, кроме keep самых новых, и снимков старше older_than
+//	POST /admin/keys/reload - перезагрузка приватных ключей с диска (то же делает сигнал SIGHUP)
+//
+//	Метки метрики передаются параметрами label=name=value. После изменений файл метрик перезаписывается,
+//	поэтому при перезапуске с флагом -r удаленные метрики не восстанавливаются.
+//
+// # Идемпотентность
+//
+//	Запросы на обновление метрик (POST /update/..., /updates/, /write, /api/v1/import) могут содержать
+//	заголовок Idempotency-Key. Повторный запрос с тем же ключом не применяется повторно: возвращается ответ
+//	на первый запрос. Ключи хранятся в памяти или в таблице idempotency_keys в течение времени, заданного
+//	флагом -idempotency-ttl или переменной окружения IDEMPOTENCY_TTL (по умолчанию 1h). Пока первый запрос
+//	обрабатывается, повторный получает 409; если ответ не был сохранен (например, сервер остановился),
+//	ключ освобождается через минуту.
+//
+// # Проверка данных
+//
+//	Имя метрики должно быть не длиннее 50 символов и состоять из латинских букв, цифр и символов '_', '.', ':', '-'.
+//	Для gauge обязательно конечное значение value, для counter - delta. Тело запроса на обновление метрик
+//	ограничено 10 МБ после распаковки (POST /api/v1/import - 128 МБ), сверх ограничения возвращается 413.
+//	Ошибки в данных запроса возвращаются с кодом 400 в формате JSON: {"error": "описание ошибки"}
+//	(кроме POST /write, где используется формат ошибок InfluxDB).
+//
+// # Ограничение запросов
+//
+//	Для запросов на обновление метрик действуют ограничения для каждого клиента: количество запросов в секунду
+//	(флаг -rate-limit-rps, переменная окружения RATE_LIMIT_RPS) и количество метрик в минуту (флаг -rate-limit-metrics,
+//	переменная окружения RATE_LIMIT_METRICS). Клиент определяется по токену Authorization или заголовку X-Agent-ID,
+//	если подпись запроса проверена, иначе - по IP-адресу. Сверх ограничения возвращается 429 с заголовком Retry-After,
+//	агент повторяет запрос после указанного времени. Отказы учитываются в метрике RateLimitRejected{limit="requests"|"metrics"}.
+//	По умолчанию ограничения отключены.
+//
+// # Доверенная подсеть
+//
+//	Если задана подсеть в формате CIDR (флаг -t, переменная окружения TRUSTED_SUBNET, ключ trusted_subnet в JSON),
+//	то запросы на обновление метрик принимаются, только если адрес в заголовке X-Real-IP входит в эту подсеть.
+//	Остальные запросы отклоняются с кодом 403. Агент передает в X-Real-IP адрес своего сетевого интерфейса.
+//
+// # Подпись запросов
+//
+//	Если задан ключ (флаг -k), запросы на обновление метрик и POST /value/ должны быть подписаны по схеме версии 2:
+//	в заголовке HashSHA256 передается HMAC-SHA256 от строки "метод\nпуть с параметрами\nвремя\nnonce\nsha256(тело)",
+//	время подписи (Unix-секунды) - в заголовке X-Signature-Timestamp, случайная строка - в заголовке X-Signature-Nonce.
+//	Запрос отклоняется с кодом 400, если время подписи отличается от времени сервера больше чем на -signature-skew
+//	(переменная окружения SIGNATURE_SKEW, по умолчанию 5m) или nonce уже использовался.
+//	Подпись только тела (версия 1) принимается, если задан флаг -legacy-signature (переменная окружения LEGACY_SIGNATURE).
+//	Ответы сервера подписываются в заголовке HashSHA256 от тела ответа, кроме потоковых GET /api/v1/export и GET /api/v1/stream.
+//
+// # Шифрование
+//
+//	Если задан приватный ключ (флаг -crypto-key), тело запроса может быть зашифровано. Заголовок Content-Encrypted: envelope
+//	означает конверт: версия формата (1 байт), ключ AES-256, зашифрованный RSA-OAEP, и тело, зашифрованное AES-256-GCM.
+//	Размер такого тела не ограничен длиной ключа RSA, агент отправляет данные в этом формате.
+//	Для совместимости принимается и Content-Encrypted: true - тело, целиком зашифрованное RSA-OAEP.
+//
+//	Флаг -crypto-key (переменная окружения CRYPTO_KEY) может содержать несколько путей через запятую, путь к каталогу
+//	означает все файлы *.pem с приватными ключами в нем. Идентификатор ключа - SHA-256 от публичного ключа (PKIX, DER)
+//	в шестнадцатеричном виде. Агент передает идентификатор в заголовке X-Key-ID, без заголовка пробуются все ключи.
+//	Ключи перечитываются с диска по сигналу SIGHUP или запросом POST /admin/keys/reload, поэтому для замены ключа
+//	достаточно добавить новый ключ, перевести агентов на новый сертификат и затем удалить старый ключ.
+//
+// # HTTPS
+//
+//	Если заданы сертификат и ключ сервера (флаги -tls-cert и -tls-key, переменные окружения TLS_CERT и TLS_KEY,
+//	ключи tls_cert и tls_key в JSON), сервер принимает запросы по HTTPS, gRPC-сервер использует те же сертификаты.
+//	Сертификат и ключ можно получить с помощью cmd/cryptokeygen. Если задан файл сертификатов CA (флаг -tls-client-ca,
+//	переменная окружения TLS_CLIENT_CA, ключ tls_client_ca в JSON), клиент обязан предъявить сертификат,
+//	подписанный одним из них (mTLS). В отличие от шифрования тела, TLS защищает также заголовки и адрес запроса.
+//
+// # Метки
+//
+//	Серия метрики определяется именем и набором меток (поле labels в JSON, теги в line protocol).
+//	В эндпоинтах GET /, GET /metrics, GET /value/... и POST /update/{metricType}/... метки передаются
+//	параметрами запроса label=name=value (параметр можно указывать несколько раз).
+//	Для GET / и GET /metrics выводятся серии, содержащие все указанные метки.
+//
+// # gRPC
+//
+//	Сервис metrics.Metrics (internal/proto/metrics.proto) предоставляет те же операции:
+//	UpdateMetric, UpdateMetricsBatch, GetMetric, ListMetrics, а также клиентский поток UpdateMetrics.
+//	Если задан ключ (флаг -k), вызовы подписываются по схеме версии 2, как HTTP-запросы: HMAC-SHA256 от строки
+//	"POST\nполное имя метода\nвремя\nnonce\nsha256(сообщение)" (см. grpcserver.CalculateMessageHash) передается
+//	в поле hash или в метаданных HashSHA256, время подписи и nonce - в метаданных X-Signature-Timestamp и X-Signature-Nonce.
+//	В потоке UpdateMetrics время и nonce передаются в метаданных потока, а каждое сообщение подписывается отдельно
+//	в поле hash с nonce "nonce:номер сообщения" (см. grpcserver.StreamMessageNonce), подпись из метаданных
+//	для сообщений потока не принимается. Подпись версии 1 и вызовы без подписи принимаются, только если задан
+//	флаг -legacy-signature. Признак шифрования передается в метаданных Content-Encrypted (envelope или true),
+//	идентификатор ключа - в метаданных X-Key-ID.
+//	Если задана доверенная подсеть, UpdateMetric, UpdateMetricsBatch и UpdateMetrics принимаются, только если
+//	адрес в метаданных X-Real-IP входит в нее, иначе возвращается код PermissionDenied.
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
 
+	"metrics/internal/adminauth"
+	"metrics/internal/alerting"
+	"metrics/internal/authsign"
 	"metrics/internal/config"
 	"metrics/internal/controller"
+	"metrics/internal/cryptoutil"
 	"metrics/internal/decryptmiddleware"
+	"metrics/internal/exchange"
 	"metrics/internal/filetransfer"
+	"metrics/internal/grpcserver"
 	"metrics/internal/handlers"
+	"metrics/internal/idempotency"
 	"metrics/internal/logger"
 	"metrics/internal/middleware"
+	"metrics/internal/ratelimit"
+	"metrics/internal/statsd"
 	"metrics/internal/storage"
+	"metrics/internal/tlsutil"
+	"metrics/internal/trustedsubnet"
+	"metrics/internal/validation"
 	"metrics/internal/worker"
 
 	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 // глобальные переменные с информацией о версии
@@ -97,28 +261,151 @@ func main() {
 		worker.TriggerGoFunc(ticker, task)
 	}
 
-	dmw := decryptmiddleware.NewDecrypteMW(config, log)
+	if config.IsRetentionEnabled() {
+		ticker := time.NewTicker(config.GetRetentionInterval())
+		defer ticker.Stop()
+		worker.TickGoFunc(ticker, func() {
+			controller.ApplyRetention(context.Background(), config.Server.Retention)
+		})
+	}
+
+	if config.IsAlertingEnabled() {
+		notifier := alerting.NewNotifier(config.Server.AlertWebhooks, log)
+		engine := alerting.NewEngine(config.Server.AlertRules, controller, notifier, log)
+		controller.SetAlerting(engine)
+		go engine.Run(context.Background(), config.Server.AlertInterval)
+	}
+
+	var keys *cryptoutil.KeyRing
+	if config.IsDecryptEnabled() {
+		keys, err = cryptoutil.NewKeyRing(config.GetPrivateKeyPaths()...)
+		if err != nil {
+			panic(err)
+		}
+		log.Info("приватные ключи загружены", zap.Strings("keys", keys.IDs()))
+		server.SetKeyRing(keys)
+
+		// По сигналу SIGHUP ключи перечитываются с диска, это позволяет заменять ключи без перезапуска сервера.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := keys.Reload(); err != nil {
+					log.Error("ошибка при перезагрузке приватных ключей: " + err.Error())
+					continue
+				}
+				log.Info("приватные ключи перезагружены", zap.Strings("keys", keys.IDs()))
+			}
+		}()
+	}
+
+	var tlsConfig *tls.Config
+	if config.IsTLSEnabled() {
+		tlsConfig, err = tlsutil.ServerConfig(config.Server.TLSCertPath, config.Server.TLSKeyPath, config.Server.TLSClientCAPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	dmw := decryptmiddleware.NewDecrypteMW(config, keys, log)
+	sign := authsign.NewSignMW(config, log)
+	verify := authsign.NewVerifyMW(config, log)
+	idem := idempotency.NewIdempotencyMW(controller, config.Server.IdempotencyTTL, log)
+	rl := ratelimit.NewRateLimitMW(config, controller, log)
+	trusted := trustedsubnet.NewTrustedSubnetMW(config, log)
+	admin := adminauth.NewAdminAuthMW(config, log)
+
+	{
+		ticker := time.NewTicker(config.Server.IdempotencyTTL)
+		defer ticker.Stop()
+		worker.TickGoFunc(ticker, func() {
+			controller.ExpireIdempotencyKeys(context.Background(), time.Now().Add(-config.Server.IdempotencyTTL))
+		})
+	}
 
 	router := chi.NewRouter()
 	router.Use()
 
-	router.Get("/", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleGetAllMetrics))))
+	router.Get("/", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandleGetAllMetrics)))))
 
-	router.Get("/value/{metricType}/{metricName}", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleGetOneMetric))))
-	router.Post("/value/", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleGetOneMetricViaJSON))))
+	router.Get("/value/{metricType}/{metricName}", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandleGetOneMetric)))))
+	router.Post("/value/", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(validation.LimitBody(validation.MaxBodySize, dmw.Decrypte(verify.Verify(server.HandleGetOneMetricViaJSON)))))))
 
-	router.Post("/update/{metricType}/{metricName}/{metricValue}", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleMetricUpdate))))
-	router.Post("/update/", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleMetricUpdateViaJSON))))
-	router.Post("/updates/", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleMetricUpdates))))
+	router.Post("/update/{metricType}/{metricName}/{metricValue}", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(trusted.Check(validation.LimitBody(validation.MaxBodySize, dmw.Decrypte(verify.Verify(idem.Deduplicate(rl.Limit(server.HandleMetricUpdate))))))))))
+	router.Post("/update/", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(trusted.Check(validation.LimitBody(validation.MaxBodySize, dmw.Decrypte(verify.Verify(idem.Deduplicate(rl.Limit(server.HandleMetricUpdateViaJSON))))))))))
+	router.Post("/updates/", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(trusted.Check(validation.LimitBody(validation.MaxBodySize, dmw.Decrypte(verify.Verify(idem.Deduplicate(rl.Limit(server.HandleMetricUpdates))))))))))
+	router.Post("/write", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(trusted.Check(validation.LimitBody(validation.MaxBodySize, dmw.Decrypte(verify.Verify(idem.Deduplicate(rl.Limit(server.HandleInfluxWrite))))))))))
 
-	router.Get("/ping", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandlePing))))
+	router.Get("/ping", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandlePing)))))
+	router.Get("/metrics", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandlePrometheusMetrics)))))
+	router.Get("/api/v1/metrics", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandleListMetrics)))))
+	router.Get("/api/v1/range", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandleRange)))))
+	router.Get("/api/v1/alerts", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(dmw.Decrypte(server.HandleAlerts)))))
+	// выгрузка передается потоком, поэтому ответ не подписывается: Sign буферизует ответ целиком
+	router.Get("/api/v1/export", logger.WithLogging(middleware.GzipMiddleware(dmw.Decrypte(server.HandleExport))))
+	router.Post("/api/v1/import", logger.WithLogging(middleware.GzipMiddleware(sign.Sign(trusted.Check(validation.LimitBody(validation.MaxImportSize, dmw.Decrypte(verify.Verify(admin.AuthorizeIf(isReplaceImport, idem.Deduplicate(rl.Limit(server.HandleImport)))))))))))
+	// потоковые эндпоинты не сжимаются: события должны отправляться клиенту сразу
+	router.Get("/api/v1/stream", logger.WithLogging(server.HandleStream))
+	router.Get("/api/v1/stream/ws", logger.WithLogging(server.HandleStreamWebSocket))
+
+	router.Delete("/admin/metrics", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleDeleteMetrics))))
+	router.Delete("/admin/metrics/{metricType}/{metricName}", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleDeleteMetric))))
+	router.Post("/admin/metrics/counter/{metricName}/reset", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleResetCounter))))
+	router.Post("/admin/metrics/{metricType}/{metricName}/rename", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleRenameMetric))))
+	router.Post("/admin/snapshot", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleCreateSnapshot))))
+	router.Get("/admin/snapshots", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleListSnapshots))))
+	router.Delete("/admin/snapshots", logger.WithLogging(sign.Sign(admin.Authorize(server.HandlePruneSnapshots))))
+	router.Delete("/admin/snapshots/{name}", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleDeleteSnapshot))))
+	router.Post("/admin/restore", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleRestoreSnapshot))))
+	router.Post("/admin/keys/reload", logger.WithLogging(sign.Sign(admin.Authorize(server.HandleReloadKeys))))
+
+	if config.IsGRPCEnabled() {
+		listen, err := net.Listen("tcp", config.Server.GRPCAddress)
+		if err != nil {
+			panic(err)
+		}
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer := grpcserver.NewGRPCServer(config, keys, writer, log, controller, opts...)
+
+		go func() {
+			log.Info("gRPC server listening on " + config.Server.GRPCAddress)
+			if err := grpcServer.Serve(listen); err != nil {
+				panic(err)
+			}
+		}()
+	}
+
+	if config.IsStatsDEnabled() {
+		listener := statsd.NewListener(config, writer, log, controller)
+		defer listener.Close()
+
+		go func() {
+			log.Info("StatsD listening on " + config.Server.StatsDAddress)
+			if err := listener.ListenAndServe(); err != nil {
+				panic(err)
+			}
+		}()
+	}
 
 	go func() {
 		log.Info("pprof listening on :6060")
 		http.ListenAndServe("localhost:6060", nil) // <- pprof listening on :6060
 	}()
 
-	err = http.ListenAndServe(config.Server.ServerAddress, router)
+	httpServer := &http.Server{
+		Addr:      config.Server.ServerAddress,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+	if tlsConfig != nil {
+		log.Info("HTTPS server listening on " + config.Server.ServerAddress)
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -129,3 +416,8 @@ func printVersionInfo() {
 	fmt.Printf("Build date: %s\n", BuildDate)
 	fmt.Printf("Build commit: %s\n", BuildCommit)
 }
+
+// isReplaceImport сообщает, что запрос к POST /api/v1/import заменяет все метрики хранилища.
+func isReplaceImport(req *http.Request) bool {
+	return req.URL.Query().Get("mode") == exchange.ModeReplace
+}
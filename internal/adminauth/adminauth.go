@@ -0,0 +1,58 @@
+// В пакете adminauth реализована проверка доступа к эндпоинтам администрирования.
+// Клиент передает токен из настроек сервера в заголовке Authorization: Bearer <token>.
+package adminauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"metrics/internal/config"
+
+	"go.uber.org/zap"
+)
+
+type AdminAuth struct {
+	config *config.Config
+	logger *zap.Logger
+}
+
+func NewAdminAuthMW(cfg *config.Config, logger *zap.Logger) *AdminAuth {
+	return &AdminAuth{
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Authorize пропускает запрос к h, только если передан верный токен администратора.
+// Если токен в настройках сервера не задан, эндпоинты администрирования недоступны.
+func (a *AdminAuth) Authorize(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.config.IsAdminEnabled() {
+			http.Error(w, "администрирование отключено", http.StatusForbidden)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminToken)) != 1 {
+			a.logger.Warn("неверный токен администратора", zap.String("remote", r.RemoteAddr), zap.String("path", r.URL.Path))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "неверный токен администратора", http.StatusUnauthorized)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// AuthorizeIf требует токен администратора, только если match(r) возвращает true; остальные запросы передаются h без проверки.
+func (a *AdminAuth) AuthorizeIf(match func(r *http.Request) bool, h http.HandlerFunc) http.HandlerFunc {
+	authorized := a.Authorize(h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if match(r) {
+			authorized(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
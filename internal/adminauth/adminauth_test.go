@@ -0,0 +1,60 @@
+package adminauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"metrics/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAdminAuth_Authorize(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "disabled", token: "", header: "Bearer ", want: http.StatusForbidden},
+		{name: "valid", token: "secret", header: "Bearer secret", want: http.StatusOK},
+		{name: "wrong", token: "secret", header: "Bearer other", want: http.StatusUnauthorized},
+		{name: "missing", token: "secret", header: "", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := NewAdminAuthMW(&config.Config{AdminToken: tt.token}, zap.NewNop())
+			req := httptest.NewRequest(http.MethodDelete, "/admin/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mw.Authorize(ok)(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestAdminAuth_AuthorizeIf(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	mw := NewAdminAuthMW(&config.Config{AdminToken: "secret"}, zap.NewNop())
+	h := mw.AuthorizeIf(func(r *http.Request) bool { return r.URL.Query().Get("mode") == "replace" }, ok)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/api/v1/import?mode=merge", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/api/v1/import?mode=replace", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/import?mode=replace", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -1,8 +1,13 @@
 package agent
 
 import (
+	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
+
+	"metrics/internal/tlsutil"
 )
 
 type Agent struct {
@@ -20,22 +25,60 @@ type Agent struct {
 	sendQueue      chan Metrics
 	resultQueue    chan Result
 	publicKeyPath  string
+	gcPauseBuckets []float64
+	lastNumGC      uint32
+	hostname       string
+	baseURL        string
+	client         *http.Client
 }
 
-func New(cfg *Config) *Agent {
+func New(cfg *Config) (*Agent, error) {
+	// Имя хоста добавляется меткой host ко всем отправляемым метрикам.
+	hostname, _ := os.Hostname()
+
+	client := &http.Client{}
+	if cfg.IsTLSEnabled() {
+		tlsConfig, err := tlsutil.ClientConfig(cfg.TLSCAPath, cfg.TLSCertPath, cfg.TLSKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	serverAddress, baseURL := splitServerAddress(cfg.ServerAddress, cfg.IsTLSEnabled())
+
 	return &Agent{
-		ServerAddress:  cfg.ServerAddress,
+		ServerAddress:  serverAddress,
 		ReportInterval: cfg.ReportInterval,
 		PollInterval:   cfg.PollInterval,
 		SecretKey:      cfg.SecretKey,
 		RateLimit:      cfg.RateLimit,
 		retriesCount:   3,
 
-		metrics:       make(map[string]interface{}),
-		pollTicker:    time.NewTicker(time.Duration(cfg.PollInterval) * time.Second),
-		reportTicker:  time.NewTicker(time.Duration(cfg.ReportInterval) * time.Second),
-		sendQueue:     make(chan Metrics, cfg.RateLimit),
-		resultQueue:   make(chan Result, cfg.RateLimit),
-		publicKeyPath: cfg.PublicCryptoKey,
+		metrics:        make(map[string]interface{}),
+		pollTicker:     time.NewTicker(time.Duration(cfg.PollInterval) * time.Second),
+		reportTicker:   time.NewTicker(time.Duration(cfg.ReportInterval) * time.Second),
+		sendQueue:      make(chan Metrics, cfg.RateLimit),
+		resultQueue:    make(chan Result, cfg.RateLimit),
+		publicKeyPath:  cfg.PublicCryptoKey,
+		gcPauseBuckets: cfg.GCPauseBuckets,
+		hostname:       hostname,
+		baseURL:        baseURL,
+		client:         client,
+	}, nil
+}
+
+// splitServerAddress разбирает адрес сервера, который может быть задан со схемой (http:// или https://).
+// Возвращается адрес host:port и базовый URL. Без схемы используется HTTPS, если заданы настройки TLS.
+func splitServerAddress(address string, tlsEnabled bool) (string, string) {
+	for _, scheme := range []string{"http://", "https://"} {
+		if strings.HasPrefix(address, scheme) {
+			hostPort := strings.TrimSuffix(strings.TrimPrefix(address, scheme), "/")
+			return hostPort, scheme + hostPort
+		}
+	}
+	if tlsEnabled {
+		return address, "https://" + address
 	}
+	return address, "http://" + address
 }
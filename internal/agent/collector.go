@@ -6,6 +6,9 @@ import (
 	"math/rand/v2"
 	"runtime"
 
+	"metrics/internal/histogram"
+	"metrics/internal/models"
+
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
 )
@@ -45,6 +48,8 @@ func (agent *Agent) collectRuntimeMetrics() {
 	agent.metrics["Sys"] = memStats.Sys
 	agent.metrics["TotalAlloc"] = memStats.TotalAlloc
 
+	agent.collectGCPauses(memStats)
+
 	pollCount++
 	agent.metrics["PollCount"] = pollCount
 
@@ -55,6 +60,28 @@ func (agent *Agent) collectRuntimeMetrics() {
 	slog.Info(fmt.Sprintf("runtime metrics saved: PollCount = %v", pollCount))
 }
 
+// collectGCPauses добавляет в гистограмму GCPauseNs паузы сборок мусора, завершившихся с момента предыдущего опроса.
+// Гистограмма накапливается до отправки метрик на сервер и создается заново после сброса хранилища метрик.
+func (agent *Agent) collectGCPauses(memStats *runtime.MemStats) {
+	pauses, ok := agent.metrics["GCPauseNs"].(*models.Histogram)
+	if !ok {
+		pauses = histogram.New(agent.gcPauseBuckets)
+		agent.metrics["GCPauseNs"] = pauses
+	}
+
+	// runtime хранит длительности только последних len(PauseNs) пауз
+	size := uint32(len(memStats.PauseNs))
+	first := agent.lastNumGC
+	if memStats.NumGC-first > size {
+		first = memStats.NumGC - size
+	}
+
+	for i := first; i < memStats.NumGC; i++ {
+		histogram.Observe(pauses, float64(memStats.PauseNs[i%size]))
+	}
+	agent.lastNumGC = memStats.NumGC
+}
+
 func (agent *Agent) setPollCountInitial() {
 	pollCount = 0
 }
@@ -81,7 +108,7 @@ func (agent *Agent) collectAdditionalMetrics() {
 	agent.metrics["FreeMemory"] = vm.Free
 
 	for i, percent := range cpuPercent {
-		agent.metrics[fmt.Sprintf("CPUutilization%d", i+1)] = percent
+		agent.metrics[fmt.Sprintf("CPUutilization{cpu=\"%d\"}", i+1)] = percent
 	}
 
 	agent.mutex.Unlock()
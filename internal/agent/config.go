@@ -8,6 +8,7 @@ import (
 	"metrics/internal/models"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -19,12 +20,17 @@ type Config struct {
 	PublicCryptoKey string //`env:"CRYPTO_KEY"`
 	ConfigPath      string //`env:CONFIG`
 	ConfigPathShort string
+	GCPauseBuckets  []float64 //`env:"GC_PAUSE_BUCKETS"`
+	TLSCAPath       string    //`env:"TLS_CA"`
+	TLSCertPath     string    //`env:"TLS_CERT"`
+	TLSKeyPath      string    //`env:"TLS_KEY"`
 }
 
 func ParseFlags() (*Config, error) {
 
 	var err error
 	var cfg Config
+	var gcPauseBuckets string
 
 	flag.StringVar(&cfg.ServerAddress, "a", constants.DefaultServerAddress, "Адрес эндпоинта HTTP-сервера")
 	flag.Int64Var(&cfg.ReportInterval, "r", constants.DefaultReportInterval, "Частота отправки метрик на сервер")
@@ -32,6 +38,10 @@ func ParseFlags() (*Config, error) {
 	flag.StringVar(&cfg.SecretKey, "k", "", "Ключ для подписи передаваемых данных")
 	flag.IntVar(&cfg.RateLimit, "l", 4, "Количество одновременно исходящих запросов на сервер")
 	flag.StringVar(&cfg.PublicCryptoKey, "crypto-key", "", "Путь до файла с публичным ключом") //./key/cert.pem
+	flag.StringVar(&gcPauseBuckets, "gc-buckets", constants.DefaultGCPauseBuckets, "Границы корзин гистограммы пауз GC в наносекундах через запятую")
+	flag.StringVar(&cfg.TLSCAPath, "tls-ca", "", "Путь до файла с сертификатами CA для проверки сертификата сервера")
+	flag.StringVar(&cfg.TLSCertPath, "tls-cert", "", "Путь до файла с сертификатом агента для mTLS")
+	flag.StringVar(&cfg.TLSKeyPath, "tls-key", "", "Путь до файла с приватным ключом сертификата агента")
 	flag.StringVar(&cfg.ConfigPath, "config", "", "конфигурации сервера с помощью файла в формате JSON")
 	flag.StringVar(&cfg.ConfigPath, "c", "", "конфигурации сервера с помощью файла в формате JSON(shorthand)")
 
@@ -102,10 +112,64 @@ func ParseFlags() (*Config, error) {
 		cfg.PublicCryptoKey = agentConfig.CryptoKey
 	}
 
+	if envBuckets := os.Getenv("GC_PAUSE_BUCKETS"); envBuckets != "" {
+		gcPauseBuckets = envBuckets
+	} else if gcPauseBuckets == constants.DefaultGCPauseBuckets && agentConfig.GCPauseBuckets != "" {
+		gcPauseBuckets = agentConfig.GCPauseBuckets
+	}
+
+	if envTLSCA := os.Getenv("TLS_CA"); envTLSCA != "" {
+		cfg.TLSCAPath = envTLSCA
+	} else if cfg.TLSCAPath == "" && agentConfig.TLSCA != "" {
+		cfg.TLSCAPath = agentConfig.TLSCA
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		cfg.TLSCertPath = envTLSCert
+	} else if cfg.TLSCertPath == "" && agentConfig.TLSCert != "" {
+		cfg.TLSCertPath = agentConfig.TLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		cfg.TLSKeyPath = envTLSKey
+	} else if cfg.TLSKeyPath == "" && agentConfig.TLSKey != "" {
+		cfg.TLSKeyPath = agentConfig.TLSKey
+	}
+
+	if (cfg.TLSCertPath == "") != (cfg.TLSKeyPath == "") {
+		return nil, fmt.Errorf("для mTLS нужно задать и сертификат (-tls-cert), и ключ (-tls-key)")
+	}
+
+	cfg.GCPauseBuckets, err = parseBuckets(gcPauseBuckets)
+	if err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 
 }
 
+// IsTLSEnabled сообщает, заданы ли настройки TLS. В этом случае адрес сервера без схемы считается адресом HTTPS.
+func (cfg *Config) IsTLSEnabled() bool {
+	return cfg.TLSCAPath != "" || cfg.TLSCertPath != ""
+}
+
+// parseBuckets разбирает список границ корзин гистограммы, перечисленных через запятую.
+func parseBuckets(value string) ([]float64, error) {
+	var buckets []float64
+	for _, part := range strings.Split(value, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверная граница корзины гистограммы %q: %w", part, err)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("границы корзин гистограммы должны строго возрастать")
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
 func getJSONConfig(path string) (config models.JSONConfigAgent, err error) {
 	if path == "" {
 		return
@@ -3,17 +3,24 @@ package agent
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"metrics/internal/authsign"
 	"metrics/internal/constants"
 	"metrics/internal/cryptoutil"
+	"metrics/internal/idempotency"
+	"metrics/internal/labels"
 	"metrics/internal/models"
+	"metrics/internal/trustedsubnet"
 )
 
 func (agent *Agent) PrepareMetrics(metrics map[string]any) []models.MetricsForSend {
@@ -21,9 +28,21 @@ func (agent *Agent) PrepareMetrics(metrics map[string]any) []models.MetricsForSe
 
 	for key, value := range metrics {
 
-		metric := models.MetricsForSend{ID: key}
+		// Ключ метрики может содержать метки, например CPUutilization{cpu="1"}.
+		name, metricLabels := labels.SplitSeriesKey(key)
+		if agent.hostname != "" {
+			if metricLabels == nil {
+				metricLabels = make(map[string]string)
+			}
+			metricLabels["host"] = agent.hostname
+		}
+
+		metric := models.MetricsForSend{ID: name, Labels: metricLabels}
 
-		if key == constants.PollCount {
+		if h, ok := value.(*models.Histogram); ok {
+			metric.MType = constants.Histogram
+			metric.Histogram = h
+		} else if name == constants.PollCount {
 			metric.MType = constants.Counter
 			switch v := value.(type) {
 			case int64:
@@ -76,14 +95,26 @@ func (agent *Agent) SendMetricsBatch(metrics []models.MetricsForSend) error {
 		return err
 	}
 
+	// Ключ идемпотентности не меняется между попытками, чтобы сервер не применил пакет дважды,
+	// если ответ на предыдущую попытку был потерян.
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return err
+	}
+
 	for i := 0; i <= agent.retriesCount; i++ {
 
-		err = agent.doUpdatesRequest(metrics)
+		err = agent.doUpdatesRequest(metrics, key)
 		if err == nil {
 			break
 		}
 
-		if !isRetriableError(err) {
+		// На 429 сервер сообщает в Retry-After, когда можно повторить запрос.
+		wait := time.Duration(i*2+1) * time.Second
+		var limited *rateLimitedError
+		if errors.As(err, &limited) {
+			wait = limited.retryAfter
+		} else if !isRetriableError(err) {
 			return err
 		}
 
@@ -92,13 +123,19 @@ func (agent *Agent) SendMetricsBatch(metrics []models.MetricsForSend) error {
 			return err
 		}
 
-		time.Sleep(time.Duration(i*2+1) * time.Second)
+		time.Sleep(wait)
 
 	}
 	return nil
 }
 
-func (agent *Agent) doUpdatesRequest(metrics []models.MetricsForSend) error {
+func (agent *Agent) doUpdatesRequest(metrics []models.MetricsForSend, key string) error {
+
+	// Адрес интерфейса, через который отправляются запросы, проверяется сервером по доверенной подсети.
+	realIP, err := outboundIP(agent.ServerAddress)
+	if err != nil {
+		fmt.Println("failed to get outbound address:", err)
+	}
 
 	for i := 0; i < len(metrics); i += 5 {
 		end := i + 5
@@ -111,13 +148,20 @@ func (agent *Agent) doUpdatesRequest(metrics []models.MetricsForSend) error {
 		if err != nil {
 			return fmt.Errorf("failed to marshal data: %w", err)
 		}
-		var hash string
-		if agent.SecretKey != "" {
-			hash = authsign.CalculateHash(jsonData, []byte(agent.SecretKey))
-		}
+		// Подпись вычисляется от тела до шифрования и сжатия.
+		plain := jsonData
 
+		// Сертификат читается при каждой отправке, чтобы замена ключа не требовала перезапуска агента.
+		var keyID string
 		if agent.publicKeyPath != "" {
-			jsonData, err = cryptoutil.EncrypteBody(jsonData, agent.publicKeyPath)
+			publicKey, err := cryptoutil.LoadPublicKey(agent.publicKeyPath)
+			if err != nil {
+				return fmt.Errorf("failed to load public key: %w", err)
+			}
+			if keyID, err = cryptoutil.KeyID(publicKey); err != nil {
+				return fmt.Errorf("failed to load public key: %w", err)
+			}
+			jsonData, err = cryptoutil.SealEnvelope(publicKey, jsonData)
 			if err != nil {
 				return fmt.Errorf("failed toencrypte body: %w", err)
 			}
@@ -135,7 +179,8 @@ func (agent *Agent) doUpdatesRequest(metrics []models.MetricsForSend) error {
 			return fmt.Errorf("failed to close gzip writer: %w", err)
 		}
 
-		url := fmt.Sprintf("http://%s/updates/", agent.ServerAddress)
+		// В режиме best-effort сервер сохраняет корректные метрики пакета, даже если часть метрик отклонена.
+		url := fmt.Sprintf("%s/updates/?mode=%s", agent.baseURL, models.UpdateModeBestEffort)
 
 		request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(buf.Bytes()))
 		if err != nil {
@@ -145,14 +190,24 @@ func (agent *Agent) doUpdatesRequest(metrics []models.MetricsForSend) error {
 
 		request.Header.Set("Content-Encoding", "gzip")
 		request.Header.Set("Accept-Encoding", "")
-		if hash != "" {
-			request.Header.Set(constants.HeaderSig, hash)
+		if agent.SecretKey != "" {
+			if err := authsign.SignRequest(request, plain, []byte(agent.SecretKey)); err != nil {
+				return fmt.Errorf("failed to sign request: %w", err)
+			}
 		}
 		if agent.publicKeyPath != "" {
-			request.Header.Set("Content-Encrypted", "true")
+			request.Header.Set("Content-Encrypted", cryptoutil.ModeEnvelope)
+			request.Header.Set(constants.HeaderKeyID, keyID)
+		}
+		request.Header.Set(idempotency.Header, fmt.Sprintf("%s-%d", key, i/5))
+		if agent.hostname != "" {
+			request.Header.Set(constants.HeaderAgentID, agent.hostname)
+		}
+		if realIP != "" {
+			request.Header.Set(trustedsubnet.HeaderRealIP, realIP)
 		}
 
-		resp, err := http.DefaultClient.Do(request)
+		resp, err := agent.client.Do(request)
 		if err != nil {
 			fmt.Println("Error sending request: %w\n", err)
 			return err
@@ -160,10 +215,84 @@ func (agent *Agent) doUpdatesRequest(metrics []models.MetricsForSend) error {
 
 		defer resp.Body.Close()
 
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		// Код ответа проверяется до подписи: ответы с ошибкой могут прийти от прокси или middleware без подписи.
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &rateLimitedError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+			return fmt.Errorf("server responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		}
+
+		if agent.SecretKey != "" && !authsign.VerifySig(resp.Header.Get(constants.HeaderSig), body, []byte(agent.SecretKey)) {
+			return fmt.Errorf("invalid response signature")
+		}
+
+		logRejected(resp.StatusCode, body)
 	}
 	return nil
 }
 
+// rateLimitedError - сервер отклонил запрос с кодом 429 Too Many Requests.
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("превышено ограничение запросов, повтор через %s", e.retryAfter)
+}
+
+// parseRetryAfter разбирает заголовок Retry-After в секундах или в формате HTTP-даты.
+// Если заголовок не задан или неверен, возвращается одна секунда.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return time.Second
+}
+
+// logRejected выводит метрики пакета, отклоненные сервером.
+func logRejected(statusCode int, body []byte) {
+	if statusCode != http.StatusOK && statusCode != http.StatusBadRequest {
+		return
+	}
+	var response models.UpdatesResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return
+	}
+	for _, result := range response.Results {
+		if result.Status == models.UpdateStatusRejected {
+			fmt.Printf("метрика %s типа %s отклонена сервером: %s\n", result.ID, result.MType, result.Error)
+		}
+	}
+}
+
+// outboundIP возвращает адрес сетевого интерфейса, через который агент обращается к серверу.
+// Соединение UDP не отправляет пакетов, а только выбирает маршрут до адреса сервера.
+func outboundIP(serverAddress string) (string, error) {
+	conn, err := net.Dial("udp", serverAddress)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// newIdempotencyKey возвращает случайный ключ для заголовка Idempotency-Key.
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func isRetriableError(err error) bool {
 	var opErr *net.OpError
 	return errors.As(err, &opErr)
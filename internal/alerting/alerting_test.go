@@ -0,0 +1,146 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics/internal/models"
+	"metrics/internal/storage/inmemory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeSource struct {
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+func (s *fakeSource) GetAllGauge(ctx context.Context) map[string]float64 { return s.gauges }
+func (s *fakeSource) GetAllCounter(ctx context.Context) map[string]int64 { return s.counters }
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("HighHeap", "HeapAlloc > 500MB for 2m")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Name: "HighHeap", Expr: "HeapAlloc > 500MB for 2m", Metric: "HeapAlloc", Op: ">", Threshold: 500 << 20, For: 2 * time.Minute}, rule)
+
+	rule, err = ParseRule("", `rate(PollCount{host="a"}) == 0 for 1m`)
+	require.NoError(t, err)
+	assert.True(t, rule.Rate)
+	assert.Equal(t, map[string]string{"host": "a"}, rule.Labels)
+	assert.Equal(t, `rate(PollCount{host="a"}) == 0 for 1m`, rule.Name)
+
+	for _, expr := range []string{"HeapAlloc", "HeapAlloc > 5XB", "rate(PollCount == 0", "HeapAlloc > 1 for day"} {
+		_, err = ParseRule("", expr)
+		assert.Error(t, err, expr)
+	}
+
+	_, err = ParseRules([]models.AlertRule{{Name: "a", Expr: "A > 1"}, {Name: "a", Expr: "B > 1"}})
+	assert.Error(t, err)
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	rules, err := ParseRules([]models.AlertRule{
+		{Name: "HighHeap", Expr: "HeapAlloc > 500MB for 2m"},
+		{Name: "AgentStopped", Expr: "rate(PollCount) == 0 for 1m"},
+	})
+	require.NoError(t, err)
+
+	source := &fakeSource{
+		gauges:   map[string]float64{`HeapAlloc{host="a"}`: 600 << 20},
+		counters: map[string]int64{"PollCount": 10},
+	}
+	engine := NewEngine(rules, source, nil, zap.NewNop())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	engine.Evaluate(ctx)
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Equal(t, map[string]string{"host": "a"}, alerts[0].Labels)
+
+	now = now.Add(2 * time.Minute)
+	engine.Evaluate(ctx)
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "AgentStopped", alerts[0].Rule)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Equal(t, StateFiring, alerts[1].State)
+
+	now = now.Add(time.Minute)
+	source.gauges[`HeapAlloc{host="a"}`] = 100
+	engine.Evaluate(ctx)
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+
+	now = now.Add(10 * time.Second)
+	source.counters["PollCount"] = 20
+	engine.Evaluate(ctx)
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEngine_EvaluateConcurrentUpdates(t *testing.T) {
+	rules, err := ParseRules([]models.AlertRule{{Name: "HighHeap", Expr: "HeapAlloc > 1"}})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	storage := inmemory.NewMemStorage()
+	engine := NewEngine(rules, storage, nil, zap.NewNop())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			storage.SetGauge(ctx, fmt.Sprintf("HeapAlloc%d", i), float64(i))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		engine.Evaluate(ctx)
+	}
+	wg.Wait()
+}
+
+func TestNotifier_RetryAndDedup(t *testing.T) {
+	var m sync.Mutex
+	var received []Alert
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var alert Alert
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		received = append(received, alert)
+	}))
+	defer ts.Close()
+
+	notifier := NewNotifier([]string{ts.URL}, zap.NewNop())
+	notifier.backoff = func(int) time.Duration { return time.Millisecond }
+	ctx := context.Background()
+
+	alert := Alert{Fingerprint: "f", Rule: "HighHeap", State: StateFiring}
+	notifier.deliver(ctx, ts.URL, alert)
+	notifier.deliver(ctx, ts.URL, alert)
+	alert.State = StateResolved
+	notifier.deliver(ctx, ts.URL, alert)
+
+	require.Len(t, received, 2)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, StateFiring, received[0].State)
+	assert.Equal(t, StateResolved, received[1].State)
+}
@@ -0,0 +1,272 @@
+// В пакете alerting реализована проверка правил оповещений по значениям метрик
+// и отправка оповещений о срабатывании и завершении алертов на webhook-адреса.
+//
+// Правило применяется к каждой серии с указанным именем, метки которой содержат метки правила.
+// Если условие выполняется, алерт серии переходит в состояние pending, а после того как условие
+// выполняется непрерывно в течение for - в состояние firing, и отправляется оповещение.
+// Когда условие перестает выполняться, алерт удаляется, а для алерта в состоянии firing
+// отправляется оповещение о завершении (resolved).
+package alerting
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"metrics/internal/labels"
+
+	"go.uber.org/zap"
+)
+
+// Состояния алерта.
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Окно, за которое вычисляется скорость изменения значения в rate().
+const RateWindow = time.Minute
+
+// Source - источник текущих значений метрик. Правила проверяются одновременно с обновлением метрик,
+// поэтому методы должны возвращать копии значений, а не карты хранилища.
+type Source interface {
+	GetAllGauge(ctx context.Context) map[string]float64
+	GetAllCounter(ctx context.Context) map[string]int64
+}
+
+// Alert - активный алерт серии. Также используется как тело оповещения.
+type Alert struct {
+	Fingerprint string            `json:"fingerprint"` // идентификатор алерта: правило и серия
+	Rule        string            `json:"rule"`
+	Expr        string            `json:"expr"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	State       string            `json:"state"`
+	Value       float64           `json:"value"`
+	ActiveAt    time.Time         `json:"active_at"`
+	FiredAt     *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time        `json:"resolved_at,omitempty"`
+}
+
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+// Engine проверяет правила по таймеру и по сигналу Trigger, который подается при обновлении метрик.
+type Engine struct {
+	rules    []Rule
+	source   Source
+	notifier *Notifier
+	logger   *zap.Logger
+	now      func() time.Time
+	trigger  chan struct{}
+
+	m       sync.Mutex
+	alerts  map[string]*Alert
+	samples map[string][]sample // история значений серий для rate()
+}
+
+func NewEngine(rules []Rule, source Source, notifier *Notifier, logger *zap.Logger) *Engine {
+	return &Engine{
+		rules:    rules,
+		source:   source,
+		notifier: notifier,
+		logger:   logger,
+		now:      time.Now,
+		trigger:  make(chan struct{}, 1),
+		alerts:   make(map[string]*Alert),
+		samples:  make(map[string][]sample),
+	}
+}
+
+// Trigger запрашивает внеочередную проверку правил. Не блокирует вызывающего:
+// несколько сигналов, поданных до начала проверки, объединяются в одну проверку.
+func (e *Engine) Trigger() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run проверяет правила с интервалом interval и по сигналу Trigger до отмены ctx.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	if e.notifier != nil {
+		go e.notifier.Run(ctx)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.trigger:
+		}
+		e.Evaluate(ctx)
+	}
+}
+
+// Evaluate проверяет все правила по текущим значениям метрик.
+func (e *Engine) Evaluate(ctx context.Context) {
+	values := make(map[string]float64)
+	for key, value := range e.source.GetAllCounter(ctx) {
+		values[key] = float64(value)
+	}
+	for key, value := range e.source.GetAllGauge(ctx) {
+		values[key] = value
+	}
+
+	now := e.now()
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.recordSamples(now, values)
+
+	active := make(map[string]bool)
+	for _, rule := range e.rules {
+		for key, value := range values {
+			name, seriesLabels := labels.SplitSeriesKey(key)
+			if name != rule.Metric || !labels.Match(seriesLabels, rule.Labels) {
+				continue
+			}
+
+			if rule.Rate {
+				var ok bool
+				if value, ok = e.rate(key); !ok {
+					continue
+				}
+			}
+			if !rule.Matches(value) {
+				continue
+			}
+
+			fingerprint := fingerprint(rule.Name, key)
+			active[fingerprint] = true
+
+			alert, ok := e.alerts[fingerprint]
+			if !ok {
+				alert = &Alert{
+					Fingerprint: fingerprint,
+					Rule:        rule.Name,
+					Expr:        rule.Expr,
+					Metric:      name,
+					Labels:      seriesLabels,
+					State:       StatePending,
+					ActiveAt:    now,
+				}
+				e.alerts[fingerprint] = alert
+			}
+			alert.Value = value
+
+			if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+				firedAt := now
+				alert.State = StateFiring
+				alert.FiredAt = &firedAt
+				e.logger.Info("алерт сработал", zap.String("rule", rule.Name), zap.String("series", key), zap.Float64("value", value))
+				e.notify(*alert)
+			}
+		}
+	}
+
+	for fingerprint, alert := range e.alerts {
+		if active[fingerprint] {
+			continue
+		}
+		delete(e.alerts, fingerprint)
+		if alert.State == StateFiring {
+			resolvedAt := now
+			alert.State = StateResolved
+			alert.ResolvedAt = &resolvedAt
+			e.logger.Info("алерт завершен", zap.String("rule", alert.Rule), zap.String("series", labels.SeriesKey(alert.Metric, alert.Labels)))
+			e.notify(*alert)
+		}
+	}
+}
+
+// Alerts возвращает активные алерты (pending и firing), упорядоченные по правилу и серии.
+func (e *Engine) Alerts() []Alert {
+	e.m.Lock()
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	e.m.Unlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return labels.SeriesKey(alerts[i].Metric, alerts[i].Labels) < labels.SeriesKey(alerts[j].Metric, alerts[j].Labels)
+	})
+	return alerts
+}
+
+func (e *Engine) notify(alert Alert) {
+	if e.notifier != nil {
+		e.notifier.Notify(alert)
+	}
+}
+
+// recordSamples сохраняет значения серий, используемых в rate(), и удаляет значения старше RateWindow.
+func (e *Engine) recordSamples(now time.Time, values map[string]float64) {
+	for _, rule := range e.rules {
+		if !rule.Rate {
+			continue
+		}
+		for key, value := range values {
+			if name, _ := labels.SplitSeriesKey(key); name != rule.Metric {
+				continue
+			}
+			samples := e.samples[key]
+			if n := len(samples); n > 0 && samples[n-1].time.Equal(now) {
+				continue
+			}
+			e.samples[key] = append(samples, sample{time: now, value: value})
+		}
+	}
+
+	for key, samples := range e.samples {
+		if _, ok := values[key]; !ok {
+			delete(e.samples, key)
+			continue
+		}
+		// Оставляем последнее значение за пределами окна, чтобы rate вычислялся за все окно.
+		i := 0
+		for i+1 < len(samples) && now.Sub(samples[i+1].time) >= RateWindow {
+			i++
+		}
+		e.samples[key] = samples[i:]
+	}
+}
+
+// rate возвращает скорость изменения значения серии в секунду.
+// При уменьшении значения (сброс counter) скорость считается от нуля.
+func (e *Engine) rate(key string) (float64, bool) {
+	samples := e.samples[key]
+	if len(samples) < 2 {
+		return 0, false
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	seconds := last.time.Sub(first.time).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	delta := last.value - first.value
+	if delta < 0 {
+		delta = last.value
+	}
+	return delta / seconds, true
+}
+
+func fingerprint(rule string, key string) string {
+	sum := sha256.Sum256([]byte(rule + "\x00" + key))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,130 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"metrics/internal/constants"
+
+	"go.uber.org/zap"
+)
+
+// Размер очереди оповещений. При переполнении новые оповещения отбрасываются.
+const notifyQueueSize = 256
+
+// Notifier отправляет оповещения на webhook-адреса.
+// Каждое оповещение отправляется на каждый адрес с повторными попытками. Повторное оповещение
+// с тем же состоянием для того же алерта и адреса не отправляется.
+type Notifier struct {
+	webhooks []string
+	client   *http.Client
+	logger   *zap.Logger
+	queue    chan Alert
+	backoff  func(attempt int) time.Duration
+
+	m    sync.Mutex
+	sent map[string]string // адрес и идентификатор алерта -> последнее отправленное состояние
+}
+
+func NewNotifier(webhooks []string, logger *zap.Logger) *Notifier {
+	return &Notifier{
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+		queue:    make(chan Alert, notifyQueueSize),
+		backoff: func(attempt int) time.Duration {
+			return time.Duration(attempt*2+1) * time.Second // Backoff: 1s, 3s, 5s
+		},
+		sent: make(map[string]string),
+	}
+}
+
+// Notify ставит оповещение в очередь на отправку.
+func (n *Notifier) Notify(alert Alert) {
+	if len(n.webhooks) == 0 {
+		return
+	}
+	select {
+	case n.queue <- alert:
+	default:
+		n.logger.Error("очередь оповещений переполнена, оповещение отброшено", zap.String("rule", alert.Rule), zap.String("state", alert.State))
+	}
+}
+
+// Run отправляет оповещения из очереди до отмены ctx.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-n.queue:
+			for _, url := range n.webhooks {
+				n.deliver(ctx, url, alert)
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, url string, alert Alert) {
+	dedupKey := url + "|" + alert.Fingerprint
+	n.m.Lock()
+	duplicate := n.sent[dedupKey] == alert.State
+	n.m.Unlock()
+	if duplicate {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		n.logger.Error("ошибка при формировании оповещения: " + err.Error())
+		return
+	}
+
+	for attempt := 0; attempt <= constants.RetryCount; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(n.backoff(attempt - 1)):
+			}
+		}
+
+		if err = n.post(ctx, url, alert, body); err == nil {
+			n.m.Lock()
+			if alert.State == StateResolved {
+				delete(n.sent, dedupKey)
+			} else {
+				n.sent[dedupKey] = alert.State
+			}
+			n.m.Unlock()
+			return
+		}
+	}
+
+	n.logger.Error("не удалось отправить оповещение", zap.String("url", url), zap.String("rule", alert.Rule), zap.Error(err))
+}
+
+func (n *Notifier) post(ctx context.Context, url string, alert Alert, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Alert-Fingerprint", alert.Fingerprint)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook вернул статус %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package alerting
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+// Множители единиц измерения порога (степени 1024, как в runtime.MemStats).
+var units = map[string]float64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+var exprRe = regexp.MustCompile(`^\s*(rate\(\s*)?([^\s{}()]+)\s*(\{[^}]*\})?\s*(\))?\s*(>=|<=|==|!=|>|<)\s*([-+]?[0-9.]+(?:[eE][-+]?[0-9]+)?)\s*([a-zA-Z]*)\s*(?:for\s+(\S+))?\s*$`)
+
+// Rule - правило оповещения.
+type Rule struct {
+	Name      string
+	Expr      string
+	Metric    string
+	Labels    map[string]string // метки, которые должна содержать серия
+	Rate      bool              // сравнивается скорость изменения значения в секунду
+	Op        string
+	Threshold float64
+	For       time.Duration // сколько условие должно выполняться до срабатывания
+}
+
+// ParseRule разбирает правило вида:
+//
+//	Metric[{label="value"}] op threshold[unit] [for duration]
+//	rate(Metric[{label="value"}]) op threshold [for duration]
+//
+// где op - одна из операций >, >=, <, <=, ==, !=, unit - B, KB, MB, GB или TB.
+func ParseRule(name string, expr string) (rule Rule, err error) {
+	match := exprRe.FindStringSubmatch(expr)
+	if match == nil || (match[1] != "") != (match[4] != "") {
+		return rule, fmt.Errorf("неверный формат правила %q", expr)
+	}
+
+	rule = Rule{
+		Name:   name,
+		Expr:   strings.TrimSpace(expr),
+		Metric: match[2],
+		Rate:   match[1] != "",
+		Op:     match[5],
+	}
+	if rule.Name == "" {
+		rule.Name = rule.Expr
+	}
+
+	if match[3] != "" {
+		if rule.Labels, err = labels.Parse(match[3][1 : len(match[3])-1]); err != nil {
+			return rule, fmt.Errorf("неверные метки в правиле %q: %w", expr, err)
+		}
+	}
+
+	threshold, err := strconv.ParseFloat(match[6], 64)
+	if err != nil {
+		return rule, fmt.Errorf("неверный порог в правиле %q", expr)
+	}
+	multiplier, ok := units[strings.ToUpper(match[7])]
+	if !ok {
+		return rule, fmt.Errorf("неизвестная единица измерения %q в правиле %q", match[7], expr)
+	}
+	rule.Threshold = threshold * multiplier
+
+	if match[8] != "" {
+		if rule.For, err = time.ParseDuration(match[8]); err != nil || rule.For < 0 {
+			return rule, fmt.Errorf("неверная длительность в правиле %q", expr)
+		}
+	}
+
+	return rule, nil
+}
+
+// ParseRules разбирает правила из JSON-конфигурации сервера.
+func ParseRules(configs []models.AlertRule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(configs))
+	names := make(map[string]bool)
+	for _, cfg := range configs {
+		rule, err := ParseRule(cfg.Name, cfg.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("правило %q указано несколько раз", rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Matches проверяет, что значение удовлетворяет условию правила.
+func (r Rule) Matches(value float64) bool {
+	if math.IsNaN(value) {
+		return false
+	}
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+	return false
+}
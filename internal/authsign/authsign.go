@@ -1,11 +1,22 @@
 // Пакет authsign реализует механизм подписи передаваемых данных по алгоритму SHA256. Для этого используется hash.
 // от всего тела запроса, которвый разещается в HTTP-заголовке HashSHA256.
+//
+// Подпись запроса версии 2 (SignRequest) кроме тела покрывает метод, путь, время подписи и одноразовое значение (nonce),
+// которые передаются в заголовках X-Signature-Timestamp и X-Signature-Nonce. Сервер отклоняет запросы с временем подписи
+// вне допустимого окна и повторные запросы с тем же nonce, поэтому перехваченный запрос нельзя отправить повторно.
 package authsign
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metrics/internal/constants"
 )
 
 func VerifySig(receivedHash string, data []byte, key []byte) bool {
@@ -19,3 +30,53 @@ func CalculateHash(data []byte, key []byte) string {
 	calculatedHash := hash.Sum(nil)
 	return hex.EncodeToString(calculatedHash)
 }
+
+// CalculateRequestHash возвращает подпись запроса версии 2: HMAC-SHA256 от строки
+// "method\nuri\ntimestamp\nnonce\nsha256(body)", где uri - путь с параметрами запроса.
+func CalculateRequestHash(method, uri, timestamp, nonce string, body []byte, key []byte) string {
+	bodyHash := sha256.Sum256(body)
+	hash := hmac.New(sha256.New, key)
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n%s", method, uri, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// VerifyRequestSig проверяет подпись запроса версии 2.
+func VerifyRequestSig(receivedHash, method, uri, timestamp, nonce string, body []byte, key []byte) bool {
+	calculatedHash := CalculateRequestHash(method, uri, timestamp, nonce, body, key)
+	return hmac.Equal([]byte(receivedHash), []byte(calculatedHash))
+}
+
+// CheckTimestamp проверяет время подписи timestamp (Unix-секунды): оно должно отличаться от now не больше чем на skew.
+func CheckTimestamp(timestamp string, now time.Time, skew time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("неверный формат заголовка %s", constants.HeaderSigTimestamp)
+	}
+	if diff := now.Sub(time.Unix(seconds, 0)); diff > skew || diff < -skew {
+		return fmt.Errorf("время подписи запроса вне допустимого окна ±%s", skew)
+	}
+	return nil
+}
+
+// CheckNonce проверяет, что nonce заполнен и не длиннее MaxNonceLength.
+func CheckNonce(nonce string) error {
+	if nonce == "" || len(nonce) > MaxNonceLength {
+		return fmt.Errorf("заголовок %s не заполнен или длиннее %d символов", constants.HeaderSigNonce, MaxNonceLength)
+	}
+	return nil
+}
+
+// SignRequest подписывает запрос по схеме версии 2: заполняет заголовки X-Signature-Timestamp,
+// X-Signature-Nonce и HashSHA256. body - тело запроса до сжатия и шифрования.
+func SignRequest(req *http.Request, body []byte, key []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set(constants.HeaderSigTimestamp, timestamp)
+	req.Header.Set(constants.HeaderSigNonce, hex.EncodeToString(nonce))
+	req.Header.Set(constants.HeaderSig, CalculateRequestHash(req.Method, req.URL.RequestURI(), timestamp, hex.EncodeToString(nonce), body, key))
+	return nil
+}
@@ -0,0 +1,172 @@
+package authsign
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/validation"
+
+	"go.uber.org/zap"
+)
+
+// MaxNonceLength - наибольшая длина заголовка X-Signature-Nonce.
+const MaxNonceLength = 128
+
+type SignMiddleware struct {
+	config *config.Config
+	logger *zap.Logger
+}
+
+func NewSignMW(cfg *config.Config, logger *zap.Logger) *SignMiddleware {
+	return &SignMiddleware{
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Sign подписывает ответ h: если на сервере задан ключ, то в заголовке HashSHA256 передается
+// HMAC-SHA256 от тела ответа до сжатия. Ответ буферизуется, поэтому Sign не подходит для потоковых эндпоинтов.
+func (s *SignMiddleware) Sign(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.SecretKey == "" {
+			h(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(recorder, r)
+
+		body := recorder.body.Bytes()
+		w.Header().Set(constants.HeaderSig, CalculateHash(body, []byte(s.config.SecretKey)))
+		w.WriteHeader(recorder.status)
+		if _, err := w.Write(body); err != nil {
+			s.logger.Error("ошибка при отправке ответа: " + err.Error())
+		}
+	}
+}
+
+// responseRecorder накапливает код и тело ответа, чтобы подпись можно было передать в заголовке.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.status = statusCode
+		r.wroteHeader = true
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(b)
+}
+
+type verifiedKey struct{}
+
+// Verified сообщает, что подпись запроса с контекстом ctx проверена Verify.
+// Запросы без подписи, пропущенные в режиме LegacySignature или без ключа на сервере, проверенными не считаются.
+func Verified(ctx context.Context) bool {
+	verified, _ := ctx.Value(verifiedKey{}).(bool)
+	return verified
+}
+
+type VerifyMiddleware struct {
+	config *config.Config
+	nonces *NonceCache
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+func NewVerifyMW(cfg *config.Config, logger *zap.Logger) *VerifyMiddleware {
+	return &VerifyMiddleware{
+		config: cfg,
+		// Время подписи принимается в окне ±SignatureSkew, поэтому nonce хранится вдвое дольше.
+		nonces: NewNonceCache(2 * cfg.Server.SignatureSkew),
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Verify пропускает запрос к h, только если он подписан ключом сервера по схеме версии 2
+// (см. SignRequest), время подписи входит в допустимое окно, а nonce не использовался ранее.
+// Если разрешена подпись версии 1 (LegacySignature), то запрос без заголовка X-Signature-Timestamp
+// проверяется по-старому: подпись тела проверяется, только если она передана.
+// Если ключ на сервере не задан, запрос передается h без проверки.
+// Подпись вычисляется от тела до сжатия и шифрования, поэтому Verify должен вызываться после распаковки и расшифровки.
+func (v *VerifyMiddleware) Verify(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if v.config.SecretKey == "" {
+			h(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			validation.WriteError(w, http.StatusBadRequest, fmt.Sprintf("ошибка при чтении тела запроса: %s", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		verified, err := v.verify(r, body)
+		if err != nil {
+			v.logger.Warn("неверная подпись запроса", zap.Error(err), zap.String("remote", r.RemoteAddr), zap.String("path", r.URL.Path))
+			validation.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if verified {
+			r = r.WithContext(context.WithValue(r.Context(), verifiedKey{}, true))
+		}
+
+		h(w, r)
+	}
+}
+
+// verify проверяет подпись запроса. verified = false, если запрос без подписи пропущен в режиме LegacySignature.
+func (v *VerifyMiddleware) verify(r *http.Request, body []byte) (verified bool, err error) {
+	key := []byte(v.config.SecretKey)
+	receivedHash := r.Header.Get(constants.HeaderSig)
+	timestamp := r.Header.Get(constants.HeaderSigTimestamp)
+
+	if timestamp == "" {
+		if !v.config.Server.LegacySignature {
+			return false, fmt.Errorf("запрос не подписан: требуются заголовки %s, %s и %s", constants.HeaderSig, constants.HeaderSigTimestamp, constants.HeaderSigNonce)
+		}
+		if receivedHash == "" {
+			return false, nil
+		}
+		if !VerifySig(receivedHash, body, key) {
+			return false, fmt.Errorf("invalid hash")
+		}
+		return true, nil
+	}
+
+	now := v.now()
+	if err = CheckTimestamp(timestamp, now, v.config.Server.SignatureSkew); err != nil {
+		return false, err
+	}
+
+	nonce := r.Header.Get(constants.HeaderSigNonce)
+	if err = CheckNonce(nonce); err != nil {
+		return false, err
+	}
+
+	if !VerifyRequestSig(receivedHash, r.Method, r.URL.RequestURI(), timestamp, nonce, body, key) {
+		return false, fmt.Errorf("invalid hash")
+	}
+
+	// nonce запоминается только после проверки подписи, чтобы нельзя было заполнить кеш чужими значениями.
+	if !v.nonces.Add(nonce, now) {
+		return false, fmt.Errorf("повторный запрос: nonce уже использован")
+	}
+	return true, nil
+}
@@ -0,0 +1,108 @@
+package authsign
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"metrics/internal/config"
+	"metrics/internal/constants"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSignMiddleware_Sign(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":`))
+		w.Write([]byte(`true}`))
+	}
+
+	rec := httptest.NewRecorder()
+	NewSignMW(&config.Config{SecretKey: "secret"}, zap.NewNop()).Sign(h)(rec, httptest.NewRequest(http.MethodPost, "/updates/", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `{"ok":true}`, rec.Body.String())
+	assert.True(t, VerifySig(rec.Header().Get(constants.HeaderSig), rec.Body.Bytes(), []byte("secret")))
+
+	rec = httptest.NewRecorder()
+	NewSignMW(&config.Config{}, zap.NewNop()).Sign(h)(rec, httptest.NewRequest(http.MethodPost, "/updates/", nil))
+	assert.Empty(t, rec.Header().Get(constants.HeaderSig))
+}
+
+func TestVerifyMiddleware_Verify(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"id":"c","type":"counter","delta":1}]`)
+	now := time.Unix(1700000000, 0)
+
+	newRequest := func() *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/updates/?mode=best-effort", bytes.NewReader(body))
+	}
+	signed := func(ts time.Time, nonce string) *http.Request {
+		r := newRequest()
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		r.Header.Set(constants.HeaderSigTimestamp, timestamp)
+		r.Header.Set(constants.HeaderSigNonce, nonce)
+		r.Header.Set(constants.HeaderSig, CalculateRequestHash(r.Method, r.URL.RequestURI(), timestamp, nonce, body, []byte(key)))
+		return r
+	}
+	legacy := func() *http.Request {
+		r := newRequest()
+		r.Header.Set(constants.HeaderSig, CalculateHash(body, []byte(key)))
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		legacy  bool
+		request *http.Request
+		want    int
+	}{
+		{name: "v2", request: signed(now, "n1"), want: http.StatusOK},
+		{name: "replay", request: signed(now, "n1"), want: http.StatusBadRequest},
+		{name: "skew", request: signed(now.Add(-6*time.Minute), "n2"), want: http.StatusBadRequest},
+		{name: "no nonce", request: signed(now, ""), want: http.StatusBadRequest},
+		{name: "unsigned", request: newRequest(), want: http.StatusBadRequest},
+		{name: "v1 rejected", request: legacy(), want: http.StatusBadRequest},
+		{name: "v1 legacy", legacy: true, request: legacy(), want: http.StatusOK},
+		{name: "v2 legacy", legacy: true, request: signed(now, "n3"), want: http.StatusOK},
+	}
+
+	cfg := &config.Config{SecretKey: key, Server: config.ServerConfig{SignatureSkew: 5 * time.Minute}}
+	mw := NewVerifyMW(cfg, zap.NewNop())
+	mw.now = func() time.Time { return now }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Server.LegacySignature = tt.legacy
+			var received []byte
+			h := mw.Verify(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+			})
+
+			rec := httptest.NewRecorder()
+			h(rec, tt.request)
+			assert.Equal(t, tt.want, rec.Code)
+			if tt.want == http.StatusOK {
+				assert.Equal(t, body, received)
+			}
+		})
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	body := []byte(`{"id":"g"}`)
+	r := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body))
+	require.NoError(t, SignRequest(r, body, []byte("secret")))
+
+	assert.NotEmpty(t, r.Header.Get(constants.HeaderSigNonce))
+	assert.True(t, VerifyRequestSig(r.Header.Get(constants.HeaderSig), r.Method, r.URL.RequestURI(),
+		r.Header.Get(constants.HeaderSigTimestamp), r.Header.Get(constants.HeaderSigNonce), body, []byte("secret")))
+}
@@ -0,0 +1,45 @@
+package authsign
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceCache хранит использованные значения nonce в течение ttl.
+// ttl должен быть не меньше ширины окна допустимого времени подписи, иначе запрос можно будет повторить
+// после удаления nonce из кеша, пока время его подписи еще входит в окно.
+type NonceCache struct {
+	ttl time.Duration
+
+	m         sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewNonceCache(ttl time.Duration) *NonceCache {
+	return &NonceCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Add запоминает nonce и возвращает false, если он уже использовался в течение ttl.
+func (c *NonceCache) Add(nonce string, now time.Time) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if now.Sub(c.lastSweep) >= c.ttl/2 {
+		c.lastSweep = now
+		for n, added := range c.seen {
+			if now.Sub(added) > c.ttl {
+				delete(c.seen, n)
+			}
+		}
+	}
+
+	if added, ok := c.seen[nonce]; ok && now.Sub(added) <= c.ttl {
+		return false
+	}
+	c.seen[nonce] = now
+	return true
+}
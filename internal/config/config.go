@@ -1,7 +1,15 @@
 // В пакете config происходит создание объекта Config, отвечающего за настройки сервиса.
 package config
 
-import "metrics/internal/constants"
+import (
+	"net"
+	"strings"
+	"time"
+
+	"metrics/internal/alerting"
+	"metrics/internal/constants"
+	"metrics/internal/retention"
+)
 
 //-----------------------------------------------------------------------------------------------------------------------
 // должны ли быть поля структуры Config публичными? или нужно сделать приватными и метод для доступа к каждому параметру?
@@ -13,6 +21,7 @@ type Config struct {
 	Database       DatabaseConfig
 	SecretKey      string
 	PrivateKeyPath string
+	AdminToken     string // Токен доступа к эндпоинтам /admin/, если не заполнен - эндпоинты недоступны
 }
 
 // ServerConfig- серверная часть настроек.
@@ -21,6 +30,31 @@ type ServerConfig struct {
 	StoreInterval   int64  // Интервал сохранения метрик на сервере в секундах
 	FileStoragePath string // Имя файла, куда будут сохранены метрики
 	Restore         bool   // Загружать или нет ранее сохраненные метрики из файла
+	GRPCAddress     string // Адрес gRPC-сервера, если не заполнен - gRPC-сервер не запускается
+	StatsDAddress   string // Адрес UDP-порта для метрик в формате StatsD, если не заполнен - прием не запускается
+	HistorySize     int    // Количество точек истории каждой серии при хранении метрик в памяти
+
+	RetentionInterval int64              // Интервал применения политик хранения истории в секундах
+	Retention         retention.Policies // Политики хранения истории
+
+	AlertInterval time.Duration   // Интервал проверки правил оповещений по таймеру
+	AlertRules    []alerting.Rule // Правила оповещений, если не заполнены - проверка не запускается
+	AlertWebhooks []string        // Адреса, на которые отправляются оповещения
+
+	SnapshotDir    string        // Каталог снимков метрик
+	IdempotencyTTL time.Duration // Время хранения ключей Idempotency-Key
+
+	RateLimitRPS     float64 // Ограничение количества запросов на обновление в секунду для одного клиента, 0 - без ограничения
+	RateLimitMetrics int     // Ограничение количества метрик в минуту для одного клиента, 0 - без ограничения
+
+	TrustedSubnet *net.IPNet // Подсеть, из которой принимаются обновления метрик, если не заполнена - проверка не выполняется
+
+	SignatureSkew   time.Duration // Допустимое расхождение времени подписи запроса версии 2 и времени сервера
+	LegacySignature bool          // Принимать запросы, подписанные только по телу (подпись версии 1) или без подписи
+
+	TLSCertPath     string // Сертификат сервера, если не заполнен - сервер работает по HTTP
+	TLSKeyPath      string // Приватный ключ сертификата сервера
+	TLSClientCAPath string // Сертификаты CA для проверки сертификатов клиентов, если не заполнен - сертификат клиента не требуется
 }
 
 // DatabaseConfig - настройки относящиеся к уровню БД.
@@ -36,6 +70,31 @@ func NewConfig(flags *Flags) *Config {
 			StoreInterval:   flags.Server.StoreInterval,
 			FileStoragePath: flags.Server.FileStoragePath,
 			Restore:         flags.Server.Restore,
+			GRPCAddress:     flags.Server.GRPCAddress,
+			StatsDAddress:   flags.Server.StatsDAddress,
+			HistorySize:     flags.Server.HistorySize,
+
+			RetentionInterval: flags.Server.RetentionInterval,
+			Retention:         flags.Server.Retention,
+
+			AlertInterval: flags.Server.AlertInterval,
+			AlertRules:    flags.Server.AlertRules,
+			AlertWebhooks: flags.Server.AlertWebhooks,
+
+			SnapshotDir:    flags.Server.SnapshotDir,
+			IdempotencyTTL: flags.Server.IdempotencyTTL,
+
+			RateLimitRPS:     flags.Server.RateLimitRPS,
+			RateLimitMetrics: flags.Server.RateLimitMetrics,
+
+			TrustedSubnet: flags.Server.TrustedSubnet,
+
+			SignatureSkew:   flags.Server.SignatureSkew,
+			LegacySignature: flags.Server.LegacySignature,
+
+			TLSCertPath:     flags.Server.TLSCertPath,
+			TLSKeyPath:      flags.Server.TLSKeyPath,
+			TLSClientCAPath: flags.Server.TLSClientCAPath,
 		},
 		Database: DatabaseConfig{
 			DatabaseDsn: flags.Database.DatabaseDsn,
@@ -43,6 +102,7 @@ func NewConfig(flags *Flags) *Config {
 		},
 		SecretKey:      flags.SecretKey,
 		PrivateKeyPath: flags.PrivateCryptoKey,
+		AdminToken:     flags.AdminToken,
 	}
 }
 
@@ -66,6 +126,57 @@ func (cfg *Config) IsSyncStore() bool {
 	return cfg.Server.StoreInterval == 0
 }
 
+func (cfg *Config) IsGRPCEnabled() bool {
+	return cfg.Server.GRPCAddress != ""
+}
+
+func (cfg *Config) IsStatsDEnabled() bool {
+	return cfg.Server.StatsDAddress != ""
+}
+
+func (cfg *Config) IsRetentionEnabled() bool {
+	return len(cfg.Server.Retention) > 0 && cfg.Server.RetentionInterval > 0
+}
+
+func (cfg *Config) GetRetentionInterval() time.Duration {
+	return time.Duration(cfg.Server.RetentionInterval) * time.Second
+}
+
+func (cfg *Config) IsAlertingEnabled() bool {
+	return len(cfg.Server.AlertRules) > 0
+}
+
+func (cfg *Config) IsRateLimitEnabled() bool {
+	return cfg.Server.RateLimitRPS > 0 || cfg.Server.RateLimitMetrics > 0
+}
+
+func (cfg *Config) IsTrustedSubnetEnabled() bool {
+	return cfg.Server.TrustedSubnet != nil
+}
+
+func (cfg *Config) IsTLSEnabled() bool {
+	return cfg.Server.TLSCertPath != ""
+}
+
+func (cfg *Config) IsDecryptEnabled() bool {
+	return cfg.PrivateKeyPath != ""
+}
+
+// GetPrivateKeyPaths возвращает пути к приватным ключам: флаг -crypto-key может содержать несколько путей через запятую.
+func (cfg *Config) GetPrivateKeyPaths() []string {
+	var paths []string
+	for _, path := range strings.Split(cfg.PrivateKeyPath, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (cfg *Config) IsAdminEnabled() bool {
+	return cfg.AdminToken != ""
+}
+
 func (cfg *Config) GetRetryCount() int {
 	return cfg.Database.RetryCount
 }
@@ -9,25 +9,48 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"metrics/internal/alerting"
 	"metrics/internal/constants"
 	"metrics/internal/models"
+	"metrics/internal/retention"
+	"net"
 	"os"
 	"strconv"
+	"time"
 )
 
 // В структуру Flags сохраняются параметры конфигурации из флагов и переменных окружения.
 type Flags struct {
 	Server struct {
-		ServerAddress   string //`env:"ADDRESS"`
-		StoreInterval   int64  //`env:"STORE_INTERVAL"`
-		FileStoragePath string //`env:"FILE_STORAGE_PATH"`
-		Restore         bool   //`env:"RESTORE"`
+		ServerAddress     string //`env:"ADDRESS"`
+		StoreInterval     int64  //`env:"STORE_INTERVAL"`
+		FileStoragePath   string //`env:"FILE_STORAGE_PATH"`
+		Restore           bool   //`env:"RESTORE"`
+		GRPCAddress       string //`env:"GRPC_ADDRESS"`
+		StatsDAddress     string //`env:"STATSD_ADDRESS"`
+		HistorySize       int    //`env:"HISTORY_SIZE"`
+		RetentionInterval int64  //`env:"RETENTION_INTERVAL"`
+		Retention         retention.Policies
+		AlertInterval     time.Duration //`env:"ALERT_INTERVAL"`
+		AlertRules        []alerting.Rule
+		AlertWebhooks     []string
+		SnapshotDir       string        //`env:"SNAPSHOT_DIR"`
+		IdempotencyTTL    time.Duration //`env:"IDEMPOTENCY_TTL"`
+		RateLimitRPS      float64       //`env:"RATE_LIMIT_RPS"`
+		RateLimitMetrics  int           //`env:"RATE_LIMIT_METRICS"`
+		TrustedSubnet     *net.IPNet    //`env:"TRUSTED_SUBNET"`
+		SignatureSkew     time.Duration //`env:"SIGNATURE_SKEW"`
+		LegacySignature   bool          //`env:"LEGACY_SIGNATURE"`
+		TLSCertPath       string        //`env:"TLS_CERT"`
+		TLSKeyPath        string        //`env:"TLS_KEY"`
+		TLSClientCAPath   string        //`env:"TLS_CLIENT_CA"`
 	}
 	Database struct {
 		DatabaseDsn string //`env:"DATABASE_DSN"`
 	}
 	SecretKey        string //`env:"KEY"`
 	PrivateCryptoKey string //`env:"CRYPTO_KEY"`
+	AdminToken       string //`env:"ADMIN_TOKEN"`
 	ConfigPath       string //`env:CONFIG`
 	ConfigPathShort  string
 }
@@ -37,14 +60,31 @@ func ParseFlags() (*Flags, error) {
 
 	var flags Flags
 	var err error
+	var trustedSubnet string
 
 	flag.StringVar(&flags.Server.ServerAddress, "a", constants.DefaultServerAddress, "Адрес эндпоинта HTTP-сервера")
 	flag.Int64Var(&flags.Server.StoreInterval, "i", constants.DefaultStoreInterval, "Интервал времени в секундах, по истечении которого текущие показания сервера сохраняются на диск")
 	flag.StringVar(&flags.Server.FileStoragePath, "f", constants.DefaultStoreFile, "Путь до файла, куда сохраняются текущие значения")
 	flag.BoolVar(&flags.Server.Restore, "r", constants.DefaultRestore, "Загрузка ранее сохранённые значения из указанного файла при старте сервера")
+	flag.StringVar(&flags.Server.GRPCAddress, "g", "", "Адрес эндпоинта gRPC-сервера")
+	flag.StringVar(&flags.Server.StatsDAddress, "statsd-address", "", "Адрес UDP-порта для приема метрик в формате StatsD")
+	flag.IntVar(&flags.Server.HistorySize, "history-size", constants.DefaultHistorySize, "Количество точек истории каждой метрики при хранении в памяти")
+	flag.Int64Var(&flags.Server.RetentionInterval, "retention-interval", constants.DefaultRetentionInterval, "Интервал времени в секундах, с которым применяются политики хранения истории")
+	flag.DurationVar(&flags.Server.AlertInterval, "alert-interval", mustParseDuration(constants.DefaultAlertInterval), "Интервал проверки правил оповещений по таймеру")
+	flag.StringVar(&flags.Server.SnapshotDir, "snapshot-dir", constants.DefaultSnapshotDir, "Каталог для снимков метрик")
+	flag.DurationVar(&flags.Server.IdempotencyTTL, "idempotency-ttl", mustParseDuration(constants.DefaultIdempotencyTTL), "Время хранения ключей Idempotency-Key")
+	flag.Float64Var(&flags.Server.RateLimitRPS, "rate-limit-rps", 0, "Ограничение количества запросов на обновление метрик в секунду для одного клиента, 0 - без ограничения")
+	flag.IntVar(&flags.Server.RateLimitMetrics, "rate-limit-metrics", 0, "Ограничение количества метрик в минуту для одного клиента, 0 - без ограничения")
+	flag.StringVar(&trustedSubnet, "t", "", "Подсеть в формате CIDR, из которой принимаются обновления метрик (по заголовку X-Real-IP)")
+	flag.DurationVar(&flags.Server.SignatureSkew, "signature-skew", mustParseDuration(constants.DefaultSignatureSkew), "Допустимое расхождение времени подписи запроса и времени сервера")
+	flag.BoolVar(&flags.Server.LegacySignature, "legacy-signature", false, "Принимать запросы с подписью только по телу запроса (без времени и nonce)")
+	flag.StringVar(&flags.Server.TLSCertPath, "tls-cert", "", "Путь до файла с сертификатом сервера для HTTPS")     //./key/cert.pem
+	flag.StringVar(&flags.Server.TLSKeyPath, "tls-key", "", "Путь до файла с приватным ключом сертификата сервера") //./key/private_key.pem
+	flag.StringVar(&flags.Server.TLSClientCAPath, "tls-client-ca", "", "Путь до файла с сертификатами CA, которыми должны быть подписаны сертификаты клиентов (mTLS)")
 	flag.StringVar(&flags.Database.DatabaseDsn, "d", "", "Строка c адресом подключения к БД") //"host=localhost user=metrics password=test dbname=metrics sslmode=disable"
 	flag.StringVar(&flags.SecretKey, "k", "", "Ключ для подписи передаваемых данных")
-	flag.StringVar(&flags.PrivateCryptoKey, "crypto-key", "", "Путь до файла с приватным ключом") //./key/private_key.pem
+	flag.StringVar(&flags.PrivateCryptoKey, "crypto-key", "", "Путь до файла с приватным ключом (несколько файлов или каталогов через запятую)") //./key/private_key.pem
+	flag.StringVar(&flags.AdminToken, "admin-token", "", "Токен доступа к эндпоинтам администрирования")
 	flag.StringVar(&flags.ConfigPath, "config", "", "конфигурации сервера с помощью файла в формате JSON")
 	flag.StringVar(&flags.ConfigPath, "c", "", "конфигурации сервера с помощью файла в формате JSON(shorthand)")
 
@@ -101,6 +141,173 @@ func ParseFlags() (*Flags, error) {
 		flags.Server.Restore = serverConfig.Restore
 	}
 
+	if envGRPCAddr := os.Getenv("GRPC_ADDRESS"); envGRPCAddr != "" {
+		flags.Server.GRPCAddress = envGRPCAddr
+	} else if flags.Server.GRPCAddress == "" && serverConfig.GRPCAddress != "" {
+		flags.Server.GRPCAddress = serverConfig.GRPCAddress
+	}
+
+	if envStatsDAddr := os.Getenv("STATSD_ADDRESS"); envStatsDAddr != "" {
+		flags.Server.StatsDAddress = envStatsDAddr
+	} else if flags.Server.StatsDAddress == "" && serverConfig.StatsDAddress != "" {
+		flags.Server.StatsDAddress = serverConfig.StatsDAddress
+	}
+
+	if envHistorySize := os.Getenv("HISTORY_SIZE"); envHistorySize != "" {
+		flags.Server.HistorySize, err = strconv.Atoi(envHistorySize)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.HistorySize == constants.DefaultHistorySize && serverConfig.HistorySize != 0 {
+		flags.Server.HistorySize = serverConfig.HistorySize
+	}
+
+	if envRetentionInterval := os.Getenv("RETENTION_INTERVAL"); envRetentionInterval != "" {
+		flags.Server.RetentionInterval, err = strconv.ParseInt(envRetentionInterval, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.RetentionInterval == constants.DefaultRetentionInterval && serverConfig.RetentionInterval != "" {
+		interval, err := strconv.ParseInt(serverConfig.RetentionInterval, 10, 64)
+		if err == nil {
+			flags.Server.RetentionInterval = interval
+		}
+	}
+
+	// политики хранения задаются только в JSON-конфигурации
+	flags.Server.Retention, err = retention.ParsePolicies(serverConfig.Retention)
+	if err != nil {
+		return nil, err
+	}
+
+	if envAlertInterval := os.Getenv("ALERT_INTERVAL"); envAlertInterval != "" {
+		flags.Server.AlertInterval, err = time.ParseDuration(envAlertInterval)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.AlertInterval == mustParseDuration(constants.DefaultAlertInterval) && serverConfig.Alerts.Interval != "" {
+		flags.Server.AlertInterval, err = time.ParseDuration(serverConfig.Alerts.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flags.Server.AlertInterval <= 0 {
+		return nil, fmt.Errorf("интервал проверки правил оповещений должен быть положительным")
+	}
+
+	// правила и адреса оповещений задаются только в JSON-конфигурации
+	flags.Server.AlertRules, err = alerting.ParseRules(serverConfig.Alerts.Rules)
+	if err != nil {
+		return nil, err
+	}
+	flags.Server.AlertWebhooks = serverConfig.Alerts.Webhooks
+
+	if envSnapshotDir := os.Getenv("SNAPSHOT_DIR"); envSnapshotDir != "" {
+		flags.Server.SnapshotDir = envSnapshotDir
+	} else if flags.Server.SnapshotDir == constants.DefaultSnapshotDir && serverConfig.SnapshotDir != "" {
+		flags.Server.SnapshotDir = serverConfig.SnapshotDir
+	}
+
+	if envIdempotencyTTL := os.Getenv("IDEMPOTENCY_TTL"); envIdempotencyTTL != "" {
+		flags.Server.IdempotencyTTL, err = time.ParseDuration(envIdempotencyTTL)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.IdempotencyTTL == mustParseDuration(constants.DefaultIdempotencyTTL) && serverConfig.IdempotencyTTL != "" {
+		flags.Server.IdempotencyTTL, err = time.ParseDuration(serverConfig.IdempotencyTTL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flags.Server.IdempotencyTTL <= 0 {
+		return nil, fmt.Errorf("время хранения ключей Idempotency-Key должно быть положительным")
+	}
+
+	if envRateLimitRPS := os.Getenv("RATE_LIMIT_RPS"); envRateLimitRPS != "" {
+		flags.Server.RateLimitRPS, err = strconv.ParseFloat(envRateLimitRPS, 64)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.RateLimitRPS == 0 && serverConfig.RateLimitRPS != 0 {
+		flags.Server.RateLimitRPS = serverConfig.RateLimitRPS
+	}
+	if flags.Server.RateLimitRPS < 0 {
+		return nil, fmt.Errorf("ограничение количества запросов в секунду не может быть отрицательным")
+	}
+
+	if envRateLimitMetrics := os.Getenv("RATE_LIMIT_METRICS"); envRateLimitMetrics != "" {
+		flags.Server.RateLimitMetrics, err = strconv.Atoi(envRateLimitMetrics)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.RateLimitMetrics == 0 && serverConfig.RateLimitMetrics != 0 {
+		flags.Server.RateLimitMetrics = serverConfig.RateLimitMetrics
+	}
+	if flags.Server.RateLimitMetrics < 0 {
+		return nil, fmt.Errorf("ограничение количества метрик в минуту не может быть отрицательным")
+	}
+
+	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
+		trustedSubnet = envTrustedSubnet
+	} else if trustedSubnet == "" && serverConfig.TrustedSubnet != "" {
+		trustedSubnet = serverConfig.TrustedSubnet
+	}
+	if trustedSubnet != "" {
+		_, flags.Server.TrustedSubnet, err = net.ParseCIDR(trustedSubnet)
+		if err != nil {
+			return nil, fmt.Errorf("неверный формат доверенной подсети: %w", err)
+		}
+	}
+
+	if envSignatureSkew := os.Getenv("SIGNATURE_SKEW"); envSignatureSkew != "" {
+		flags.Server.SignatureSkew, err = time.ParseDuration(envSignatureSkew)
+		if err != nil {
+			return nil, err
+		}
+	} else if flags.Server.SignatureSkew == mustParseDuration(constants.DefaultSignatureSkew) && serverConfig.SignatureSkew != "" {
+		flags.Server.SignatureSkew, err = time.ParseDuration(serverConfig.SignatureSkew)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flags.Server.SignatureSkew <= 0 {
+		return nil, fmt.Errorf("допустимое расхождение времени подписи должно быть положительным")
+	}
+
+	if envLegacySignature := os.Getenv("LEGACY_SIGNATURE"); envLegacySignature != "" {
+		flags.Server.LegacySignature, err = strconv.ParseBool(envLegacySignature)
+		if err != nil {
+			return nil, err
+		}
+	} else if !flags.Server.LegacySignature && serverConfig.LegacySignature {
+		flags.Server.LegacySignature = serverConfig.LegacySignature
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		flags.Server.TLSCertPath = envTLSCert
+	} else if flags.Server.TLSCertPath == "" && serverConfig.TLSCert != "" {
+		flags.Server.TLSCertPath = serverConfig.TLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		flags.Server.TLSKeyPath = envTLSKey
+	} else if flags.Server.TLSKeyPath == "" && serverConfig.TLSKey != "" {
+		flags.Server.TLSKeyPath = serverConfig.TLSKey
+	}
+
+	if envTLSClientCA := os.Getenv("TLS_CLIENT_CA"); envTLSClientCA != "" {
+		flags.Server.TLSClientCAPath = envTLSClientCA
+	} else if flags.Server.TLSClientCAPath == "" && serverConfig.TLSClientCA != "" {
+		flags.Server.TLSClientCAPath = serverConfig.TLSClientCA
+	}
+
+	if (flags.Server.TLSCertPath == "") != (flags.Server.TLSKeyPath == "") {
+		return nil, fmt.Errorf("для HTTPS нужно задать и сертификат (-tls-cert), и ключ (-tls-key)")
+	}
+	if flags.Server.TLSClientCAPath != "" && flags.Server.TLSCertPath == "" {
+		return nil, fmt.Errorf("проверка сертификатов клиентов (-tls-client-ca) возможна только при HTTPS")
+	}
+
 	if envDSN := os.Getenv("DATABASE_DSN"); envDSN != "" {
 		flags.Database.DatabaseDsn = envDSN
 	} else if flags.Database.DatabaseDsn != "" && serverConfig.DatabaseDSN != "" {
@@ -117,10 +324,24 @@ func ParseFlags() (*Flags, error) {
 		flags.PrivateCryptoKey = serverConfig.CryptoKey
 	}
 
+	if envAdminToken := os.Getenv("ADMIN_TOKEN"); envAdminToken != "" {
+		flags.AdminToken = envAdminToken
+	} else if flags.AdminToken == "" && serverConfig.AdminToken != "" {
+		flags.AdminToken = serverConfig.AdminToken
+	}
+
 	return &flags, nil
 
 }
 
+func mustParseDuration(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
 func getJSONConfig(path string) (config models.JSONConfigServer, err error) {
 	if path == "" {
 		return
@@ -2,15 +2,27 @@
 package constants
 
 const (
-	Gauge                        = "gauge"
-	Counter                      = "counter"
-	PollCount                    = "PollCount"
-	RetryCount            int    = 3
-	HeaderSig             string = "HashSHA256"
-	DefaultServerAddress         = "localhost:8080"
-	DefaultStoreInterval  int64  = 300
-	DefaultRestore        bool   = true
-	DefaultStoreFile             = "./metricsStorage.json"
-	DefaultReportInterval int64  = 5
-	DefaultPollInterval   int64  = 2
+	Gauge                           = "gauge"
+	Counter                         = "counter"
+	Histogram                       = "histogram"
+	PollCount                       = "PollCount"
+	RetryCount               int    = 3
+	HeaderSig                string = "HashSHA256"
+	HeaderAgentID            string = "X-Agent-ID"            // идентификатор агента, по которому сервер применяет ограничения запросов
+	HeaderSigTimestamp       string = "X-Signature-Timestamp" // время подписи запроса версии 2 (Unix-время в секундах)
+	HeaderSigNonce           string = "X-Signature-Nonce"     // одноразовое значение подписи запроса версии 2
+	HeaderKeyID              string = "X-Key-ID"              // идентификатор ключа, которым зашифровано тело запроса
+	DefaultServerAddress            = "localhost:8080"
+	DefaultStoreInterval     int64  = 300
+	DefaultRestore           bool   = true
+	DefaultStoreFile                = "./metricsStorage.json"
+	DefaultSnapshotDir              = "./snapshots" // каталог снимков метрик (POST /admin/snapshot)
+	DefaultReportInterval    int64  = 5
+	DefaultPollInterval      int64  = 2
+	DefaultHistorySize       int    = 1000                                                                    // количество точек истории, хранимых в памяти для каждой серии
+	DefaultRetentionInterval int64  = 60                                                                      // интервал применения политик хранения истории в секундах
+	DefaultSignatureSkew            = "5m"                                                                    // допустимое расхождение времени подписи запроса и времени сервера
+	DefaultIdempotencyTTL           = "1h"                                                                    // время хранения ключей Idempotency-Key
+	DefaultAlertInterval            = "15s"                                                                   // интервал проверки правил оповещений по таймеру
+	DefaultGCPauseBuckets           = "10000,50000,100000,500000,1000000,5000000,10000000,50000000,100000000" // границы корзин гистограммы пауз GC в наносекундах
 )
@@ -3,13 +3,24 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
+	"time"
 
+	"metrics/internal/alerting"
 	"metrics/internal/constants"
+	"metrics/internal/histogram"
+	"metrics/internal/history"
+	"metrics/internal/labels"
+	"metrics/internal/listing"
 	"metrics/internal/models"
+	"metrics/internal/pubsub"
+	"metrics/internal/retention"
 	"metrics/internal/storage"
+	"metrics/internal/validation"
 
 	"go.uber.org/zap"
 )
@@ -17,30 +28,122 @@ import (
 type Controller struct {
 	storage storage.Storage
 	logger  *zap.Logger
+	alerts  *alerting.Engine
+	hub     *pubsub.Hub
 }
 
 func NewController(storage storage.Storage, logger *zap.Logger) *Controller {
 	return &Controller{
 		storage: storage,
 		logger:  logger,
+		hub:     pubsub.NewHub(pubsub.DefaultBufferSize),
 	}
 }
 
+// SetAlerting подключает проверку правил оповещений: после каждого успешного обновления метрик
+// запрашивается внеочередная проверка правил.
+func (c *Controller) SetAlerting(engine *alerting.Engine) {
+	c.alerts = engine
+}
+
+// GetAlerts возвращает активные алерты. Если оповещения не настроены, возвращается пустой список.
+func (c *Controller) GetAlerts() []alerting.Alert {
+	if c.alerts == nil {
+		return []alerting.Alert{}
+	}
+	return c.alerts.Alerts()
+}
+
+// Subscribe подписывает на обновления метрик, удовлетворяющих фильтру.
+// Подписку необходимо завершить методом Unsubscribe.
+func (c *Controller) Subscribe(filter pubsub.Filter) *pubsub.Subscription {
+	return c.hub.Subscribe(filter)
+}
+
+func (c *Controller) Unsubscribe(sub *pubsub.Subscription) {
+	c.hub.Unsubscribe(sub)
+}
+
+// metricsUpdated вызывается после успешного обновления метрик: запрашивает проверку правил оповещений
+// и рассылает подписчикам значения обновленных серий. Хранилище возвращает в metrics итоговые значения
+// counter и histogram, поэтому события собираются без повторного чтения; для серии, которая встречается
+// в пакете несколько раз, публикуется последнее значение.
+func (c *Controller) metricsUpdated(metrics ...models.Metrics) {
+	if c.alerts != nil {
+		c.alerts.Trigger()
+	}
+
+	if !c.hub.HasSubscribers() {
+		return
+	}
+
+	now := time.Now()
+	events := make([]pubsub.Event, 0, len(metrics))
+	index := make(map[string]int, len(metrics))
+	for _, metric := range metrics {
+		event := pubsub.Event{
+			Time:    now,
+			Metrics: models.Metrics{ID: metric.ID, MType: metric.MType, Labels: metric.Labels},
+		}
+		switch metric.MType {
+		case constants.Gauge:
+			value := *metric.Value
+			event.Value = &value
+		case constants.Counter:
+			delta := *metric.Delta
+			event.Delta = &delta
+		case constants.Histogram:
+			value := histogram.Clone(*metric.Histogram)
+			event.Histogram = &value
+		}
+
+		key := metric.MType + ":" + labels.SeriesKey(metric.ID, metric.Labels)
+		if i, ok := index[key]; ok {
+			events[i] = event
+			continue
+		}
+		index[key] = len(events)
+		events = append(events, event)
+	}
+	c.hub.Publish(events...)
+}
+
+// ClaimIdempotencyKey резервирует ключ Idempotency-Key (см. пакет idempotency).
+func (c *Controller) ClaimIdempotencyKey(ctx context.Context, key string, notBefore, leaseNotBefore time.Time) (result *models.IdempotencyResult, claimed bool, err error) {
+	return c.storage.ClaimIdempotencyKey(ctx, key, notBefore, leaseNotBefore)
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с ключом Idempotency-Key.
+func (c *Controller) CompleteIdempotencyKey(ctx context.Context, key string, result models.IdempotencyResult) (err error) {
+	return c.storage.CompleteIdempotencyKey(ctx, key, result)
+}
+
+// ReleaseIdempotencyKey снимает резервирование ключа Idempotency-Key после неуспешной обработки запроса.
+func (c *Controller) ReleaseIdempotencyKey(ctx context.Context, key string) (err error) {
+	return c.storage.ReleaseIdempotencyKey(ctx, key)
+}
+
+// ExpireIdempotencyKeys удаляет ключи Idempotency-Key, зарезервированные раньше before.
+func (c *Controller) ExpireIdempotencyKeys(ctx context.Context, before time.Time) (err error) {
+	return c.storage.ExpireIdempotencyKeys(ctx, before)
+}
+
 // ----------------------------------------------------------------------
 //корректноли в качестве параметра из контроллера возвращать statusCode ?
 // ----------------------------------------------------------------------
 
 func (c *Controller) UpdateMetric(ctx context.Context, metric models.Metrics) (statusCode int, err error) {
 
-	if metric.ID == "" {
-		err = fmt.Errorf("ошибка при обновлении (имя метрики не заполнено)")
+	if err = validateMetric(metric); err != nil {
 		c.logger.Error(err.Error())
 		return http.StatusBadRequest, err
 	}
 
+	key := labels.SeriesKey(metric.ID, metric.Labels)
+
 	switch metric.MType {
 	case constants.Gauge:
-		err = c.storage.SetGauge(ctx, metric.ID, *metric.Value)
+		err = c.storage.SetGauge(ctx, key, *metric.Value)
 		if err != nil {
 			err = fmt.Errorf("ошибка при обновлении %s типа %s: %w)", metric.ID, metric.MType, err)
 			c.logger.Error(err.Error())
@@ -48,30 +151,48 @@ func (c *Controller) UpdateMetric(ctx context.Context, metric models.Metrics) (s
 			return statusCode, err
 		}
 	case constants.Counter:
-		err = c.storage.SetCounter(ctx, metric.ID, metric.Delta)
+		err = c.storage.SetCounter(ctx, key, metric.Delta)
 		if err != nil {
 			err = fmt.Errorf("ошибка при обновлении %s типа %s: %w)", metric.ID, metric.MType, err)
 			c.logger.Error(err.Error())
 			statusCode = http.StatusInternalServerError
 			return statusCode, err
 		}
+	case constants.Histogram:
+		err = c.storage.SetHistogram(ctx, key, metric.Histogram)
+		if err != nil {
+			err = fmt.Errorf("ошибка при обновлении %s типа %s: %w)", metric.ID, metric.MType, err)
+			c.logger.Error(err.Error())
+			statusCode = storageStatus(err)
+			return statusCode, err
+		}
 	default:
 		err = fmt.Errorf("ошибка при обновлении %s: тип %s не поддерживается)", metric.ID, metric.MType)
 		c.logger.Error(err.Error())
 		statusCode = http.StatusBadRequest
 		return statusCode, err
 	}
+	c.metricsUpdated(metric)
 	return
 }
 
-func (c *Controller) UpdateMetricFromString(ctx context.Context, mtype string, mname string, mvalue *string) (statusCode int, err error) {
+func (c *Controller) UpdateMetricFromString(ctx context.Context, mtype string, mname string, mlabels map[string]string, mvalue *string) (statusCode int, err error) {
+
+	if err = validation.Name(mname); err != nil {
+		err = fmt.Errorf("ошибка при обновлении: %w", err)
+		c.logger.Error(err.Error())
+		return http.StatusBadRequest, err
+	}
 
-	if mname == "" {
-		err = fmt.Errorf("ошибка при обновлении (имя метрики не заполнено)")
+	if err = labels.Validate(mlabels); err != nil {
+		err = fmt.Errorf("ошибка при обновлении %s: %w", mname, err)
 		c.logger.Error(err.Error())
 		return http.StatusBadRequest, err
 	}
 
+	key := labels.SeriesKey(mname, mlabels)
+	saved := models.Metrics{ID: mname, MType: mtype, Labels: mlabels}
+
 	switch mtype {
 	case constants.Gauge:
 		value, err := strconv.ParseFloat(*mvalue, 64)
@@ -81,13 +202,20 @@ func (c *Controller) UpdateMetricFromString(ctx context.Context, mtype string, m
 			statusCode = http.StatusBadRequest
 			return statusCode, err
 		}
-		err = c.storage.SetGauge(ctx, mname, value)
+		if err = validation.Value(value); err != nil {
+			err = fmt.Errorf("ошибка при обновлении %s типа %s: %w", mname, mtype, err)
+			c.logger.Error(err.Error())
+			statusCode = http.StatusBadRequest
+			return statusCode, err
+		}
+		err = c.storage.SetGauge(ctx, key, value)
 		if err != nil {
 			err = fmt.Errorf("ошибка при обновлении %s типа %s: %w)", mname, mtype, err)
 			c.logger.Error(err.Error())
 			statusCode = http.StatusInternalServerError
 			return statusCode, err
 		}
+		saved.Value = &value
 	case constants.Counter:
 		value, err := strconv.ParseInt(*mvalue, 10, 64)
 		if err != nil {
@@ -96,7 +224,7 @@ func (c *Controller) UpdateMetricFromString(ctx context.Context, mtype string, m
 			statusCode = http.StatusBadRequest
 			return statusCode, err
 		}
-		err = c.storage.SetCounter(ctx, mname, &value)
+		err = c.storage.SetCounter(ctx, key, &value)
 		if err != nil {
 			err = fmt.Errorf("ошибка при обновлении %s типа %s: %w)", mname, mtype, err)
 			c.logger.Error(err.Error())
@@ -104,19 +232,28 @@ func (c *Controller) UpdateMetricFromString(ctx context.Context, mtype string, m
 			return statusCode, err
 		}
 		*mvalue = strconv.FormatInt(value, 10)
+		saved.Delta = &value
+	case constants.Histogram:
+		err = fmt.Errorf("ошибка при обновлении %s: тип %s поддерживается только в формате JSON)", mname, mtype)
+		c.logger.Error(err.Error())
+		statusCode = http.StatusBadRequest
+		return statusCode, err
 	default:
 		err = fmt.Errorf("ошибка при обновлении %s: тип %s не поддерживается)", mname, mtype)
 		c.logger.Error(err.Error())
 		statusCode = http.StatusBadRequest
 		return statusCode, err
 	}
+	c.metricsUpdated(saved)
 	return
 }
 
 func (c *Controller) GetOneMetric(ctx context.Context, metric *models.Metrics) (statusCode int, err error) {
+	key := labels.SeriesKey(metric.ID, metric.Labels)
+
 	switch metric.MType {
 	case constants.Gauge:
-		value, err := c.storage.GetGauge(ctx, metric.ID)
+		value, err := c.storage.GetGauge(ctx, key)
 		if err != nil {
 			err = fmt.Errorf("не удалось получить данные для метрики %s типа %s: %w", metric.ID, metric.MType, err)
 			c.logger.Error(err.Error())
@@ -125,7 +262,7 @@ func (c *Controller) GetOneMetric(ctx context.Context, metric *models.Metrics) (
 		}
 		metric.Value = &value
 	case constants.Counter:
-		delta, err := c.storage.GetCounter(ctx, metric.ID)
+		delta, err := c.storage.GetCounter(ctx, key)
 
 		if err != nil {
 			err = fmt.Errorf("не удалось получить данные для метрики %s типа %s: %w", metric.ID, metric.MType, err)
@@ -134,6 +271,15 @@ func (c *Controller) GetOneMetric(ctx context.Context, metric *models.Metrics) (
 			return statusCode, err
 		}
 		metric.Delta = &delta
+	case constants.Histogram:
+		value, err := c.storage.GetHistogram(ctx, key)
+		if err != nil {
+			err = fmt.Errorf("не удалось получить данные для метрики %s типа %s: %w", metric.ID, metric.MType, err)
+			c.logger.Error(err.Error())
+			statusCode = http.StatusNotFound
+			return statusCode, err
+		}
+		metric.Histogram = &value
 	case "":
 		err = fmt.Errorf("ошибка при получении метрики %s: тип обязателем для заполнения)", metric.ID)
 		c.logger.Error(err.Error())
@@ -148,12 +294,236 @@ func (c *Controller) GetOneMetric(ctx context.Context, metric *models.Metrics) (
 	return
 }
 
+// ListMetrics возвращает страницу списка метрик, удовлетворяющих запросу, и общее количество таких метрик.
+func (c *Controller) ListMetrics(ctx context.Context, query *listing.Query) (metrics []models.Metrics, total int, statusCode int, err error) {
+	if err = query.Validate(); err != nil {
+		err = fmt.Errorf("ошибка в параметрах списка метрик: %w", err)
+		c.logger.Error(err.Error())
+		return nil, 0, http.StatusBadRequest, err
+	}
+
+	metrics, total, err = c.storage.ListMetrics(ctx, query)
+	if err != nil {
+		err = fmt.Errorf("не удалось получить список метрик: %w", err)
+		c.logger.Error(err.Error())
+		return nil, 0, http.StatusInternalServerError, err
+	}
+
+	return metrics, total, http.StatusOK, nil
+}
+
+// DeleteMetric удаляет серию вместе с ее историей.
+func (c *Controller) DeleteMetric(ctx context.Context, mtype string, mname string, mlabels map[string]string) (statusCode int, err error) {
+	if statusCode, err = c.validateSeries(mtype, mname, mlabels); err != nil {
+		return statusCode, err
+	}
+
+	if err = c.storage.DeleteMetric(ctx, mtype, labels.SeriesKey(mname, mlabels)); err != nil {
+		err = fmt.Errorf("ошибка при удалении %s типа %s: %w", mname, mtype, err)
+		c.logger.Error(err.Error())
+		return storageStatus(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// DeleteMetrics удаляет все серии, имена которых соответствуют шаблону glob.
+// Если mtype не пустой, удаляются только серии этого типа.
+func (c *Controller) DeleteMetrics(ctx context.Context, mtype string, pattern string) (deleted int, statusCode int, err error) {
+	switch {
+	case pattern == "":
+		err = fmt.Errorf("ошибка при удалении метрик: шаблон не заполнен")
+	case mtype != "" && mtype != constants.Gauge && mtype != constants.Counter && mtype != constants.Histogram:
+		err = fmt.Errorf("ошибка при удалении метрик: тип %s не поддерживается", mtype)
+	default:
+		if _, err = regexp.Compile(listing.GlobToRegexp(pattern)); err != nil {
+			err = fmt.Errorf("ошибка при удалении метрик: неверный шаблон %q", pattern)
+		}
+	}
+	if err != nil {
+		c.logger.Error(err.Error())
+		return 0, http.StatusBadRequest, err
+	}
+
+	deleted, err = c.storage.DeleteMetrics(ctx, mtype, pattern)
+	if err != nil {
+		err = fmt.Errorf("ошибка при удалении метрик %s: %w", pattern, err)
+		c.logger.Error(err.Error())
+		return 0, http.StatusInternalServerError, err
+	}
+	return deleted, http.StatusOK, nil
+}
+
+// ResetCounter обнуляет значение counter.
+func (c *Controller) ResetCounter(ctx context.Context, mname string, mlabels map[string]string) (statusCode int, err error) {
+	if statusCode, err = c.validateSeries(constants.Counter, mname, mlabels); err != nil {
+		return statusCode, err
+	}
+
+	if err = c.storage.ResetCounter(ctx, labels.SeriesKey(mname, mlabels)); err != nil {
+		err = fmt.Errorf("ошибка при сбросе %s: %w", mname, err)
+		c.logger.Error(err.Error())
+		return storageStatus(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// RenameMetric переименовывает серию, сохраняя ее метки и историю.
+func (c *Controller) RenameMetric(ctx context.Context, mtype string, mname string, mlabels map[string]string, newName string) (statusCode int, err error) {
+	if statusCode, err = c.validateSeries(mtype, mname, mlabels); err != nil {
+		return statusCode, err
+	}
+	if err = validation.Name(newName); err != nil {
+		err = fmt.Errorf("ошибка при переименовании %s: %w", mname, err)
+		c.logger.Error(err.Error())
+		return http.StatusBadRequest, err
+	}
+
+	err = c.storage.RenameMetric(ctx, mtype, labels.SeriesKey(mname, mlabels), labels.SeriesKey(newName, mlabels))
+	if err != nil {
+		err = fmt.Errorf("ошибка при переименовании %s типа %s: %w", mname, mtype, err)
+		c.logger.Error(err.Error())
+		return storageStatus(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// GetAllMetricsInJSON возвращает все метрики в том виде, в котором они сохраняются в файл.
+func (c *Controller) GetAllMetricsInJSON() []models.Metrics {
+	return c.storage.GetAllMetricsInJSON()
+}
+
+func (c *Controller) validateSeries(mtype string, mname string, mlabels map[string]string) (statusCode int, err error) {
+	switch {
+	case mname == "":
+		err = fmt.Errorf("имя метрики не заполнено")
+	case mtype != constants.Gauge && mtype != constants.Counter && mtype != constants.Histogram:
+		err = fmt.Errorf("тип %s метрики %s не поддерживается", mtype, mname)
+	default:
+		err = labels.Validate(mlabels)
+	}
+	if err != nil {
+		c.logger.Error(err.Error())
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// storageStatus возвращает код ответа для ошибки хранилища.
+func storageStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrMetricNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrMetricExists):
+		return http.StatusConflict
+	case errors.Is(err, histogram.ErrBoundsMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetRange возвращает историю значений серии за интервал [from, to].
+// Если step больше нуля, то для каждого отрезка длиной step возвращается последнее значение.
+// История хранится только для метрик типа gauge и counter.
+func (c *Controller) GetRange(ctx context.Context, mtype string, mname string, mlabels map[string]string, from, to time.Time, step time.Duration) (points []models.Point, statusCode int, err error) {
+	switch {
+	case mname == "":
+		err = fmt.Errorf("ошибка при получении истории (имя метрики не заполнено)")
+	case mtype != constants.Gauge && mtype != constants.Counter:
+		err = fmt.Errorf("ошибка при получении истории %s: тип %s не поддерживается)", mname, mtype)
+	case to.Before(from):
+		err = fmt.Errorf("ошибка при получении истории %s: начало интервала позже окончания", mname)
+	case step < 0:
+		err = fmt.Errorf("ошибка при получении истории %s: шаг не может быть отрицательным", mname)
+	default:
+		err = labels.Validate(mlabels)
+	}
+	if err != nil {
+		c.logger.Error(err.Error())
+		return nil, http.StatusBadRequest, err
+	}
+
+	points, err = c.storage.GetRange(ctx, mtype, labels.SeriesKey(mname, mlabels), from, to)
+	if err != nil {
+		err = fmt.Errorf("не удалось получить историю метрики %s типа %s: %w", mname, mtype, err)
+		c.logger.Error(err.Error())
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return history.Downsample(points, from, step), http.StatusOK, nil
+}
+
+// GetRanges возвращает исходные точки истории серий keys типа mtype за интервал [from, to] одним обращением к хранилищу.
+func (c *Controller) GetRanges(ctx context.Context, mtype string, keys []string, from, to time.Time) (points map[string][]models.Point, err error) {
+	switch {
+	case mtype != constants.Gauge && mtype != constants.Counter:
+		err = fmt.Errorf("ошибка при получении истории: тип %s не поддерживается)", mtype)
+	case to.Before(from):
+		err = fmt.Errorf("ошибка при получении истории: начало интервала позже окончания")
+	}
+	if err != nil {
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+
+	points, err = c.storage.GetRanges(ctx, mtype, keys, from, to)
+	if err != nil {
+		err = fmt.Errorf("не удалось получить историю метрик типа %s: %w", mtype, err)
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+	return points, nil
+}
+
+// GetAggregates возвращает минутные или часовые агрегаты истории серии за интервал [from, to].
+// Агрегаты формируются политиками хранения (см. ApplyRetention).
+func (c *Controller) GetAggregates(ctx context.Context, mtype string, mname string, mlabels map[string]string, resolution time.Duration, from, to time.Time) (aggregates []models.Aggregate, statusCode int, err error) {
+	switch {
+	case mname == "":
+		err = fmt.Errorf("ошибка при получении истории (имя метрики не заполнено)")
+	case mtype != constants.Gauge && mtype != constants.Counter:
+		err = fmt.Errorf("ошибка при получении истории %s: тип %s не поддерживается)", mname, mtype)
+	case resolution != retention.Minute && resolution != retention.Hour:
+		err = fmt.Errorf("ошибка при получении истории %s: разрешение %s не поддерживается", mname, resolution)
+	case to.Before(from):
+		err = fmt.Errorf("ошибка при получении истории %s: начало интервала позже окончания", mname)
+	default:
+		err = labels.Validate(mlabels)
+	}
+	if err != nil {
+		c.logger.Error(err.Error())
+		return nil, http.StatusBadRequest, err
+	}
+
+	aggregates, err = c.storage.GetAggregates(ctx, mtype, labels.SeriesKey(mname, mlabels), resolution, from, to)
+	if err != nil {
+		err = fmt.Errorf("не удалось получить агрегаты метрики %s типа %s: %w", mname, mtype, err)
+		c.logger.Error(err.Error())
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return aggregates, http.StatusOK, nil
+}
+
+// ApplyRetention применяет политики хранения к истории метрик в хранилище.
+func (c *Controller) ApplyRetention(ctx context.Context, policies retention.Policies) (err error) {
+	err = c.storage.ApplyRetention(ctx, policies, time.Now())
+	if err != nil {
+		err = fmt.Errorf("ошибка при применении политик хранения: %w", err)
+		c.logger.Error(err.Error())
+	}
+	return
+}
+
 func (c *Controller) GetAllGauge(ctx context.Context) map[string]float64 {
 	return c.storage.GetAllGauge(ctx)
 }
 func (c *Controller) GetAllCounter(ctx context.Context) map[string]int64 {
 	return c.storage.GetAllCounter(ctx)
 }
+func (c *Controller) GetAllHistogram(ctx context.Context) map[string]models.Histogram {
+	return c.storage.GetAllHistogram(ctx)
+}
 
 func (c *Controller) CheckConnection(ctx context.Context) (err error) {
 	err = c.storage.CheckConnection(ctx)
@@ -163,34 +533,89 @@ func (c *Controller) CheckConnection(ctx context.Context) (err error) {
 	return
 }
 
+// SaveMetrics в одной транзакции обновляет метрики: gauge заменяются, counter и histogram накапливаются.
 func (c *Controller) SaveMetrics(ctx context.Context, metrics []models.Metrics) (statusCode int, err error) {
+	return c.saveMetrics(ctx, metrics, c.storage.SaveMetrics)
+}
+
+// ReplaceMetrics в одной транзакции заменяет значения всех метрик хранилища на metrics.
+// Метрики, отсутствующие в metrics, удаляются, история серий сохраняется.
+func (c *Controller) ReplaceMetrics(ctx context.Context, metrics []models.Metrics) (statusCode int, err error) {
+	return c.saveMetrics(ctx, metrics, c.storage.ReplaceMetrics)
+}
+
+// WalkMetrics вызывает fn для каждой метрики хранилища в порядке возрастания имен и меток.
+func (c *Controller) WalkMetrics(ctx context.Context, fn func(metric models.Metrics) error) (err error) {
+	return c.storage.WalkMetrics(ctx, fn)
+}
+
+func (c *Controller) saveMetrics(ctx context.Context, metrics []models.Metrics, save func(ctx context.Context, metrics []models.Metrics) error) (statusCode int, err error) {
 	for _, metric := range metrics {
-		if metric.ID == "" {
-			err = fmt.Errorf("ошибка при обновлении (имя метрики типа %s не заполнено)", metric.MType)
-			c.logger.Error(err.Error())
-			statusCode = http.StatusBadRequest
-			return statusCode, err
-		}
-		switch metric.MType {
-		case "":
-			err = fmt.Errorf("ошибка при обновлении (тип метрики %s не заполнен)", metric.ID)
-			c.logger.Error(err.Error())
-			statusCode = http.StatusBadRequest
-			return statusCode, err
-		case constants.Counter:
-		case constants.Gauge:
-		default:
-			err = fmt.Errorf("ошибка при получении метрики %s: тип %s не поддерживается)", metric.ID, metric.MType)
+		if err = validateMetric(metric); err != nil {
 			c.logger.Error(err.Error())
 			statusCode = http.StatusBadRequest
 			return statusCode, err
 		}
 	}
-	err = c.storage.SaveMetrics(ctx, metrics)
+	err = save(ctx, metrics)
 	if err != nil {
 		c.logger.Error(err.Error())
-		statusCode = http.StatusInternalServerError
+		statusCode = storageStatus(err)
 		return statusCode, err
 	}
+	c.metricsUpdated(metrics...)
+	return
+}
+
+// UpdateMetrics сохраняет пакет метрик и возвращает результат обработки каждой метрики.
+// В режиме models.UpdateModeAtomic пакет с хотя бы одной некорректной метрикой не сохраняется,
+// корректные метрики такого пакета получают статус models.UpdateStatusSkipped.
+// В режиме models.UpdateModeBestEffort сохраняются корректные метрики, а код 400 возвращается,
+// только если не сохранено ни одной метрики.
+func (c *Controller) UpdateMetrics(ctx context.Context, metrics []models.Metrics, mode string) (response models.UpdatesResponse, statusCode int, err error) {
+	response = models.UpdatesResponse{Mode: mode, Results: make([]models.UpdateResult, len(metrics))}
+	valid := make([]models.Metrics, 0, len(metrics))
+
+	for i, metric := range metrics {
+		response.Results[i] = models.UpdateResult{ID: metric.ID, MType: metric.MType, Status: models.UpdateStatusOK}
+		if err := validateMetric(metric); err != nil {
+			response.Results[i].Status = models.UpdateStatusRejected
+			response.Results[i].Error = err.Error()
+			response.Rejected++
+			continue
+		}
+		valid = append(valid, metric)
+	}
+
+	if response.Rejected > 0 && (mode != models.UpdateModeBestEffort || len(valid) == 0) {
+		for i := range response.Results {
+			if response.Results[i].Status == models.UpdateStatusOK {
+				response.Results[i].Status = models.UpdateStatusSkipped
+			}
+		}
+		err = fmt.Errorf("ошибка при обновлении: %d из %d метрик не прошли проверку", response.Rejected, len(metrics))
+		c.logger.Error(err.Error())
+		statusCode = http.StatusBadRequest
+		return response, statusCode, err
+	}
+
+	if err = c.storage.SaveMetrics(ctx, valid); err != nil {
+		c.logger.Error(err.Error())
+		statusCode = storageStatus(err)
+		return response, statusCode, err
+	}
+	response.Applied = len(valid)
+	c.metricsUpdated(valid...)
 	return
 }
+
+// validateMetric проверяет метрику перед сохранением (см. validation.Metric).
+func validateMetric(metric models.Metrics) error {
+	if err := validation.Metric(metric); err != nil {
+		if metric.ID == "" {
+			return fmt.Errorf("ошибка при обновлении: %w", err)
+		}
+		return fmt.Errorf("ошибка при обновлении %s: %w", metric.ID, err)
+	}
+	return nil
+}
@@ -22,7 +22,8 @@ func Decrypte(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
 
 }
 
-func getPublicKey(path string) (*rsa.PublicKey, error) {
+// LoadPublicKey читает публичный ключ RSA из сертификата в формате PEM.
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -48,10 +49,32 @@ func getPublicKey(path string) (*rsa.PublicKey, error) {
 }
 
 func EncrypteBody(data []byte, path string) ([]byte, error) {
-	publicKey, err := getPublicKey(path)
+	publicKey, err := LoadPublicKey(path)
 	if err != nil {
 		return nil, err
 	}
 
 	return Encrypte(publicKey, data)
 }
+
+// LoadPrivateKey читает приватный ключ RSA в формате PEM (PKCS #1).
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("неверный формат приватного ключа")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func DecrypteBody(data []byte, path string) ([]byte, error) {
+	privateKey, err := LoadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decrypte(privateKey, data)
+}
@@ -0,0 +1,111 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// EnvelopeVersion - версия формата конверта, записывается в первый байт.
+const EnvelopeVersion byte = 1
+
+// Значения заголовка Content-Encrypted.
+const (
+	ModeLegacy   = "true"     // тело целиком зашифровано RSA-OAEP, размер ограничен длиной ключа
+	ModeEnvelope = "envelope" // тело упаковано в конверт (см. SealEnvelope)
+)
+
+const envelopeKeySize = 32 // AES-256
+
+// SealEnvelope шифрует data случайным ключом AES-256-GCM, а сам ключ - публичным ключом RSA-OAEP.
+// Формат конверта:
+//
+//	версия (1 байт) | длина зашифрованного ключа (2 байта, big-endian) | зашифрованный ключ | nonce GCM | шифротекст с тегом
+//
+// В отличие от Encrypte размер data не ограничен длиной ключа RSA.
+func SealEnvelope(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
+	key := make([]byte, envelopeKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при шифровании ключа: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, 0, 3+len(wrappedKey)+len(nonce)+len(data)+gcm.Overhead())
+	envelope = append(envelope, EnvelopeVersion)
+	envelope = binary.BigEndian.AppendUint16(envelope, uint16(len(wrappedKey)))
+	envelope = append(envelope, wrappedKey...)
+	envelope = append(envelope, nonce...)
+	// Заголовок конверта передается как дополнительные данные, чтобы его нельзя было подменить.
+	return gcm.Seal(envelope, nonce, data, envelope[:3+len(wrappedKey)]), nil
+}
+
+// OpenEnvelope расшифровывает конверт, созданный SealEnvelope.
+func OpenEnvelope(privateKey *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	if len(envelope) < 3 {
+		return nil, fmt.Errorf("конверт слишком короткий")
+	}
+	if envelope[0] != EnvelopeVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия конверта: %d", envelope[0])
+	}
+
+	keyEnd := 3 + int(binary.BigEndian.Uint16(envelope[1:3]))
+	if len(envelope) < keyEnd {
+		return nil, fmt.Errorf("конверт слишком короткий")
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, envelope[3:keyEnd], nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при расшифровке ключа: %w", err)
+	}
+	if len(key) != envelopeKeySize {
+		return nil, fmt.Errorf("неверная длина ключа: %d", len(key))
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope) < keyEnd+gcm.NonceSize() {
+		return nil, fmt.Errorf("конверт слишком короткий")
+	}
+	nonce := envelope[keyEnd : keyEnd+gcm.NonceSize()]
+
+	return gcm.Open(nil, nonce, envelope[keyEnd+gcm.NonceSize():], envelope[:keyEnd])
+}
+
+// Decrypt расшифровывает тело в зависимости от значения заголовка Content-Encrypted.
+func Decrypt(privateKey *rsa.PrivateKey, mode string, data []byte) ([]byte, error) {
+	switch mode {
+	case ModeEnvelope:
+		return OpenEnvelope(privateKey, data)
+	case ModeLegacy:
+		return Decrypte(privateKey, data)
+	default:
+		return nil, fmt.Errorf("неизвестный режим шифрования: %s", mode)
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,46 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// Тело намного больше, чем позволяет RSA-OAEP для ключа 2048 бит.
+	data := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 10000)
+
+	envelope, err := SealEnvelope(&privateKey.PublicKey, data)
+	require.NoError(t, err)
+	assert.Equal(t, EnvelopeVersion, envelope[0])
+
+	decrypted, err := Decrypt(privateKey, ModeEnvelope, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+
+	tampered := bytes.Clone(envelope)
+	tampered[len(tampered)-1] ^= 1
+	_, err = OpenEnvelope(privateKey, tampered)
+	assert.Error(t, err)
+
+	tampered = bytes.Clone(envelope)
+	tampered[0] = 2
+	_, err = OpenEnvelope(privateKey, tampered)
+	assert.Error(t, err)
+
+	_, err = OpenEnvelope(privateKey, envelope[:10])
+	assert.Error(t, err)
+
+	legacy, err := Encrypte(&privateKey.PublicKey, []byte("small"))
+	require.NoError(t, err)
+	decrypted, err = Decrypt(privateKey, ModeLegacy, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("small"), decrypted)
+}
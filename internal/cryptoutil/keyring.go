@@ -0,0 +1,147 @@
+package cryptoutil
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownKey - в наборе нет ключа с переданным идентификатором.
+var ErrUnknownKey = errors.New("неизвестный ключ")
+
+// KeyID возвращает идентификатор ключа - SHA-256 от публичного ключа в формате PKIX (DER) в шестнадцатеричном виде.
+func KeyID(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// KeyRing - набор приватных ключей сервера, по которым расшифровываются запросы.
+// Наличие нескольких ключей позволяет заменять ключи агентов постепенно, без остановки сервера.
+type KeyRing struct {
+	mu    sync.RWMutex
+	paths []string
+	ids   []string
+	keys  map[string]*rsa.PrivateKey
+}
+
+// NewKeyRing загружает ключи из paths. Каждый путь - файл с приватным ключом
+// или каталог, из которого загружаются все файлы *.pem с приватными ключами.
+func NewKeyRing(paths ...string) (*KeyRing, error) {
+	k := &KeyRing{paths: paths, keys: map[string]*rsa.PrivateKey{}}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload заново читает ключи с диска. При ошибке прежний набор ключей сохраняется.
+func (k *KeyRing) Reload() error {
+	var ids []string
+	keys := map[string]*rsa.PrivateKey{}
+
+	add := func(path string) error {
+		privateKey, err := LoadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("ошибка при загрузке ключа %s: %w", path, err)
+		}
+		id, err := KeyID(&privateKey.PublicKey)
+		if err != nil {
+			return fmt.Errorf("ошибка при загрузке ключа %s: %w", path, err)
+		}
+		if _, ok := keys[id]; !ok {
+			ids = append(ids, id)
+			keys[id] = privateKey
+		}
+		return nil
+	}
+
+	for _, path := range k.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("ошибка при загрузке ключа %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			if err = add(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(path, "*.pem"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			// В каталоге могут лежать и сертификаты, загружаются только приватные ключи.
+			if !isPrivateKeyFile(file) {
+				continue
+			}
+			if err = add(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.ids = ids
+	k.keys = keys
+	return nil
+}
+
+// IDs возвращает идентификаторы загруженных ключей в порядке загрузки.
+func (k *KeyRing) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]string(nil), k.ids...)
+}
+
+// Decrypt расшифровывает data ключом keyID. Если keyID не задан (агент прежней версии),
+// по очереди пробуются все ключи.
+func (k *KeyRing) Decrypt(keyID, mode string, data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.ids) == 0 {
+		return nil, fmt.Errorf("приватные ключи не загружены")
+	}
+
+	if keyID != "" {
+		privateKey, ok := k.keys[keyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+		}
+		return Decrypt(privateKey, mode, data)
+	}
+
+	var err error
+	for _, id := range k.ids {
+		var decrypted []byte
+		if decrypted, err = Decrypt(k.keys[id], mode, data); err == nil {
+			return decrypted, nil
+		}
+	}
+	return nil, err
+}
+
+func isPrivateKeyFile(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == "RSA PRIVATE KEY"
+}
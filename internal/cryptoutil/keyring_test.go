@@ -0,0 +1,64 @@
+package cryptoutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, path string) *rsa.PrivateKey {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return privateKey
+}
+
+func TestKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeKey(t, filepath.Join(dir, "a.pem"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), 0600))
+
+	keys, err := NewKeyRing(dir)
+	require.NoError(t, err)
+	oldID, err := KeyID(&oldKey.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldID}, keys.IDs())
+
+	newKey := writeKey(t, filepath.Join(dir, "b.pem"))
+	newID, err := KeyID(&newKey.PublicKey)
+	require.NoError(t, err)
+
+	envelope, err := SealEnvelope(&newKey.PublicKey, []byte("data"))
+	require.NoError(t, err)
+	_, err = keys.Decrypt(newID, ModeEnvelope, envelope)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	require.NoError(t, keys.Reload())
+	assert.Equal(t, []string{oldID, newID}, keys.IDs())
+
+	decrypted, err := keys.Decrypt(newID, ModeEnvelope, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+
+	// Без идентификатора пробуются все ключи.
+	decrypted, err = keys.Decrypt("", ModeEnvelope, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+
+	_, err = keys.Decrypt(oldID, ModeEnvelope, envelope)
+	assert.Error(t, err)
+
+	// Ошибка при перезагрузке не меняет загруженные ключи.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.pem"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{1}}), 0600))
+	assert.Error(t, keys.Reload())
+	assert.Equal(t, []string{oldID, newID}, keys.IDs())
+}
@@ -0,0 +1,140 @@
+// В пакете dashboard реализована HTML-страница со всеми метриками (эндпоинт GET /).
+//
+// Шаблон страницы встроен в исполняемый файл (embed.FS), поэтому сервер можно запускать из любого каталога.
+// Страница поддерживает поиск, сортировку, группировку по префиксу имени и автообновление,
+// для gauge и counter выводится время последнего обновления и график изменения значения (sparkline).
+package dashboard
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+// Размер графика в пикселях.
+const (
+	SparklineWidth  = 120
+	SparklineHeight = 24
+)
+
+//go:embed dashboard.html
+var files embed.FS
+
+var tmpl = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"sparklineWidth":  func() int { return SparklineWidth },
+	"sparklineHeight": func() int { return SparklineHeight },
+}).ParseFS(files, "dashboard.html"))
+
+// Series - строка таблицы метрик.
+type Series struct {
+	Key       string // идентификатор серии: имя и метки
+	Name      string
+	Labels    string // метки в формате name="value",...
+	Group     string // префикс имени, по которому группируются серии
+	Type      string
+	Value     string
+	Number    float64   // значение для сортировки
+	Updated   time.Time // время последнего обновления, если известна история
+	Sparkline string    // координаты ломаной для SVG polyline, если история содержит больше одной точки
+}
+
+// Page - данные страницы.
+type Page struct {
+	Series    []Series
+	Generated time.Time
+	Refresh   int // интервал автообновления по умолчанию в секундах
+}
+
+// NewSeries формирует строку таблицы. points - история серии, упорядоченная по времени (может быть пустой).
+func NewSeries(key string, mtype string, value string, number float64, points []models.Point) Series {
+	name, seriesLabels := labels.SplitSeriesKey(key)
+	series := Series{
+		Key:       key,
+		Name:      name,
+		Labels:    labels.Format(seriesLabels),
+		Group:     Group(name),
+		Type:      mtype,
+		Value:     value,
+		Number:    number,
+		Sparkline: Sparkline(points, SparklineWidth, SparklineHeight),
+	}
+	if len(points) > 0 {
+		series.Updated = points[len(points)-1].Time
+	}
+	return series
+}
+
+// FormatFloat форматирует значение gauge так же, как эндпоинт GET /value/.
+func FormatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Render выводит страницу. Серии упорядочиваются по имени и типу.
+func Render(w io.Writer, page Page) error {
+	sort.Slice(page.Series, func(i, j int) bool {
+		if page.Series[i].Key != page.Series[j].Key {
+			return page.Series[i].Key < page.Series[j].Key
+		}
+		return page.Series[i].Type < page.Series[j].Type
+	})
+	return tmpl.Execute(w, page)
+}
+
+// Group возвращает префикс имени метрики: часть имени до первого разделителя (. _ : -),
+// а если разделителей нет - первое слово имени в CamelCase (HeapAlloc -> Heap, PollCount -> Poll).
+func Group(name string) string {
+	if i := strings.IndexAny(name, "._:-"); i > 0 {
+		return name[:i]
+	}
+	runes := []rune(name)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1]) {
+			return string(runes[:i])
+		}
+	}
+	return name
+}
+
+// Sparkline возвращает координаты ломаной графика размером width x height для SVG polyline.
+// Если точек меньше двух, возвращается пустая строка.
+func Sparkline(points []models.Point, width, height int) string {
+	if len(points) < 2 {
+		return ""
+	}
+
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		minValue = math.Min(minValue, point.Value)
+		maxValue = math.Max(maxValue, point.Value)
+	}
+	start, end := points[0].Time, points[len(points)-1].Time
+	duration := end.Sub(start).Seconds()
+
+	var sb strings.Builder
+	for i, point := range points {
+		x := float64(width) * float64(i) / float64(len(points)-1)
+		if duration > 0 {
+			x = float64(width) * point.Time.Sub(start).Seconds() / duration
+		}
+		y := float64(height) / 2
+		if maxValue > minValue {
+			y = float64(height) * (maxValue - point.Value) / (maxValue - minValue)
+		}
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(strconv.FormatFloat(x, 'f', 1, 64))
+		sb.WriteByte(',')
+		sb.WriteString(strconv.FormatFloat(y, 'f', 1, 64))
+	}
+	return sb.String()
+}
@@ -0,0 +1,57 @@
+package dashboard
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	for name, want := range map[string]string{
+		"HeapAlloc":      "Heap",
+		"PollCount":      "Poll",
+		"GCSys":          "GCSys",
+		"CPUutilization": "CPUutilization",
+		"http_requests":  "http",
+		"db.query.time":  "db",
+	} {
+		assert.Equal(t, want, Group(name), name)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	points := []models.Point{
+		{Time: start, Value: 1},
+		{Time: start.Add(time.Minute), Value: 3},
+		{Time: start.Add(2 * time.Minute), Value: 2},
+	}
+	assert.Equal(t, "0.0,10.0 50.0,0.0 100.0,5.0", Sparkline(points, 100, 10))
+	assert.Equal(t, "", Sparkline(points[:1], 100, 10))
+}
+
+func TestRender(t *testing.T) {
+	updated := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	points := []models.Point{{Time: updated.Add(-time.Minute), Value: 1}, {Time: updated, Value: 2}}
+
+	var buf bytes.Buffer
+	require.NoError(t, Render(&buf, Page{
+		Series: []Series{
+			NewSeries(`PollCount{host="a<b"}`, "counter", "2", 2, points),
+			NewSeries("Alloc", "gauge", "1.5", 1.5, nil),
+		},
+		Generated: updated,
+		Refresh:   10,
+	}))
+
+	html := buf.String()
+	assert.Contains(t, html, `data-key="PollCount{host=&#34;a&lt;b&#34;}"`)
+	assert.Contains(t, html, `<polyline points="0.0,24.0 120.0,0.0"/>`)
+	assert.Contains(t, html, `data-updated="1704110400000"`)
+	assert.Less(t, bytes.Index(buf.Bytes(), []byte(`data-key="Alloc"`)), bytes.Index(buf.Bytes(), []byte(`data-key="PollCount`)))
+}
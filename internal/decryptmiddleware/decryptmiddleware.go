@@ -2,15 +2,12 @@ package decryptmiddleware
 
 import (
 	"bytes"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
+	"errors"
 	"io"
 	"metrics/internal/config"
+	"metrics/internal/constants"
 	"metrics/internal/cryptoutil"
 	"net/http"
-	"os"
 	"strings"
 
 	"go.uber.org/zap"
@@ -18,26 +15,32 @@ import (
 
 type DecryptMiddleware struct {
 	config *config.Config
+	keys   *cryptoutil.KeyRing
 	logger *zap.Logger
 }
 
-func NewDecrypteMW(cfg *config.Config, logger *zap.Logger) *DecryptMiddleware {
+// NewDecrypteMW создает middleware, расшифровывающее запросы ключами из keys.
+// keys может быть nil, если приватные ключи не заданы.
+func NewDecrypteMW(cfg *config.Config, keys *cryptoutil.KeyRing, logger *zap.Logger) *DecryptMiddleware {
 	return &DecryptMiddleware{
 		config: cfg,
+		keys:   keys,
 		logger: logger,
 	}
 }
 
+// Decrypte расшифровывает тело запроса, если передан заголовок Content-Encrypted.
+// Значение envelope означает конверт RSA-OAEP + AES-256-GCM (cryptoutil.SealEnvelope),
+// значение true - тело, целиком зашифрованное RSA-OAEP (прежний формат).
+// Ключ выбирается по заголовку X-Key-ID, без него по очереди пробуются все ключи набора.
 func (dmw *DecryptMiddleware) Decrypte(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ow := w
 
-		if strings.Contains(r.Header.Get("Content-Encrypted"), "true") {
+		if mode := encryptionMode(r.Header.Get("Content-Encrypted")); mode != "" {
 
-			privateKey, err := getPrivateKey(dmw.config.PrivateKeyPath)
-			if err != nil {
-				http.Error(w, "Ошибка загрузки приватного ключа", http.StatusBadRequest)
-				w.WriteHeader(http.StatusInternalServerError)
+			if dmw.keys == nil {
+				http.Error(w, "Ошибка загрузки приватного ключа", http.StatusInternalServerError)
 				return
 			}
 
@@ -48,8 +51,13 @@ func (dmw *DecryptMiddleware) Decrypte(h http.HandlerFunc) http.HandlerFunc {
 			}
 			defer r.Body.Close()
 
-			decrypted, err := cryptoutil.Decrypte(privateKey, encryptedData)
+			decrypted, err := dmw.keys.Decrypt(r.Header.Get(constants.HeaderKeyID), mode, encryptedData)
 			if err != nil {
+				dmw.logger.Warn("ошибка дешифровки: " + err.Error())
+				if errors.Is(err, cryptoutil.ErrUnknownKey) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
 				http.Error(w, "Ошибка дешифровки", http.StatusInternalServerError)
 				return
 			}
@@ -62,15 +70,15 @@ func (dmw *DecryptMiddleware) Decrypte(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func getPrivateKey(path string) (*rsa.PrivateKey, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	block, _ := pem.Decode(data)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, fmt.Errorf("неверный формат приватного ключа")
+// encryptionMode возвращает режим шифрования по значению заголовка Content-Encrypted
+// или пустую строку, если тело не зашифровано.
+func encryptionMode(header string) string {
+	switch {
+	case strings.EqualFold(strings.TrimSpace(header), cryptoutil.ModeEnvelope):
+		return cryptoutil.ModeEnvelope
+	case strings.Contains(header, cryptoutil.ModeLegacy):
+		return cryptoutil.ModeLegacy
+	default:
+		return ""
 	}
-	return x509.ParsePKCS1PrivateKey(block.Bytes)
-
 }
@@ -0,0 +1,228 @@
+// Пакет exchange реализует форматы выгрузки и загрузки метрик (эндпоинты GET /api/v1/export и POST /api/v1/import).
+//
+// Поддерживаются форматы:
+//   - csv - строка заголовка id,type,labels,value,delta,histogram и по строке на серию;
+//     метки записываются в виде name="value",..., гистограмма - в формате JSON;
+//   - ndjson - по объекту JSON (как в POST /updates/) на строку.
+//
+// Для counter выгружается накопленное значение в поле delta.
+package exchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"metrics/internal/constants"
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+// Поддерживаемые форматы.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Режимы загрузки.
+const (
+	ModeMerge   = "merge"   // метрики обновляются так же, как в POST /updates/
+	ModeReplace = "replace" // значения всех метрик заменяются загруженными
+)
+
+var csvHeader = []string{"id", "type", "labels", "value", "delta", "histogram"}
+
+// ContentType возвращает значение заголовка Content-Type для формата.
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// FormatFromContentType определяет формат по заголовку Content-Type. Если формат не определен, возвращается "".
+func FormatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return FormatCSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"), strings.HasPrefix(contentType, "application/ndjson"):
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// Validate проверяет, что формат поддерживается.
+func Validate(format string) error {
+	if format != FormatCSV && format != FormatNDJSON {
+		return fmt.Errorf("формат %q не поддерживается, допустимые значения: csv, ndjson", format)
+	}
+	return nil
+}
+
+// Writer последовательно записывает метрики в выбранном формате.
+type Writer struct {
+	format string
+	csv    *csv.Writer
+	json   *json.Encoder
+	buf    *bufio.Writer
+}
+
+// NewWriter создает Writer. Для формата csv сразу записывается строка заголовка.
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	if err := Validate(format); err != nil {
+		return nil, err
+	}
+
+	writer := &Writer{format: format}
+	if format == FormatCSV {
+		writer.csv = csv.NewWriter(w)
+		if err := writer.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+	} else {
+		writer.buf = bufio.NewWriter(w)
+		writer.json = json.NewEncoder(writer.buf)
+	}
+	return writer, nil
+}
+
+// Write записывает метрику.
+func (w *Writer) Write(metric models.Metrics) error {
+	if w.format == FormatNDJSON {
+		return w.json.Encode(metric)
+	}
+
+	record := []string{metric.ID, metric.MType, labels.Format(metric.Labels), "", "", ""}
+	if metric.Value != nil {
+		record[3] = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+	}
+	if metric.Delta != nil {
+		record[4] = strconv.FormatInt(*metric.Delta, 10)
+	}
+	if metric.Histogram != nil {
+		data, err := json.Marshal(metric.Histogram)
+		if err != nil {
+			return err
+		}
+		record[5] = string(data)
+	}
+	return w.csv.Write(record)
+}
+
+// Flush записывает буферизованные данные.
+func (w *Writer) Flush() error {
+	if w.format == FormatNDJSON {
+		return w.buf.Flush()
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Read читает все метрики в выбранном формате. Ошибка содержит номер строки с неверными данными.
+func Read(r io.Reader, format string) ([]models.Metrics, error) {
+	if err := Validate(format); err != nil {
+		return nil, err
+	}
+	if format == FormatCSV {
+		return readCSV(r)
+	}
+	return readNDJSON(r)
+}
+
+func readNDJSON(r io.Reader) ([]models.Metrics, error) {
+	metrics := []models.Metrics{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var metric models.Metrics
+		if err := json.Unmarshal(data, &metric); err != nil {
+			return nil, fmt.Errorf("строка %d: неверный формат JSON: %w", line, err)
+		}
+		metrics = append(metrics, metric)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+func readCSV(r io.Reader) ([]models.Metrics, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []models.Metrics{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("строка 1: %w", err)
+	}
+	if strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+		return nil, fmt.Errorf("строка 1: ожидается заголовок %s", strings.Join(csvHeader, ","))
+	}
+
+	metrics := []models.Metrics{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(csvHeader) {
+			return nil, fmt.Errorf("строка %d: ожидается %d полей, получено %d", line, len(csvHeader), len(record))
+		}
+
+		metric, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", line, err)
+		}
+		metrics = append(metrics, metric)
+	}
+}
+
+func parseRecord(record []string) (metric models.Metrics, err error) {
+	metric.ID = record[0]
+	metric.MType = record[1]
+	if record[2] != "" {
+		if metric.Labels, err = labels.Parse(record[2]); err != nil {
+			return metric, err
+		}
+	}
+
+	switch metric.MType {
+	case constants.Gauge:
+		value, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return metric, fmt.Errorf("неверное значение gauge %q", record[3])
+		}
+		metric.Value = &value
+	case constants.Counter:
+		delta, err := strconv.ParseInt(record[4], 10, 64)
+		if err != nil {
+			return metric, fmt.Errorf("неверное значение counter %q", record[4])
+		}
+		metric.Delta = &delta
+	case constants.Histogram:
+		var h models.Histogram
+		if err = json.Unmarshal([]byte(record[5]), &h); err != nil {
+			return metric, fmt.Errorf("неверное значение histogram: %w", err)
+		}
+		metric.Histogram = &h
+	default:
+		return metric, fmt.Errorf("тип %q не поддерживается", metric.MType)
+	}
+	return metric, nil
+}
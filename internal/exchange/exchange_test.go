@@ -0,0 +1,53 @@
+package exchange
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	value := 1.5
+	delta := int64(42)
+	metrics := []models.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "counter", Delta: &delta, Labels: map[string]string{"host": `a,"b"`}},
+		{ID: "Latency", MType: "histogram", Histogram: &models.Histogram{Bounds: []float64{1}, Counts: []int64{1, 2}, Sum: 7, Count: 3}},
+	}
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		var buf bytes.Buffer
+		writer, err := NewWriter(&buf, format)
+		require.NoError(t, err)
+		for _, metric := range metrics {
+			require.NoError(t, writer.Write(metric))
+		}
+		require.NoError(t, writer.Flush())
+
+		read, err := Read(&buf, format)
+		require.NoError(t, err, format)
+		assert.Equal(t, metrics, read, format)
+	}
+
+	_, err := NewWriter(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
+
+func TestRead_Errors(t *testing.T) {
+	_, err := Read(strings.NewReader("id,type,labels,value,delta,histogram\nAlloc,gauge,,abc,,\n"), FormatCSV)
+	assert.ErrorContains(t, err, "строка 2")
+
+	_, err = Read(strings.NewReader("name,value\n"), FormatCSV)
+	assert.ErrorContains(t, err, "заголовок")
+
+	_, err = Read(strings.NewReader("{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":1}\n\n{bad\n"), FormatNDJSON)
+	assert.ErrorContains(t, err, "строка 3")
+
+	assert.Equal(t, "csv", FormatFromContentType("text/csv; charset=utf-8"))
+	assert.Equal(t, "", FormatFromContentType("application/json"))
+}
@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"os"
+	"sync"
 
 	"metrics/internal/models"
 )
@@ -55,6 +56,7 @@ func (fr *FileReader) ReadMetrics() (metrics []*models.Metrics, err error) {
 type FileWriter struct {
 	file   *os.File
 	writer *bufio.Writer
+	m      sync.Mutex
 }
 
 func NewFileWriter(filename string) (*FileWriter, error) {
@@ -79,6 +81,30 @@ func (fw *FileWriter) WriteMetrics(metrics ...models.Metrics) error {
 	// 	return nil
 	// }
 
+	fw.m.Lock()
+	defer fw.m.Unlock()
+
+	return fw.write(metrics)
+}
+
+// Rewrite заменяет содержимое файла переданными метриками.
+// Используется после удаления или изменения метрик, чтобы при восстановлении из файла не загрузились прежние значения.
+func (fw *FileWriter) Rewrite(metrics ...models.Metrics) error {
+	fw.m.Lock()
+	defer fw.m.Unlock()
+
+	if err := fw.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := fw.file.Seek(0, 0); err != nil {
+		return err
+	}
+	fw.writer.Reset(fw.file)
+
+	return fw.write(metrics)
+}
+
+func (fw *FileWriter) write(metrics []models.Metrics) error {
 	for _, value := range metrics {
 		data, err := json.Marshal(value)
 		if err != nil {
@@ -0,0 +1,234 @@
+// В пакете grpcserver реализован gRPC-сервер, предоставляющий те же операции, что и HTTP-эндпоинты сервиса.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/controller"
+	"metrics/internal/cryptoutil"
+	"metrics/internal/filetransfer"
+	"metrics/internal/labels"
+	"metrics/internal/models"
+	pb "metrics/internal/proto"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Структура сервера отвечающего за обработку gRPC-запросов.
+type Server struct {
+	pb.UnimplementedMetricsServer
+
+	config     *config.Config
+	fileWriter *filetransfer.FileWriter
+	logger     *zap.Logger
+	controller *controller.Controller
+}
+
+func NewServer(cfg *config.Config, fileWriter *filetransfer.FileWriter, logger *zap.Logger, controller *controller.Controller) *Server {
+	return &Server{
+		config:     cfg,
+		fileWriter: fileWriter,
+		logger:     logger,
+		controller: controller,
+	}
+}
+
+// NewGRPCServer создает gRPC-сервер с зарегистрированным сервисом Metrics и перехватчиками доверенной подсети,
+// подписи и дешифровки.
+// Сообщения расшифровываются ключами из keys (может быть nil, если приватные ключи не заданы).
+// В opts передаются дополнительные параметры сервера, например настройки TLS.
+func NewGRPCServer(cfg *config.Config, keys *cryptoutil.KeyRing, fileWriter *filetransfer.FileWriter, logger *zap.Logger, controller *controller.Controller, opts ...grpc.ServerOption) *grpc.Server {
+	interceptors := NewInterceptors(cfg, keys, logger)
+
+	grpcServer := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(interceptors.TrustedUnary, interceptors.DecryptUnary, interceptors.SignUnary),
+		grpc.ChainStreamInterceptor(interceptors.TrustedStream, interceptors.DecryptStream, interceptors.SignStream),
+	}, opts...)...)
+	pb.RegisterMetricsServer(grpcServer, NewServer(cfg, fileWriter, logger, controller))
+
+	return grpcServer
+}
+
+// Обновление одной метрики (аналог POST /update/).
+func (s *Server) UpdateMetric(ctx context.Context, req *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
+	metric, err := s.updateMetric(ctx, req.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateMetricResponse{Metric: metric}, nil
+}
+
+// Обновление метрик пакетом (аналог POST /updates/).
+func (s *Server) UpdateMetricsBatch(ctx context.Context, req *pb.UpdateMetricsBatchRequest) (*pb.UpdateMetricsBatchResponse, error) {
+	if len(req.GetMetrics()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Empty batch")
+	}
+
+	metrics := make([]models.Metrics, 0, len(req.GetMetrics()))
+	for _, metric := range req.GetMetrics() {
+		metrics = append(metrics, toModel(metric))
+	}
+
+	statusCode, err := s.controller.SaveMetrics(ctx, metrics)
+	if err != nil {
+		return nil, toStatus(statusCode, err)
+	}
+
+	return &pb.UpdateMetricsBatchResponse{}, nil
+}
+
+// Обновление метрик в рамках одного клиентского потока.
+// Каждое сообщение потока обрабатывается так же, как запрос UpdateMetric.
+func (s *Server) UpdateMetrics(stream pb.Metrics_UpdateMetricsServer) error {
+	var received int64
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.UpdateMetricsResponse{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = s.updateMetric(stream.Context(), req.GetMetric()); err != nil {
+			return err
+		}
+		received++
+	}
+}
+
+// Получение значения метрики (аналог POST /value/).
+func (s *Server) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	metric := models.Metrics{
+		ID:     req.GetId(),
+		MType:  req.GetType(),
+		Labels: req.GetLabels(),
+	}
+
+	statusCode, err := s.controller.GetOneMetric(ctx, &metric)
+	if err != nil {
+		return nil, toStatus(statusCode, err)
+	}
+
+	return &pb.GetMetricResponse{Metric: fromModel(metric)}, nil
+}
+
+// Получение значений всех метрик (аналог GET /).
+func (s *Server) ListMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	counters := s.controller.GetAllCounter(ctx)
+	gauges := s.controller.GetAllGauge(ctx)
+
+	metrics := make([]*pb.Metric, 0, len(counters)+len(gauges))
+	for key, delta := range counters {
+		id, metricLabels := labels.SplitSeriesKey(key)
+		metrics = append(metrics, &pb.Metric{Id: id, Type: constants.Counter, Delta: &delta, Labels: metricLabels})
+	}
+	for key, value := range gauges {
+		id, metricLabels := labels.SplitSeriesKey(key)
+		metrics = append(metrics, &pb.Metric{Id: id, Type: constants.Gauge, Value: &value, Labels: metricLabels})
+	}
+	for key, value := range s.controller.GetAllHistogram(ctx) {
+		id, metricLabels := labels.SplitSeriesKey(key)
+		metrics = append(metrics, &pb.Metric{Id: id, Type: constants.Histogram, Histogram: histogramFromModel(&value), Labels: metricLabels})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Type != metrics[j].Type {
+			return metrics[i].Type < metrics[j].Type
+		}
+		return labels.SeriesKey(metrics[i].Id, metrics[i].Labels) < labels.SeriesKey(metrics[j].Id, metrics[j].Labels)
+	})
+
+	return &pb.ListMetricsResponse{Metrics: metrics}, nil
+}
+
+func (s *Server) updateMetric(ctx context.Context, metric *pb.Metric) (*pb.Metric, error) {
+	if metric == nil {
+		return nil, status.Error(codes.InvalidArgument, "метрика не заполнена")
+	}
+
+	request := toModel(metric)
+
+	switch {
+	case request.MType == constants.Gauge && request.Value == nil:
+		return nil, status.Errorf(codes.InvalidArgument, "не заполнено значение метрики %s типа %s", request.ID, request.MType)
+	case request.MType == constants.Counter && request.Delta == nil:
+		return nil, status.Errorf(codes.InvalidArgument, "не заполнено значение метрики %s типа %s", request.ID, request.MType)
+	}
+
+	statusCode, err := s.controller.UpdateMetric(ctx, request)
+	if err != nil {
+		return nil, toStatus(statusCode, err)
+	}
+
+	if s.config.IsSyncStore() && s.fileWriter != nil {
+		s.fileWriter.WriteMetrics(request)
+	}
+
+	return fromModel(request), nil
+}
+
+func toModel(metric *pb.Metric) models.Metrics {
+	result := models.Metrics{
+		ID:     metric.GetId(),
+		MType:  metric.GetType(),
+		Delta:  metric.Delta,
+		Value:  metric.Value,
+		Labels: metric.GetLabels(),
+	}
+	if h := metric.GetHistogram(); h != nil {
+		result.Histogram = &models.Histogram{
+			Bounds: h.GetBounds(),
+			Counts: h.GetCounts(),
+			Sum:    h.GetSum(),
+			Count:  h.GetCount(),
+		}
+	}
+	return result
+}
+
+func fromModel(metric models.Metrics) *pb.Metric {
+	return &pb.Metric{
+		Id:        metric.ID,
+		Type:      metric.MType,
+		Delta:     metric.Delta,
+		Value:     metric.Value,
+		Histogram: histogramFromModel(metric.Histogram),
+		Labels:    metric.Labels,
+	}
+}
+
+func histogramFromModel(h *models.Histogram) *pb.Histogram {
+	if h == nil {
+		return nil
+	}
+	return &pb.Histogram{
+		Bounds: h.Bounds,
+		Counts: h.Counts,
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// toStatus переводит код ответа HTTP, который возвращает контроллер, в код ответа gRPC.
+func toStatus(statusCode int, err error) error {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,245 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"metrics/internal/authsign"
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/controller"
+	pb "metrics/internal/proto"
+	"metrics/internal/storage/inmemory"
+	"metrics/internal/trustedsubnet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestClient(t *testing.T, cfg *config.Config) pb.MetricsClient {
+	t.Helper()
+
+	logger := zap.NewNop()
+	ctrl := controller.NewController(inmemory.NewMemStorage(), logger)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewGRPCServer(cfg, nil, nil, logger, ctrl)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewMetricsClient(conn)
+}
+
+func TestServer_UpdateAndGet(t *testing.T) {
+	client := newTestClient(t, &config.Config{Server: config.ServerConfig{StoreInterval: 300}})
+	ctx := context.Background()
+
+	value := 1.5
+	_, err := client.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "g", Type: constants.Gauge, Value: &value}})
+	require.NoError(t, err)
+
+	delta := int64(2)
+	_, err = client.UpdateMetricsBatch(ctx, &pb.UpdateMetricsBatchRequest{Metrics: []*pb.Metric{
+		{Id: "c", Type: constants.Counter, Delta: &delta},
+		{Id: "c", Type: constants.Counter, Delta: &delta},
+	}})
+	require.NoError(t, err)
+
+	stream, err := client.UpdateMetrics(ctx)
+	require.NoError(t, err)
+	for range 3 {
+		require.NoError(t, stream.Send(&pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "c", Type: constants.Counter, Delta: &delta}}))
+	}
+	streamResp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), streamResp.GetReceived())
+
+	resp, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "c", Type: constants.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), resp.GetMetric().GetDelta())
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 2)
+	assert.Equal(t, "c", list.GetMetrics()[0].GetId())
+	assert.Equal(t, "g", list.GetMetrics()[1].GetId())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "unknown", Type: constants.Gauge})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "g", Type: constants.Gauge}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_ListMetricsConcurrentUpdates(t *testing.T) {
+	client := newTestClient(t, &config.Config{Server: config.ServerConfig{StoreInterval: 300}})
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			value := float64(i)
+			delta := int64(1)
+			client.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "g" + strconv.Itoa(i), Type: constants.Gauge, Value: &value}})
+			client.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "c" + strconv.Itoa(i), Type: constants.Counter, Delta: &delta}})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		_, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+		require.NoError(t, err)
+	}
+	<-done
+
+	resp, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetMetrics(), 400)
+}
+
+func TestInterceptors_Sign(t *testing.T) {
+	key := "secret"
+	client := newTestClient(t, &config.Config{SecretKey: key, Server: config.ServerConfig{StoreInterval: 300, SignatureSkew: time.Minute}})
+
+	value := 3.0
+	req := &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "g", Type: constants.Gauge, Value: &value}}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	signed := func(nonce, hash string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(),
+			constants.HeaderSig, hash, constants.HeaderSigTimestamp, timestamp, constants.HeaderSigNonce, nonce)
+	}
+
+	hash, err := CalculateMessageHash(pb.Metrics_UpdateMetric_FullMethodName, timestamp, "n1", req, []byte(key))
+	require.NoError(t, err)
+	_, err = client.UpdateMetric(signed("n1", hash), req)
+	assert.NoError(t, err)
+
+	// Повторный запрос с тем же nonce отклоняется.
+	_, err = client.UpdateMetric(signed("n1", hash), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Подпись привязана к nonce и методу.
+	_, err = client.UpdateMetric(signed("n2", hash), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Подпись версии 1 и запрос без подписи не принимаются без LegacySignature.
+	data, err := DataForSign(req)
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), constants.HeaderSig, authsign.CalculateHash(data, []byte(key)))
+	_, err = client.UpdateMetric(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateMetric(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	send := func(nonce string, hashes ...string) error {
+		stream, err := client.UpdateMetrics(signed(nonce, ""))
+		require.NoError(t, err)
+		for _, hash := range hashes {
+			message := proto.Clone(req).(*pb.UpdateMetricRequest)
+			message.Hash = hash
+			require.NoError(t, stream.Send(message))
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	streamHash := func(nonce string, index int) string {
+		hash, err := CalculateMessageHash(pb.Metrics_UpdateMetrics_FullMethodName, timestamp, StreamMessageNonce(nonce, index), req, []byte(key))
+		require.NoError(t, err)
+		return hash
+	}
+
+	assert.NoError(t, send("s1", streamHash("s1", 0), streamHash("s1", 1)))
+
+	// Сообщения нельзя переставить, а поток - повторить.
+	assert.Equal(t, codes.InvalidArgument, status.Code(send("s2", streamHash("s2", 1), streamHash("s2", 0))))
+	assert.Equal(t, codes.InvalidArgument, status.Code(send("s1", streamHash("s1", 0))))
+
+	// Подпись из метаданных потока не принимается вместо подписи сообщения.
+	assert.Equal(t, codes.InvalidArgument, status.Code(send("s3", "")))
+}
+
+func TestInterceptors_LegacySign(t *testing.T) {
+	key := "secret"
+	client := newTestClient(t, &config.Config{SecretKey: key, Server: config.ServerConfig{StoreInterval: 300, LegacySignature: true}})
+
+	value := 3.0
+	req := &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "g", Type: constants.Gauge, Value: &value}}
+	data, err := DataForSign(req)
+	require.NoError(t, err)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), constants.HeaderSig, authsign.CalculateHash(data, []byte(key)))
+	_, err = client.UpdateMetric(ctx, req)
+	assert.NoError(t, err)
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), constants.HeaderSig, authsign.CalculateHash(data, []byte("wrong")))
+	_, err = client.UpdateMetric(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.UpdateMetrics(context.Background())
+	require.NoError(t, err)
+	req.Hash = authsign.CalculateHash(data, []byte("wrong"))
+	require.NoError(t, stream.Send(req))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Подпись из метаданных потока не принимается вместо подписи сообщения.
+	ctx = metadata.AppendToOutgoingContext(context.Background(), constants.HeaderSig, authsign.CalculateHash(data, []byte(key)))
+	stream, err = client.UpdateMetrics(ctx)
+	require.NoError(t, err)
+	req.Hash = ""
+	require.NoError(t, stream.Send(req))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err = client.UpdateMetrics(context.Background())
+	require.NoError(t, err)
+	req.Hash = authsign.CalculateHash(data, []byte(key))
+	require.NoError(t, stream.Send(req))
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+}
+
+func TestInterceptors_TrustedSubnet(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+	client := newTestClient(t, &config.Config{Server: config.ServerConfig{StoreInterval: 300, TrustedSubnet: subnet}})
+
+	value := 3.0
+	req := &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "g", Type: constants.Gauge, Value: &value}}
+
+	_, err = client.UpdateMetric(context.Background(), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), trustedsubnet.HeaderRealIP, "10.0.0.1")
+	_, err = client.UpdateMetric(ctx, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.UpdateMetrics(ctx)
+	require.NoError(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), trustedsubnet.HeaderRealIP, "192.168.1.10")
+	_, err = client.UpdateMetric(ctx, req)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,359 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metrics/internal/authsign"
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/cryptoutil"
+	pb "metrics/internal/proto"
+	"metrics/internal/trustedsubnet"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Ключ метаданных, аналог HTTP-заголовка Content-Encrypted.
+const metadataEncrypted = "Content-Encrypted"
+
+// Методы обновления метрик, которые, как и HTTP-запросы на обновление, принимаются только из доверенной подсети.
+var trustedMethods = map[string]bool{
+	pb.Metrics_UpdateMetric_FullMethodName:       true,
+	pb.Metrics_UpdateMetricsBatch_FullMethodName: true,
+	pb.Metrics_UpdateMetrics_FullMethodName:      true,
+}
+
+// Сообщение, которое может быть передано в зашифрованном виде.
+type encryptedMessage interface {
+	proto.Message
+	GetEncrypted() []byte
+}
+
+// Сообщение, которое содержит подпись в теле.
+type signedMessage interface {
+	proto.Message
+	GetHash() string
+}
+
+// Interceptors реализует проверку подписи и дешифровку сообщений по тем же правилам, что и HTTP-сервер.
+type Interceptors struct {
+	config *config.Config
+	keys   *cryptoutil.KeyRing
+	nonces *authsign.NonceCache
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+func NewInterceptors(cfg *config.Config, keys *cryptoutil.KeyRing, logger *zap.Logger) *Interceptors {
+	return &Interceptors{
+		config: cfg,
+		keys:   keys,
+		// Время подписи принимается в окне ±SignatureSkew, поэтому nonce хранится вдвое дольше.
+		nonces: authsign.NewNonceCache(2 * cfg.Server.SignatureSkew),
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// TrustedUnary отклоняет вызов метода обновления метрик с кодом PermissionDenied, если адрес из метаданных X-Real-IP
+// не входит в доверенную подсеть (см. пакет trustedsubnet).
+func (i *Interceptors) TrustedUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := i.checkSubnet(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// TrustedStream проверяет адрес из метаданных X-Real-IP при открытии потока обновления метрик.
+func (i *Interceptors) TrustedStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := i.checkSubnet(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// DecryptUnary расшифровывает запрос, если в метаданных передан признак Content-Encrypted.
+func (i *Interceptors) DecryptUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := i.decryptMessage(ctx, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// SignUnary проверяет подпись запроса по схеме версии 2 (см. CalculateMessageHash): подпись передается в поле hash
+// или в метаданных HashSHA256, время подписи и nonce - в метаданных X-Signature-Timestamp и X-Signature-Nonce.
+// Подпись версии 1 и запросы без подписи принимаются, только если задан LegacySignature.
+func (i *Interceptors) SignUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := i.verifyMessage(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// DecryptStream расшифровывает каждое сообщение потока, если в метаданных передан признак Content-Encrypted.
+func (i *Interceptors) DecryptStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &wrappedStream{ServerStream: ss, onRecv: i.decryptMessage})
+}
+
+// SignStream проверяет подпись каждого сообщения потока.
+// Время подписи и nonce передаются в метаданных потока и проверяются при его открытии, а каждое сообщение
+// подписывается в поле hash с nonce StreamMessageNonce(nonce, номер сообщения). Одна подпись из метаданных потока
+// не может подходить ко всем сообщениям, поэтому при заданном ключе сообщение без hash отклоняется.
+// Подпись версии 1 принимается, только если задан LegacySignature.
+func (i *Interceptors) SignStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if i.config.SecretKey == "" {
+		return handler(srv, ss)
+	}
+
+	timestamp := metadataValue(ss.Context(), constants.HeaderSigTimestamp)
+	if timestamp == "" {
+		if !i.config.Server.LegacySignature {
+			return errUnsigned
+		}
+		return handler(srv, &wrappedStream{ServerStream: ss, onRecv: i.verifyLegacyStreamMessage})
+	}
+
+	nonce := metadataValue(ss.Context(), constants.HeaderSigNonce)
+	if err := i.checkFreshness(timestamp, nonce); err != nil {
+		return err
+	}
+
+	index := 0
+	return handler(srv, &wrappedStream{ServerStream: ss, onRecv: func(ctx context.Context, msg any) error {
+		receivedHash := messageHash(msg)
+		if receivedHash == "" {
+			return status.Error(codes.InvalidArgument, "сообщение потока не подписано: требуется поле hash")
+		}
+		if err := i.checkRequestHash(info.FullMethod, timestamp, StreamMessageNonce(nonce, index), msg, receivedHash); err != nil {
+			return err
+		}
+		// nonce потока запоминается после проверки подписи первого сообщения, чтобы нельзя было заполнить кеш чужими значениями.
+		if index == 0 && !i.nonces.Add(nonce, i.now()) {
+			return status.Error(codes.InvalidArgument, "повторный запрос: nonce уже использован")
+		}
+		index++
+		return nil
+	}})
+}
+
+// errUnsigned - запрос без подписи версии 2 при отключенном LegacySignature.
+var errUnsigned = status.Errorf(codes.InvalidArgument, "запрос не подписан: требуются метаданные %s, %s и %s",
+	constants.HeaderSig, constants.HeaderSigTimestamp, constants.HeaderSigNonce)
+
+func (i *Interceptors) checkSubnet(ctx context.Context, method string) error {
+	if !trustedMethods[method] || !i.config.IsTrustedSubnetEnabled() {
+		return nil
+	}
+
+	realIP := metadataValue(ctx, trustedsubnet.HeaderRealIP)
+	ip := net.ParseIP(realIP)
+	if ip == nil || !i.config.Server.TrustedSubnet.Contains(ip) {
+		i.logger.Warn("адрес агента вне доверенной подсети", zap.String("real_ip", realIP), zap.String("method", method))
+		return status.Error(codes.PermissionDenied, "адрес агента вне доверенной подсети")
+	}
+	return nil
+}
+
+func (i *Interceptors) decryptMessage(ctx context.Context, msg any) error {
+	mode := metadataValue(ctx, metadataEncrypted)
+	if mode != cryptoutil.ModeLegacy && mode != cryptoutil.ModeEnvelope {
+		return nil
+	}
+
+	message, ok := msg.(encryptedMessage)
+	if !ok {
+		return nil
+	}
+
+	if len(message.GetEncrypted()) == 0 {
+		return status.Error(codes.InvalidArgument, "зашифрованное сообщение не заполнено")
+	}
+
+	if i.keys == nil {
+		return status.Error(codes.Internal, "Ошибка загрузки приватного ключа")
+	}
+
+	decrypted, err := i.keys.Decrypt(metadataValue(ctx, constants.HeaderKeyID), mode, message.GetEncrypted())
+	if err != nil {
+		i.logger.Error("ошибка дешифровки: " + err.Error())
+		return status.Error(codes.InvalidArgument, "Ошибка дешифровки")
+	}
+
+	proto.Reset(message)
+	if err = proto.Unmarshal(decrypted, message); err != nil {
+		i.logger.Error("ошибка дешифровки: " + err.Error())
+		return status.Error(codes.InvalidArgument, "Ошибка дешифровки")
+	}
+
+	return nil
+}
+
+func (i *Interceptors) verifyMessage(ctx context.Context, method string, msg any) error {
+	if i.config.SecretKey == "" {
+		return nil
+	}
+
+	receivedHash := messageHash(msg)
+	if receivedHash == "" {
+		receivedHash = metadataValue(ctx, constants.HeaderSig)
+	}
+
+	timestamp := metadataValue(ctx, constants.HeaderSigTimestamp)
+	if timestamp == "" {
+		if !i.config.Server.LegacySignature {
+			return errUnsigned
+		}
+		if receivedHash == "" {
+			return nil
+		}
+		return i.checkHash(msg, receivedHash)
+	}
+
+	nonce := metadataValue(ctx, constants.HeaderSigNonce)
+	if err := i.checkFreshness(timestamp, nonce); err != nil {
+		return err
+	}
+	if err := i.checkRequestHash(method, timestamp, nonce, msg, receivedHash); err != nil {
+		return err
+	}
+	// nonce запоминается только после проверки подписи, чтобы нельзя было заполнить кеш чужими значениями.
+	if !i.nonces.Add(nonce, i.now()) {
+		return status.Error(codes.InvalidArgument, "повторный запрос: nonce уже использован")
+	}
+	return nil
+}
+
+func (i *Interceptors) verifyLegacyStreamMessage(ctx context.Context, msg any) error {
+	receivedHash := messageHash(msg)
+	if receivedHash == "" {
+		return status.Error(codes.InvalidArgument, "сообщение потока не подписано: требуется поле hash")
+	}
+
+	return i.checkHash(msg, receivedHash)
+}
+
+// checkFreshness проверяет время подписи и nonce из метаданных.
+func (i *Interceptors) checkFreshness(timestamp, nonce string) error {
+	if err := authsign.CheckTimestamp(timestamp, i.now(), i.config.Server.SignatureSkew); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := authsign.CheckNonce(nonce); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// checkRequestHash проверяет подпись версии 2 (см. CalculateMessageHash).
+func (i *Interceptors) checkRequestHash(method, timestamp, nonce string, msg any, receivedHash string) error {
+	message, ok := msg.(proto.Message)
+	if !ok {
+		return status.Error(codes.Internal, "неизвестный тип сообщения")
+	}
+
+	data, err := DataForSign(message)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if !authsign.VerifyRequestSig(receivedHash, http.MethodPost, method, timestamp, nonce, data, []byte(i.config.SecretKey)) {
+		i.logger.Error("invalid hash")
+		return status.Error(codes.InvalidArgument, "invalid hash")
+	}
+
+	return nil
+}
+
+// checkHash проверяет подпись версии 1 - HMAC-SHA256 от DataForSign(msg).
+func (i *Interceptors) checkHash(msg any, receivedHash string) error {
+	message, ok := msg.(proto.Message)
+	if !ok {
+		return status.Error(codes.Internal, "неизвестный тип сообщения")
+	}
+
+	data, err := DataForSign(message)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if !authsign.VerifySig(receivedHash, data, []byte(i.config.SecretKey)) {
+		i.logger.Error("invalid hash")
+		return status.Error(codes.InvalidArgument, "invalid hash")
+	}
+
+	return nil
+}
+
+// CalculateMessageHash возвращает подпись версии 2 сообщения msg метода method (полное имя, например
+// /metrics.Metrics/UpdateMetric): authsign.CalculateRequestHash от метода POST, которым gRPC передает вызов по HTTP/2,
+// имени метода, времени подписи, nonce и DataForSign(msg).
+func CalculateMessageHash(method, timestamp, nonce string, msg proto.Message, key []byte) (string, error) {
+	data, err := DataForSign(msg)
+	if err != nil {
+		return "", err
+	}
+	return authsign.CalculateRequestHash(http.MethodPost, method, timestamp, nonce, data, key), nil
+}
+
+// StreamMessageNonce возвращает nonce, с которым подписывается сообщение потока с номером index (с нуля).
+// Подпись привязана к позиции сообщения, поэтому сообщения потока нельзя переставить или повторить.
+func StreamMessageNonce(nonce string, index int) string {
+	return nonce + ":" + strconv.Itoa(index)
+}
+
+// DataForSign возвращает данные, от которых вычисляется подпись сообщения.
+// Подписывается сообщение в открытом виде без полей hash и encrypted, сериализованное в детерминированном порядке.
+func DataForSign(msg proto.Message) ([]byte, error) {
+	clone := proto.Clone(msg)
+	reflectMsg := clone.ProtoReflect()
+	fields := reflectMsg.Descriptor().Fields()
+
+	for _, name := range []protoreflect.Name{"hash", "encrypted"} {
+		if field := fields.ByName(name); field != nil {
+			reflectMsg.Clear(field)
+		}
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(clone)
+}
+
+func messageHash(msg any) string {
+	if message, ok := msg.(signedMessage); ok {
+		return message.GetHash()
+	}
+	return ""
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// wrappedStream вызывает onRecv для каждого полученного сообщения потока.
+type wrappedStream struct {
+	grpc.ServerStream
+	onRecv func(ctx context.Context, msg any) error
+}
+
+func (w *wrappedStream) RecvMsg(m any) error {
+	if err := w.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return w.onRecv(w.ServerStream.Context(), m)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metrics/internal/models"
+	"metrics/internal/snapshot"
+	"metrics/internal/validation"
+
+	"go.uber.org/zap"
+)
+
+// Обработка DELETE /admin/metrics/{metricType}/{metricName}: удаление серии вместе с историей.
+// Метки серии передаются параметрами label=name=value.
+func (server *Server) HandleDeleteMetric(res http.ResponseWriter, req *http.Request) {
+	metricLabels, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statusCode, err := server.controller.DeleteMetric(req.Context(), req.PathValue("metricType"), req.PathValue("metricName"), metricLabels)
+	if err != nil {
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	server.saveSnapshot()
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Обработка DELETE /admin/metrics?pattern=&type=: удаление всех серий, имена которых соответствуют шаблону glob.
+func (server *Server) HandleDeleteMetrics(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	deleted, statusCode, err := server.controller.DeleteMetrics(req.Context(), query.Get("type"), query.Get("pattern"))
+	if err != nil {
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	if deleted > 0 {
+		server.saveSnapshot()
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(struct {
+		Deleted int `json:"deleted"`
+	}{Deleted: deleted})
+}
+
+// Обработка POST /admin/metrics/counter/{metricName}/reset: обнуление counter.
+func (server *Server) HandleResetCounter(res http.ResponseWriter, req *http.Request) {
+	metricLabels, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statusCode, err := server.controller.ResetCounter(req.Context(), req.PathValue("metricName"), metricLabels)
+	if err != nil {
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	server.saveSnapshot()
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Обработка POST /admin/metrics/{metricType}/{metricName}/rename?to=: переименование серии.
+// Метки серии сохраняются.
+func (server *Server) HandleRenameMetric(res http.ResponseWriter, req *http.Request) {
+	metricLabels, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statusCode, err := server.controller.RenameMetric(req.Context(), req.PathValue("metricType"), req.PathValue("metricName"), metricLabels, req.URL.Query().Get("to"))
+	if err != nil {
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	server.saveSnapshot()
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Обработка POST /admin/snapshot?name=: создание снимка всех метрик в каталоге снимков.
+// Если имя не указано, используется время создания. Существующий снимок не перезаписывается.
+func (server *Server) HandleCreateSnapshot(res http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		name = snapshot.DefaultName(time.Now())
+	}
+	if err := snapshot.ValidateName(name); err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Метрики читаются одним запросом к хранилищу, поэтому снимок соответствует одному моменту времени.
+	metrics := []models.Metrics{}
+	err := server.controller.WalkMetrics(req.Context(), func(metric models.Metrics) error {
+		metrics = append(metrics, metric)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("ошибка при чтении метрик: %w", err)
+		server.logger.Error(err.Error())
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	info, err := server.snapshots.Save(name, metrics)
+	if err != nil {
+		server.snapshotError(res, err)
+		return
+	}
+
+	server.logger.Info(fmt.Sprintf("создан снимок %s (метрик: %d)", info.Name, len(metrics)))
+	writeJSON(res, http.StatusCreated, info)
+}
+
+// Обработка GET /admin/snapshots: список снимков, сначала новые.
+func (server *Server) HandleListSnapshots(res http.ResponseWriter, req *http.Request) {
+	infos, err := server.snapshots.List()
+	if err != nil {
+		server.snapshotError(res, err)
+		return
+	}
+	writeJSON(res, http.StatusOK, infos)
+}
+
+// Обработка POST /admin/restore?name=: восстановление метрик из снимка.
+// Значения всех метрик заменяются значениями из снимка в одной транзакции, сервер продолжает принимать запросы.
+func (server *Server) HandleRestoreSnapshot(res http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	metrics, err := server.snapshots.Load(name)
+	if err != nil {
+		server.snapshotError(res, err)
+		return
+	}
+
+	statusCode, err := server.controller.ReplaceMetrics(req.Context(), metrics)
+	if err != nil {
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	server.saveSnapshot()
+	server.logger.Info(fmt.Sprintf("метрики восстановлены из снимка %s (метрик: %d)", name, len(metrics)))
+	writeJSON(res, http.StatusOK, struct {
+		Name     string `json:"name"`
+		Restored int    `json:"restored"`
+	}{Name: name, Restored: len(metrics)})
+}
+
+// Обработка DELETE /admin/snapshots/{name}: удаление снимка.
+func (server *Server) HandleDeleteSnapshot(res http.ResponseWriter, req *http.Request) {
+	if err := server.snapshots.Delete(req.PathValue("name")); err != nil {
+		server.snapshotError(res, err)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Обработка DELETE /admin/snapshots?keep=&older_than=: удаление старых снимков.
+// keep - количество самых новых снимков, которые сохраняются; older_than - удаляются снимки старше
+// указанной длительности (например 168h). Должен быть указан хотя бы один параметр.
+func (server *Server) HandlePruneSnapshots(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	var keep int
+	var olderThan time.Time
+	var err error
+	if value := query.Get("keep"); value != "" {
+		if keep, err = strconv.Atoi(value); err != nil || keep < 0 {
+			validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный формат параметра keep: %s", value))
+			return
+		}
+	}
+	if value := query.Get("older_than"); value != "" {
+		age, err := time.ParseDuration(value)
+		if err != nil || age < 0 {
+			validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный формат параметра older_than: %s", value))
+			return
+		}
+		olderThan = time.Now().Add(-age)
+	}
+	if keep == 0 && olderThan.IsZero() {
+		validation.WriteError(res, http.StatusBadRequest, "укажите параметр keep или older_than")
+		return
+	}
+
+	deleted, err := server.snapshots.Prune(keep, olderThan)
+	if err != nil {
+		server.snapshotError(res, err)
+		return
+	}
+	writeJSON(res, http.StatusOK, struct {
+		Deleted []string `json:"deleted"`
+	}{Deleted: deleted})
+}
+
+// Обработка POST /admin/keys/reload: перезагрузка приватных ключей с диска без перезапуска сервера.
+// В ответе возвращаются идентификаторы загруженных ключей.
+func (server *Server) HandleReloadKeys(res http.ResponseWriter, req *http.Request) {
+	if server.keys == nil {
+		validation.WriteError(res, http.StatusBadRequest, "приватные ключи не заданы")
+		return
+	}
+
+	if err := server.keys.Reload(); err != nil {
+		server.logger.Error(err.Error())
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := server.keys.IDs()
+	server.logger.Info("приватные ключи перезагружены", zap.Strings("keys", ids))
+	writeJSON(res, http.StatusOK, struct {
+		Keys []string `json:"keys"`
+	}{Keys: ids})
+}
+
+func (server *Server) snapshotError(res http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, snapshot.ErrInvalidName):
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+	case errors.Is(err, snapshot.ErrNotFound):
+		http.Error(res, err.Error(), http.StatusNotFound)
+	case errors.Is(err, snapshot.ErrExists):
+		http.Error(res, err.Error(), http.StatusConflict)
+	default:
+		server.logger.Error(err.Error())
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(res http.ResponseWriter, statusCode int, value any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(statusCode)
+	json.NewEncoder(res).Encode(value)
+}
+
+// saveSnapshot перезаписывает файл метрик текущим состоянием хранилища, чтобы изменения,
+// сделанные через эндпоинты администрирования, не откатились при перезапуске с восстановлением из файла.
+// При хранении в БД файл для восстановления не используется.
+func (server *Server) saveSnapshot() {
+	if server.fileWriter == nil || server.config.IsDatabaseEnabled() {
+		return
+	}
+
+	if err := server.fileWriter.Rewrite(server.controller.GetAllMetricsInJSON()...); err != nil {
+		err = fmt.Errorf("ошибка при сохранении метрик в файл: %w", err)
+		server.logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metrics/internal/exchange"
+	"metrics/internal/listing"
+	"metrics/internal/models"
+	"metrics/internal/retention"
+	"metrics/internal/validation"
+)
+
+// Интервал, за который возвращается история, если параметр from не передан.
+const defaultRangeWindow = time.Hour
+
+// Обработка GET /api/v1/range: история значений метрики за интервал.
+//
+// Параметры запроса:
+//
+//	id - имя метрики (обязательный)
+//	type - тип метрики: gauge или counter (обязательный)
+//	from, to - границы интервала в формате RFC 3339 или в секундах Unix (по умолчанию последний час)
+//	step - шаг группировки точек, например 30s или 60 (в секундах); по умолчанию точки не группируются
+//	resolution - raw (исходные точки, по умолчанию), 1m или 1h (агрегаты, сформированные политиками хранения);
+//	             для агрегатов параметр step не используется
+//	label - метка серии в виде name=value, может быть указан несколько раз
+func (server *Server) HandleRange(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	metricLabels, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		if to, err = parseTime(value); err != nil {
+			validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный формат параметра to: %s", value))
+			return
+		}
+	}
+
+	from := to.Add(-defaultRangeWindow)
+	if value := query.Get("from"); value != "" {
+		if from, err = parseTime(value); err != nil {
+			validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный формат параметра from: %s", value))
+			return
+		}
+	}
+
+	var step time.Duration
+	if value := query.Get("step"); value != "" {
+		if step, err = parseStep(value); err != nil {
+			validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный формат параметра step: %s", value))
+			return
+		}
+	}
+
+	response := models.Series{
+		ID:         query.Get("id"),
+		MType:      query.Get("type"),
+		Labels:     metricLabels,
+		Resolution: query.Get("resolution"),
+	}
+
+	var statusCode int
+	switch response.Resolution {
+	case "", "raw":
+		response.Points, statusCode, err = server.controller.GetRange(req.Context(), response.MType, response.ID, metricLabels, from, to, step)
+	case "1m":
+		response.Aggregates, statusCode, err = server.controller.GetAggregates(req.Context(), response.MType, response.ID, metricLabels, retention.Minute, from, to)
+	case "1h":
+		response.Aggregates, statusCode, err = server.controller.GetAggregates(req.Context(), response.MType, response.ID, metricLabels, retention.Hour, from, to)
+	default:
+		validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверное значение параметра resolution: %s", response.Resolution))
+		return
+	}
+	if err != nil {
+		if statusCode == 0 {
+			statusCode = http.StatusInternalServerError
+		}
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(res).Encode(response); err != nil {
+		err = fmt.Errorf("ошибка при заполнении ответа: %w", err)
+		server.logger.Error(err.Error())
+	}
+}
+
+// Обработка GET /api/v1/metrics: список метрик в формате JSON.
+//
+// Параметры запроса:
+//
+//	type - тип метрики: gauge, counter или histogram
+//	prefix - имя метрики начинается с указанной строки
+//	glob - имя метрики соответствует шаблону, например Heap* или CPU?
+//	regex - имя метрики содержит совпадение с регулярным выражением
+//	sort - name (по умолчанию), -name, type или -type
+//	limit, offset - постраничный вывод
+func (server *Server) HandleListMetrics(res http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+
+	query := listing.Query{
+		Type:   params.Get("type"),
+		Prefix: params.Get("prefix"),
+		Glob:   params.Get("glob"),
+		Regex:  params.Get("regex"),
+		Sort:   params.Get("sort"),
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{
+		{name: "limit", dst: &query.Limit},
+		{name: "offset", dst: &query.Offset},
+	} {
+		value := params.Get(param.name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный формат параметра %s: %s", param.name, value))
+			return
+		}
+		*param.dst = number
+	}
+
+	var response models.MetricsList
+	var statusCode int
+	var err error
+	response.Metrics, response.Total, statusCode, err = server.controller.ListMetrics(req.Context(), &query)
+	if err != nil {
+		if statusCode == 0 {
+			statusCode = http.StatusInternalServerError
+		}
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(res).Encode(response); err != nil {
+		err = fmt.Errorf("ошибка при заполнении ответа: %w", err)
+		server.logger.Error(err.Error())
+	}
+}
+
+// Обработка GET /api/v1/alerts: активные алерты (в состояниях pending и firing).
+func (server *Server) HandleAlerts(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(res).Encode(server.controller.GetAlerts()); err != nil {
+		err = fmt.Errorf("ошибка при заполнении ответа: %w", err)
+		server.logger.Error(err.Error())
+	}
+}
+
+// Обработка GET /api/v1/export?format=csv|ndjson: выгрузка всех метрик (по умолчанию в формате csv).
+// Метрики записываются в ответ по мере чтения из хранилища.
+func (server *Server) HandleExport(res http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = exchange.FormatCSV
+	}
+
+	writer, err := exchange.NewWriter(res, format)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res.Header().Set("Content-Type", exchange.ContentType(format))
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="metrics.%s"`, format))
+
+	err = server.controller.WalkMetrics(req.Context(), writer.Write)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		// заголовки уже отправлены, поэтому ошибка только записывается в лог
+		err = fmt.Errorf("ошибка при выгрузке метрик: %w", err)
+		server.logger.Error(err.Error())
+	}
+}
+
+// Обработка POST /api/v1/import?format=csv|ndjson&mode=merge|replace: загрузка метрик.
+//
+// Формат определяется параметром format или заголовком Content-Type (text/csv, application/x-ndjson).
+// В режиме merge (по умолчанию) метрики обновляются так же, как в POST /updates/: gauge заменяются,
+// counter и histogram накапливаются. В режиме replace значения всех метрик заменяются загруженными;
+// пустой набор в этом режиме отклоняется с кодом 400. Токен администратора для replace проверяет adminauth.AuthorizeIf.
+// Загрузка выполняется в одной транзакции: при ошибке в любой строке не сохраняется ничего.
+func (server *Server) HandleImport(res http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+
+	format := params.Get("format")
+	if format == "" {
+		format = exchange.FormatFromContentType(req.Header.Get("Content-Type"))
+	}
+	if format == "" {
+		validation.WriteError(res, http.StatusBadRequest, "формат не указан: передайте параметр format или заголовок Content-Type")
+		return
+	}
+
+	mode := params.Get("mode")
+	if mode == "" {
+		mode = exchange.ModeMerge
+	}
+	if mode != exchange.ModeMerge && mode != exchange.ModeReplace {
+		validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный режим %q, допустимые значения: merge, replace", mode))
+		return
+	}
+
+	metrics, err := exchange.Read(req.Body, format)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("ошибка при чтении метрик: %s", err.Error()))
+		return
+	}
+
+	// Пустой набор в режиме replace удалил бы все метрики хранилища.
+	if mode == exchange.ModeReplace && len(metrics) == 0 {
+		validation.WriteError(res, http.StatusBadRequest, "в режиме replace нужно передать хотя бы одну метрику")
+		return
+	}
+
+	var statusCode int
+	if mode == exchange.ModeReplace {
+		statusCode, err = server.controller.ReplaceMetrics(req.Context(), metrics)
+	} else if len(metrics) > 0 {
+		statusCode, err = server.controller.SaveMetrics(req.Context(), metrics)
+	}
+	if err != nil {
+		if statusCode == 0 {
+			statusCode = http.StatusInternalServerError
+		}
+		writeError(res, statusCode, err.Error())
+		return
+	}
+
+	server.saveSnapshot()
+
+	res.Header().Set("Content-Type", "application/json")
+	response := struct {
+		Mode     string `json:"mode"`
+		Imported int    `json:"imported"`
+	}{Mode: mode, Imported: len(metrics)}
+	if err = json.NewEncoder(res).Encode(response); err != nil {
+		err = fmt.Errorf("ошибка при заполнении ответа: %w", err)
+		server.logger.Error(err.Error())
+	}
+}
+
+// parseTime разбирает время в формате RFC 3339 или в секундах Unix.
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseStep разбирает длительность в формате time.ParseDuration или в секундах.
+func parseStep(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -4,22 +4,34 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"text/template"
+	"time"
 
-	"metrics/internal/authsign"
 	"metrics/internal/config"
 	"metrics/internal/constants"
 	"metrics/internal/controller"
+	"metrics/internal/cryptoutil"
+	"metrics/internal/dashboard"
 	"metrics/internal/filetransfer"
+	"metrics/internal/history"
+	"metrics/internal/labels"
+	"metrics/internal/lineprotocol"
 	"metrics/internal/models"
+	"metrics/internal/promexport"
+	"metrics/internal/snapshot"
+	"metrics/internal/validation"
 
 	"go.uber.org/zap"
 )
 
-const tplPath string = "templates/metrics.html"
+// Параметры страницы метрик: интервал истории для графиков и интервал автообновления по умолчанию в секундах.
+const (
+	dashboardHistoryWindow = time.Hour
+	dashboardRefresh       = 10
+)
 
 // ----------------------------------------------------------------------
 //fileWriter должен остаться в сервере? или перейти в контроллер?
@@ -31,6 +43,8 @@ type Server struct {
 	fileWriter *filetransfer.FileWriter
 	logger     *zap.Logger
 	controller *controller.Controller
+	snapshots  *snapshot.Store
+	keys       *cryptoutil.KeyRing
 }
 
 func NewServer(cfg *config.Config, fileWriter *filetransfer.FileWriter, logger *zap.Logger, controller *controller.Controller) *Server {
@@ -39,40 +53,25 @@ func NewServer(cfg *config.Config, fileWriter *filetransfer.FileWriter, logger *
 		fileWriter: fileWriter,
 		logger:     logger,
 		controller: controller,
+		snapshots:  snapshot.NewStore(cfg.Server.SnapshotDir),
 	}
 }
 
+// SetKeyRing подключает набор приватных ключей, который перезагружается через POST /admin/keys/reload.
+func (server *Server) SetKeyRing(keys *cryptoutil.KeyRing) {
+	server.keys = keys
+}
+
 // Обработка POST запроса на обновление метрик  в формате JSON.
 func (server *Server) HandleMetricUpdateViaJSON(res http.ResponseWriter, req *http.Request) {
 
-	receivedHash := req.Header.Get(constants.HeaderSig)
-	if receivedHash != "" {
-		buf := new(bytes.Buffer)
-		_, err := buf.ReadFrom(req.Body)
-		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		body := buf.Bytes()
-		if !authsign.VerifySig(receivedHash, []byte(body), []byte(server.config.SecretKey)) {
-			err = fmt.Errorf("invalid hash")
-			server.logger.Error(err.Error())
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
-		}
-	}
-	// ----------------------------------------------------------------------------------------------------------------------------------------------
-	// При наличии ключа на этапе формирования ответа сервер должен вычислять хеш и передавать его в HTTP-заголовке ответа с именем HashSHA256.
-	// Сервер должен отправлять тот же самый хэш? или новый в зависимости от ответа?
-	// ----------------------------------------------------------------------------------------------------------------------------------------------
-
 	var request models.Metrics
 
 	dec := json.NewDecoder(req.Body)
 	if err := dec.Decode(&request); err != nil {
 		err = fmt.Errorf("ошибка в JSON: %w", err)
 		server.logger.Error(err.Error())
-		res.WriteHeader(http.StatusInternalServerError)
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -81,7 +80,7 @@ func (server *Server) HandleMetricUpdateViaJSON(res http.ResponseWriter, req *ht
 		if statusCode == 0 {
 			statusCode = http.StatusInternalServerError
 		}
-		http.Error(res, err.Error(), statusCode)
+		writeError(res, statusCode, err.Error())
 		return
 	}
 
@@ -107,33 +106,22 @@ func (server *Server) HandleMetricUpdateViaJSON(res http.ResponseWriter, req *ht
 // Обработка POST запроса на обновление метрик без тела запроса.
 func (server *Server) HandleMetricUpdate(res http.ResponseWriter, req *http.Request) {
 
-	receivedHash := req.Header.Get(constants.HeaderSig)
-	if receivedHash != "" {
-		buf := new(bytes.Buffer)
-		_, err := buf.ReadFrom(req.Body)
-		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		body := buf.Bytes()
-		if !authsign.VerifySig(receivedHash, []byte(body), []byte(server.config.SecretKey)) {
-			err = fmt.Errorf("invalid hash")
-			server.logger.Error(err.Error())
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
-		}
-	}
-
 	metricType := req.PathValue("metricType")
 	metricName := req.PathValue("metricName")
 	metricValue := req.PathValue("metricValue")
 
-	statusCode, err := server.controller.UpdateMetricFromString(req.Context(), metricType, metricName, &metricValue)
+	metricLabels, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statusCode, err := server.controller.UpdateMetricFromString(req.Context(), metricType, metricName, metricLabels, &metricValue)
 	if err != nil {
 		if statusCode == 0 {
 			statusCode = http.StatusInternalServerError
 		}
-		http.Error(res, err.Error(), statusCode)
+		writeError(res, statusCode, err.Error())
 		return
 	}
 
@@ -144,8 +132,9 @@ func (server *Server) HandleMetricUpdate(res http.ResponseWriter, req *http.Requ
 	// ----------------------------------------------------------------------
 
 	responce := models.Metrics{
-		ID:    metricName,
-		MType: metricType,
+		ID:     metricName,
+		MType:  metricType,
+		Labels: metricLabels,
 	}
 
 	switch metricType {
@@ -179,29 +168,12 @@ func (server *Server) HandleMetricUpdate(res http.ResponseWriter, req *http.Requ
 // Обработка POST запроса на получение значения метрики с использование JSON формата в теле запроса.
 func (server *Server) HandleGetOneMetricViaJSON(res http.ResponseWriter, req *http.Request) {
 
-	receivedHash := req.Header.Get(constants.HeaderSig)
-	if receivedHash != "" {
-		buf := new(bytes.Buffer)
-		_, err := buf.ReadFrom(req.Body)
-		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		body := buf.Bytes()
-		if !authsign.VerifySig(receivedHash, []byte(body), []byte(server.config.SecretKey)) {
-			err = fmt.Errorf("invalid hash")
-			server.logger.Error(err.Error())
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
-		}
-	}
-
 	var request models.Metrics
 	dec := json.NewDecoder(req.Body)
 	if err := dec.Decode(&request); err != nil {
 		err = fmt.Errorf("ошибка в JSON: %w", err)
 		server.logger.Error(err.Error())
-		res.WriteHeader(http.StatusInternalServerError)
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -212,7 +184,7 @@ func (server *Server) HandleGetOneMetricViaJSON(res http.ResponseWriter, req *ht
 		if statusCode == 0 {
 			statusCode = http.StatusInternalServerError
 		}
-		http.Error(res, err.Error(), statusCode)
+		writeError(res, statusCode, err.Error())
 		return
 	}
 
@@ -233,16 +205,23 @@ func (server *Server) HandleGetOneMetric(res http.ResponseWriter, req *http.Requ
 
 	res.Header().Set("Content-Type", "text/plain")
 
+	metricLabels, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	data := models.Metrics{}
 	data.ID = req.PathValue("metricName")
 	data.MType = req.PathValue("metricType")
+	data.Labels = metricLabels
 
 	statusCode, err := server.controller.GetOneMetric(req.Context(), &data)
 	if err != nil {
 		if statusCode == 0 {
 			statusCode = http.StatusInternalServerError
 		}
-		http.Error(res, err.Error(), statusCode)
+		writeError(res, statusCode, err.Error())
 		return
 	}
 
@@ -253,36 +232,116 @@ func (server *Server) HandleGetOneMetric(res http.ResponseWriter, req *http.Requ
 	case constants.Counter:
 		res.WriteHeader(http.StatusOK)
 		res.Write([]byte(strconv.FormatInt(*data.Delta, 10)))
+	case constants.Histogram:
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		json.NewEncoder(res).Encode(data.Histogram)
 	}
 }
 
 // Обработка GET запроса на получение значений всех метрик.
 func (server *Server) HandleGetAllMetrics(res http.ResponseWriter, req *http.Request) {
 
-	res.Header().Set("Content-Type", "text/html")
+	matchers, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := req.Context()
+	now := time.Now()
+	from := now.Add(-dashboardHistoryWindow)
 
-	data := struct {
-		IntMap   map[string]int64
-		FloatMap map[string]float64
-	}{IntMap: server.controller.GetAllCounter(req.Context()), FloatMap: server.controller.GetAllGauge(req.Context())}
+	var page dashboard.Page
+	page.Generated = now
+	page.Refresh = dashboardRefresh
 
-	tmpl, err := template.ParseFiles(tplPath)
-	if err != nil {
-		err = fmt.Errorf("error parsing template: %w", err)
+	gauges := filterByLabels(server.controller.GetAllGauge(ctx), matchers)
+	gaugeHistory := server.dashboardHistory(req, constants.Gauge, mapKeys(gauges), from, now)
+	for key, value := range gauges {
+		page.Series = append(page.Series, dashboard.NewSeries(key, constants.Gauge, dashboard.FormatFloat(value), value, gaugeHistory[key]))
+	}
+	counters := filterByLabels(server.controller.GetAllCounter(ctx), matchers)
+	counterHistory := server.dashboardHistory(req, constants.Counter, mapKeys(counters), from, now)
+	for key, value := range counters {
+		page.Series = append(page.Series, dashboard.NewSeries(key, constants.Counter, strconv.FormatInt(value, 10), float64(value), counterHistory[key]))
+	}
+	for key, value := range filterByLabels(server.controller.GetAllHistogram(ctx), matchers) {
+		page.Series = append(page.Series, dashboard.NewSeries(key, constants.Histogram,
+			fmt.Sprintf("count=%d sum=%s", value.Count, dashboard.FormatFloat(value.Sum)), float64(value.Count), nil))
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-cache")
+
+	var buf bytes.Buffer
+	if err = dashboard.Render(&buf, page); err != nil {
+		err = fmt.Errorf("error executing template: %w", err)
 		server.logger.Error(err.Error())
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	err = tmpl.Execute(res, data)
+	res.WriteHeader(http.StatusOK)
+	res.Write(buf.Bytes())
+}
+
+// dashboardHistory возвращает истории серий keys для графиков на странице метрик, запрашивая их одним обращением к хранилищу:
+// последнее значение за каждую минуту, последняя точка - исходная, чтобы по ней определялось время последнего обновления.
+func (server *Server) dashboardHistory(req *http.Request, mtype string, keys []string, from, to time.Time) map[string][]models.Point {
+	if len(keys) == 0 {
+		return nil
+	}
+	ranges, err := server.controller.GetRanges(req.Context(), mtype, keys, from, to)
 	if err != nil {
-		err = fmt.Errorf("error executing template: %w", err)
+		return nil
+	}
+	for key, points := range ranges {
+		if len(points) == 0 {
+			continue
+		}
+		last := points[len(points)-1]
+		points = history.Downsample(points, from, time.Minute)
+		points[len(points)-1] = last
+		ranges[key] = points
+	}
+	return ranges
+}
+
+// mapKeys возвращает ключи metrics.
+func mapKeys[T any](metrics map[string]T) []string {
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Обработка GET запроса на получение значений всех метрик в формате Prometheus.
+func (server *Server) HandlePrometheusMetrics(res http.ResponseWriter, req *http.Request) {
+
+	matchers, err := labelMatchers(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res.Header().Set("Content-Type", promexport.ContentType)
+
+	skipped, err := promexport.Write(res,
+		filterByLabels(server.controller.GetAllCounter(req.Context()), matchers),
+		filterByLabels(server.controller.GetAllGauge(req.Context()), matchers),
+		filterByLabels(server.controller.GetAllHistogram(req.Context()), matchers),
+	)
+	if err != nil {
+		err = fmt.Errorf("ошибка при заполнении ответа: %w", err)
 		server.logger.Error(err.Error())
-		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	res.WriteHeader(http.StatusOK)
+	if len(skipped) > 0 {
+		server.logger.Warn("metrics skipped due to name collision after sanitizing", zap.Strings("metrics", skipped))
+	}
 }
 
 // Обработка GET запроса на проверку подключения к БД.
@@ -301,8 +360,19 @@ func (server *Server) HandlePing(res http.ResponseWriter, req *http.Request) {
 }
 
 // Обработка POST запроса на обновление метрик пакетом.
+// Параметр mode задает режим обработки пакета: atomic (по умолчанию) или best-effort (см. controller.UpdateMetrics).
+// В ответе возвращается models.UpdatesResponse со статусом и ошибкой для каждой метрики пакета.
 func (server *Server) HandleMetricUpdates(res http.ResponseWriter, req *http.Request) {
 
+	mode := req.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.UpdateModeAtomic
+	}
+	if mode != models.UpdateModeAtomic && mode != models.UpdateModeBestEffort {
+		validation.WriteError(res, http.StatusBadRequest, fmt.Sprintf("неверный режим %q, допустимые значения: atomic, best-effort", mode))
+		return
+	}
+
 	buf := new(bytes.Buffer)
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
@@ -311,16 +381,6 @@ func (server *Server) HandleMetricUpdates(res http.ResponseWriter, req *http.Req
 	}
 	body := buf.Bytes()
 
-	receivedHash := req.Header.Get(constants.HeaderSig)
-	if receivedHash != "" {
-		if !authsign.VerifySig(receivedHash, []byte(body), []byte(server.config.SecretKey)) {
-			err = fmt.Errorf("invalid hash")
-			server.logger.Error(err.Error())
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
-		}
-	}
-
 	var request []models.Metrics
 
 	// decoder := json.NewDecoder(req.Body)
@@ -328,28 +388,123 @@ func (server *Server) HandleMetricUpdates(res http.ResponseWriter, req *http.Req
 	if err = json.Unmarshal([]byte(body), &request); err != nil {
 		err = fmt.Errorf("ошибка в JSON: %w", err)
 		server.logger.Error(err.Error())
-		res.WriteHeader(http.StatusInternalServerError)
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if len(request) == 0 {
-		http.Error(res, "Empty batch", http.StatusBadRequest)
+		validation.WriteError(res, http.StatusBadRequest, "Empty batch")
 		return
 	}
 
-	statusCode, err := server.controller.SaveMetrics(req.Context(), request)
+	response, statusCode, err := server.controller.UpdateMetrics(req.Context(), request, mode)
 	if err != nil {
 		if statusCode == 0 {
 			statusCode = http.StatusInternalServerError
 		}
 		err = fmt.Errorf("ошибка при сохранении: %w", err)
 		server.logger.Error(err.Error())
-		http.Error(res, err.Error(), statusCode)
+		if statusCode == http.StatusBadRequest {
+			writeJSON(res, statusCode, response)
+			return
+		}
+		writeError(res, statusCode, err.Error())
 		return
 	}
 
-	res.Header().Set("Content-Type", "text/html")
-	res.WriteHeader(http.StatusOK)
-	res.Write([]byte("metrics have been updated"))
+	writeJSON(res, http.StatusOK, response)
+}
+
+// Обработка POST запроса на запись метрик в формате InfluxDB line protocol.
+// Все метрики пакета сохраняются в одной транзакции: при ошибке разбора хотя бы одной строки не сохраняется ничего.
+func (server *Server) HandleInfluxWrite(res http.ResponseWriter, req *http.Request) {
+
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body := buf.Bytes()
 
+	precision, err := lineprotocol.PrecisionMultiplier(req.URL.Query().Get("precision"))
+	if err != nil {
+		writeInfluxError(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	points, err := lineprotocol.Parse(body, precision)
+	if err != nil {
+		server.logger.Error(err.Error())
+		var parseErr *lineprotocol.ParseError
+		if errors.As(err, &parseErr) {
+			writeInfluxError(res, http.StatusBadRequest, err.Error(), parseErr.Lines())
+			return
+		}
+		writeInfluxError(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	metrics := lineprotocol.ToMetrics(points, time.Now())
+	if len(metrics) > 0 {
+		statusCode, err := server.controller.SaveMetrics(req.Context(), metrics)
+		if err != nil {
+			if statusCode == 0 {
+				statusCode = http.StatusInternalServerError
+			}
+			err = fmt.Errorf("ошибка при сохранении: %w", err)
+			server.logger.Error(err.Error())
+			writeInfluxError(res, statusCode, err.Error(), nil)
+			return
+		}
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Ответ с ошибкой в формате, который ожидают клиенты InfluxDB (например, Telegraf).
+func writeInfluxError(res http.ResponseWriter, statusCode int, message string, lines []int) {
+	code := "invalid"
+	if statusCode >= http.StatusInternalServerError {
+		code = "internal error"
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(statusCode)
+	json.NewEncoder(res).Encode(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Lines   []int  `json:"lines,omitempty"`
+	}{Code: code, Message: message, Lines: lines})
+}
+
+// writeError отправляет клиенту ошибку, полученную от контроллера.
+// Ошибки в данных запроса (400) отправляются в формате JSON, как и ошибки проверки в обработчиках.
+func writeError(res http.ResponseWriter, statusCode int, message string) {
+	if statusCode == http.StatusBadRequest {
+		validation.WriteError(res, statusCode, message)
+		return
+	}
+	http.Error(res, message, statusCode)
+}
+
+// labelMatchers возвращает метки, переданные в параметрах запроса в виде label=name=value.
+// Параметр label может быть указан несколько раз.
+func labelMatchers(req *http.Request) (map[string]string, error) {
+	return labels.ParseMatchers(req.URL.Query()["label"])
+}
+
+// filterByLabels оставляет только серии, метки которых удовлетворяют matchers.
+func filterByLabels[T any](metrics map[string]T, matchers map[string]string) map[string]T {
+	if len(matchers) == 0 {
+		return metrics
+	}
+
+	filtered := make(map[string]T)
+	for key, value := range metrics {
+		if labels.MatchKey(key, matchers) {
+			filtered[key] = value
+		}
+	}
+	return filtered
 }
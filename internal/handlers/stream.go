@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"metrics/internal/labels"
+	"metrics/internal/listing"
+	"metrics/internal/models"
+	"metrics/internal/pubsub"
+	"metrics/internal/validation"
+
+	"golang.org/x/net/websocket"
+)
+
+// Интервал отправки комментария keep-alive в потоке SSE, чтобы прокси не закрывали неактивное соединение.
+const streamKeepAlive = 15 * time.Second
+
+// Время на отправку одного сообщения WebSocket. Если клиент не читает сообщения, соединение закрывается,
+// а не блокирует обработчик.
+const streamWriteTimeout = 10 * time.Second
+
+// Обработка GET /api/v1/stream: поток обновлений метрик в формате Server-Sent Events.
+//
+// Каждое принятое обновление отправляется событием update, данные события - метрика в формате JSON
+// с текущим значением и временем обновления. Если клиент не успевает читать события, отправляется
+// событие dropped и поток завершается.
+//
+// Параметры запроса (фильтры, как в GET /api/v1/metrics):
+//
+//	type - тип метрики
+//	prefix, glob, regex - фильтры по имени метрики
+//	label - метка серии в виде name=value, может быть указан несколько раз
+func (server *Server) HandleStream(res http.ResponseWriter, req *http.Request) {
+	filter, err := streamFilter(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(res)
+
+	sub := server.controller.Subscribe(filter)
+	defer server.controller.Unsubscribe(sub)
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprint(res, ": connected\n\n")
+	if err = rc.Flush(); err != nil {
+		server.logger.Error("потоковая передача не поддерживается: " + err.Error())
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(res, ": keep-alive\n\n")
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Dropped() {
+					fmt.Fprint(res, "event: dropped\ndata: {}\n\n")
+					rc.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				server.logger.Error(fmt.Sprintf("ошибка при формировании события: %s", err.Error()))
+				continue
+			}
+			fmt.Fprintf(res, "event: update\ndata: %s\n\n", data)
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Обработка GET /api/v1/stream/ws: поток обновлений метрик через WebSocket.
+// Каждое сообщение - метрика в формате JSON, как в событиях GET /api/v1/stream. Параметры запроса те же.
+// Если клиент не успевает читать сообщения, соединение закрывается.
+func (server *Server) HandleStreamWebSocket(res http.ResponseWriter, req *http.Request) {
+	filter, err := streamFilter(req)
+	if err != nil {
+		validation.WriteError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ws := websocket.Server{
+		// Клиентами являются не только браузеры, поэтому заголовок Origin не проверяется.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			sub := server.controller.Subscribe(filter)
+			defer server.controller.Unsubscribe(sub)
+
+			// Сообщения клиента не используются, чтение нужно, чтобы узнать о закрытии соединения.
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var message []byte
+				for websocket.Message.Receive(conn, &message) == nil {
+				}
+			}()
+
+			for {
+				select {
+				case <-closed:
+					return
+				case event, ok := <-sub.Events():
+					if !ok {
+						return
+					}
+					if err := conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+						return
+					}
+					if err := websocket.JSON.Send(conn, event); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+	ws.ServeHTTP(res, req)
+}
+
+// streamFilter формирует фильтр подписки по параметрам запроса.
+func streamFilter(req *http.Request) (pubsub.Filter, error) {
+	params := req.URL.Query()
+	query := listing.Query{
+		Type:   params.Get("type"),
+		Prefix: params.Get("prefix"),
+		Glob:   params.Get("glob"),
+		Regex:  params.Get("regex"),
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	matchers, err := labelMatchers(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(metric models.Metrics) bool {
+		return query.Match(metric) && labels.Match(metric.Labels, matchers)
+	}, nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"metrics/internal/config"
+	"metrics/internal/controller"
+	"metrics/internal/storage/inmemory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+func newStreamTestServer(t *testing.T) (*controller.Controller, *httptest.Server) {
+	ctrl := controller.NewController(inmemory.NewMemStorage(), zap.NewNop())
+	server := NewServer(&config.Config{}, nil, zap.NewNop(), ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/stream", server.HandleStream)
+	mux.HandleFunc("/api/v1/stream/ws", server.HandleStreamWebSocket)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ctrl, ts
+}
+
+func TestHandleStream(t *testing.T) {
+	ctrl, ts := newStreamTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/stream?type=counter", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": connected\n", line)
+
+	value := "5"
+	_, err = ctrl.UpdateMetricFromString(ctx, "gauge", "Alloc", nil, &value)
+	require.NoError(t, err)
+	_, err = ctrl.UpdateMetricFromString(ctx, "counter", "PollCount", nil, &value)
+	require.NoError(t, err)
+	_, err = ctrl.UpdateMetricFromString(ctx, "counter", "PollCount", nil, &value)
+	require.NoError(t, err)
+
+	var events []string
+	for len(events) < 2 {
+		line, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, line)
+		}
+	}
+	assert.Contains(t, events[0], `"id":"PollCount","type":"counter","delta":5`)
+	assert.Contains(t, events[1], `"delta":10`)
+
+	resp, err = http.Get(ts.URL + "/api/v1/stream?regex=(")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandleStreamWebSocket(t *testing.T) {
+	ctrl, ts := newStreamTestServer(t)
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/v1/stream/ws?glob=All*", "", ts.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// подписка создается после установки соединения
+	require.Eventually(t, func() bool {
+		value := "1.5"
+		_, err := ctrl.UpdateMetricFromString(context.Background(), "gauge", "Alloc", nil, &value)
+		require.NoError(t, err)
+		var event map[string]any
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		return websocket.JSON.Receive(conn, &event) == nil && event["id"] == "Alloc" && event["value"] == 1.5
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/controller"
+	"metrics/internal/models"
+	"metrics/internal/storage/inmemory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestHandleMetricUpdates(t *testing.T) {
+	const batch = `[{"id":"c","type":"counter","delta":5},{"id":"","type":"gauge","value":1},{"id":"g","type":"gauge","value":2}]`
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		applied    int
+		statuses   []string
+	}{
+		{
+			name:       "atomic",
+			statusCode: http.StatusBadRequest,
+			statuses:   []string{models.UpdateStatusSkipped, models.UpdateStatusRejected, models.UpdateStatusSkipped},
+		},
+		{
+			name:       "best-effort",
+			query:      "?mode=best-effort",
+			statusCode: http.StatusOK,
+			applied:    2,
+			statuses:   []string{models.UpdateStatusOK, models.UpdateStatusRejected, models.UpdateStatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := controller.NewController(inmemory.NewMemStorage(), zap.NewNop())
+			server := NewServer(&config.Config{}, nil, zap.NewNop(), ctrl)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/"+tt.query, strings.NewReader(batch))
+			rec := httptest.NewRecorder()
+			server.HandleMetricUpdates(rec, req)
+
+			require.Equal(t, tt.statusCode, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var response models.UpdatesResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tt.applied, response.Applied)
+			assert.Equal(t, 1, response.Rejected)
+			require.Len(t, response.Results, len(tt.statuses))
+			for i, status := range tt.statuses {
+				assert.Equal(t, status, response.Results[i].Status)
+			}
+			assert.NotEmpty(t, response.Results[1].Error)
+
+			metric := models.Metrics{ID: "g", MType: "gauge"}
+			_, err := ctrl.GetOneMetric(context.Background(), &metric)
+			assert.Equal(t, tt.applied > 0, err == nil)
+		})
+	}
+
+	server := NewServer(&config.Config{}, nil, zap.NewNop(), controller.NewController(inmemory.NewMemStorage(), zap.NewNop()))
+	rec := httptest.NewRecorder()
+	server.HandleMetricUpdates(rec, httptest.NewRequest(http.MethodPost, "/updates/?mode=partial", strings.NewReader(batch)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleMetricUpdateViaJSON_Validation(t *testing.T) {
+	ctrl := controller.NewController(inmemory.NewMemStorage(), zap.NewNop())
+	server := NewServer(&config.Config{}, nil, zap.NewNop(), ctrl)
+
+	for _, body := range []string{
+		`{"id":"g","type":"gauge"}`,
+		`{"id":"c","type":"counter"}`,
+		`{"id":"` + strings.Repeat("a", 51) + `","type":"gauge","value":1}`,
+		`{"id":"a b","type":"gauge","value":1}`,
+		`{"id":"g","type":"gauge","value":1`,
+	} {
+		rec := httptest.NewRecorder()
+		server.HandleMetricUpdateViaJSON(rec, httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"), body)
+	}
+
+	value := "NaN"
+	statusCode, err := ctrl.UpdateMetricFromString(context.Background(), "gauge", "g", nil, &value)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+}
+
+func TestHandleHistogram(t *testing.T) {
+	ctrl := controller.NewController(inmemory.NewMemStorage(), zap.NewNop())
+	server := NewServer(&config.Config{Server: config.ServerConfig{StoreInterval: 300}}, nil, zap.NewNop(), ctrl)
+
+	rec := httptest.NewRecorder()
+	server.HandleMetricUpdateViaJSON(rec, httptest.NewRequest(http.MethodPost, "/update/",
+		strings.NewReader(`{"id":"h","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,0,0],"sum":0.5,"count":1}}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Границы корзин не совпадают с сохраненной гистограммой - ошибка клиента.
+	rec = httptest.NewRecorder()
+	server.HandleMetricUpdateViaJSON(rec, httptest.NewRequest(http.MethodPost, "/update/",
+		strings.NewReader(`{"id":"h","type":"histogram","histogram":{"bounds":[2],"counts":[1,0],"sum":1,"count":1}}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/value/histogram/h", nil)
+	req.SetPathValue("metricType", "histogram")
+	req.SetPathValue("metricName", "h")
+	rec = httptest.NewRecorder()
+	server.HandleGetOneMetric(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var h models.Histogram
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &h))
+	assert.Equal(t, int64(1), h.Count)
+}
+
+// updateConcurrently обновляет gauge и counter в отдельной горутине и возвращает функцию ожидания ее завершения.
+func updateConcurrently(ctrl *controller.Controller) (wait func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx := context.Background()
+		for i := 0; i < 500; i++ {
+			value := float64(i)
+			delta := int64(1)
+			ctrl.UpdateMetric(ctx, models.Metrics{ID: fmt.Sprintf("g%d", i), MType: constants.Gauge, Value: &value})
+			ctrl.UpdateMetric(ctx, models.Metrics{ID: fmt.Sprintf("c%d", i), MType: constants.Counter, Delta: &delta})
+		}
+	}()
+	return func() { <-done }
+}
+
+func TestHandlePrometheusMetrics_ConcurrentUpdates(t *testing.T) {
+	ctrl := controller.NewController(inmemory.NewMemStorage(), zap.NewNop())
+	server := NewServer(&config.Config{Server: config.ServerConfig{StoreInterval: 300}}, nil, zap.NewNop(), ctrl)
+
+	wait := updateConcurrently(ctrl)
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		server.HandlePrometheusMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	wait()
+}
+
+func TestHandleGetAllMetrics_ConcurrentUpdates(t *testing.T) {
+	ctrl := controller.NewController(inmemory.NewMemStorage(), zap.NewNop())
+	server := NewServer(&config.Config{Server: config.ServerConfig{StoreInterval: 300}}, nil, zap.NewNop(), ctrl)
+
+	wait := updateConcurrently(ctrl)
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		server.HandleGetAllMetrics(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	wait()
+}
+
+func TestHandleImport_MergeAtomic(t *testing.T) {
+	storage := inmemory.NewMemStorage()
+	ctrl := controller.NewController(storage, zap.NewNop())
+	server := NewServer(&config.Config{Server: config.ServerConfig{StoreInterval: 300}}, nil, zap.NewNop(), ctrl)
+
+	stored := models.Histogram{Bounds: []float64{1}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1}
+	require.NoError(t, storage.SetHistogram(context.Background(), "latency", &stored))
+
+	// последняя строка не совпадает по границам с сохраненной гистограммой
+	body := `{"id":"c","type":"counter","delta":5}
+{"id":"g","type":"gauge","value":2}
+{"id":"latency","type":"histogram","histogram":{"bounds":[5],"counts":[1,0],"sum":1,"count":1}}
+`
+	rec := httptest.NewRecorder()
+	server.HandleImport(rec, httptest.NewRequest(http.MethodPost, "/api/v1/import?format=ndjson", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	_, err := storage.GetCounter(context.Background(), "c")
+	assert.Error(t, err)
+	_, err = storage.GetGauge(context.Background(), "g")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+// В пакете histogram реализованы операции над значениями метрик типа histogram.
+package histogram
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"metrics/internal/models"
+)
+
+// ErrBoundsMismatch - границы корзин добавляемой гистограммы не совпадают с сохраненной.
+var ErrBoundsMismatch = errors.New("границы корзин гистограммы не совпадают")
+
+// New создает пустую гистограмму с указанными границами корзин.
+func New(bounds []float64) *models.Histogram {
+	return &models.Histogram{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe добавляет одно наблюдение в гистограмму.
+func Observe(h *models.Histogram, value float64) {
+	i := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[i]++
+	h.Sum += value
+	h.Count++
+}
+
+// Merge добавляет значения src к dst. Границы корзин гистограмм должны совпадать.
+func Merge(dst *models.Histogram, src models.Histogram) error {
+	if !slices.Equal(dst.Bounds, src.Bounds) {
+		return fmt.Errorf("%w: %v и %v", ErrBoundsMismatch, dst.Bounds, src.Bounds)
+	}
+	for i := range src.Counts {
+		dst.Counts[i] += src.Counts[i]
+	}
+	dst.Sum += src.Sum
+	dst.Count += src.Count
+	return nil
+}
+
+// Clone возвращает копию гистограммы.
+func Clone(h models.Histogram) models.Histogram {
+	h.Bounds = slices.Clone(h.Bounds)
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// Validate проверяет корректность гистограммы.
+func Validate(h *models.Histogram) error {
+	if h == nil {
+		return fmt.Errorf("значение гистограммы не заполнено")
+	}
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("граница корзины гистограммы должна быть конечным числом")
+		}
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return fmt.Errorf("границы корзин гистограммы должны строго возрастать")
+		}
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("количество корзин гистограммы должно быть на одну больше количества границ")
+	}
+
+	var total int64
+	for _, count := range h.Counts {
+		if count < 0 {
+			return fmt.Errorf("количество наблюдений в корзине не может быть отрицательным")
+		}
+		total += count
+	}
+	if total != h.Count {
+		return fmt.Errorf("количество наблюдений гистограммы (%d) не совпадает с суммой по корзинам (%d)", h.Count, total)
+	}
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("сумма наблюдений гистограммы должна быть конечным числом")
+	}
+	return nil
+}
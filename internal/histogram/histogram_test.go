@@ -0,0 +1,46 @@
+package histogram
+
+import (
+	"testing"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveAndMerge(t *testing.T) {
+	h := New([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 10, 11} {
+		Observe(h, v)
+	}
+	assert.Equal(t, []int64{2, 1, 1, 1}, h.Counts)
+	assert.Equal(t, int64(5), h.Count)
+	assert.Equal(t, 25.5, h.Sum)
+	require.NoError(t, Validate(h))
+
+	other := Clone(*h)
+	require.NoError(t, Merge(h, other))
+	assert.Equal(t, []int64{4, 2, 2, 2}, h.Counts)
+	assert.Equal(t, int64(10), h.Count)
+
+	assert.Error(t, Merge(h, *New([]float64{1, 2})))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    *models.Histogram
+	}{
+		{name: "nil", h: nil},
+		{name: "unsorted bounds", h: &models.Histogram{Bounds: []float64{2, 1}, Counts: []int64{0, 0, 0}}},
+		{name: "wrong counts length", h: &models.Histogram{Bounds: []float64{1}, Counts: []int64{0}}},
+		{name: "negative count", h: &models.Histogram{Bounds: []float64{1}, Counts: []int64{-1, 1}}},
+		{name: "count mismatch", h: &models.Histogram{Bounds: []float64{1}, Counts: []int64{1, 1}, Count: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, Validate(tt.h))
+		})
+	}
+}
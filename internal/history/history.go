@@ -0,0 +1,97 @@
+// В пакете history реализовано хранение истории значений метрик в памяти и выборка значений за период.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"metrics/internal/models"
+)
+
+// Ring - кольцевой буфер точек одной серии. При заполнении буфера новые точки вытесняют самые старые.
+type Ring struct {
+	points []models.Point
+	start  int
+	size   int
+	m      sync.RWMutex
+}
+
+func NewRing(capacity int) *Ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring{points: make([]models.Point, capacity)}
+}
+
+// Add добавляет точку в конец буфера. Точки должны добавляться в порядке возрастания времени.
+func (r *Ring) Add(point models.Point) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	end := (r.start + r.size) % len(r.points)
+	r.points[end] = point
+	if r.size < len(r.points) {
+		r.size++
+	} else {
+		r.start = (r.start + 1) % len(r.points)
+	}
+}
+
+// Range возвращает точки, время которых лежит в интервале [from, to], в порядке возрастания времени.
+func (r *Ring) Range(from, to time.Time) []models.Point {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	points := []models.Point{}
+	for i := range r.size {
+		point := r.points[(r.start+i)%len(r.points)]
+		if point.Time.Before(from) || point.Time.After(to) {
+			continue
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// RemoveBefore удаляет из буфера точки, время которых раньше t, и возвращает их в порядке возрастания времени.
+func (r *Ring) RemoveBefore(t time.Time) []models.Point {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	removed := []models.Point{}
+	for r.size > 0 && r.points[r.start].Time.Before(t) {
+		removed = append(removed, r.points[r.start])
+		r.points[r.start] = models.Point{}
+		r.start = (r.start + 1) % len(r.points)
+		r.size--
+	}
+	return removed
+}
+
+// Len возвращает количество точек в буфере.
+func (r *Ring) Len() int {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.size
+}
+
+// Downsample разбивает интервал, начинающийся с from, на отрезки длиной step и оставляет
+// для каждого отрезка последнее значение. Время точки - начало отрезка.
+// Отрезки без точек пропускаются. Если step не больше нуля, точки возвращаются без изменений.
+// Точки должны быть упорядочены по времени.
+func Downsample(points []models.Point, from time.Time, step time.Duration) []models.Point {
+	if step <= 0 || len(points) == 0 {
+		return points
+	}
+
+	result := []models.Point{}
+	for _, point := range points {
+		bucket := from.Add(point.Time.Sub(from).Truncate(step))
+		if n := len(result); n > 0 && result[n-1].Time.Equal(bucket) {
+			result[n-1].Value = point.Value
+			continue
+		}
+		result = append(result, models.Point{Time: bucket, Value: point.Value})
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	ring := NewRing(3)
+	for i := range 5 {
+		ring.Add(models.Point{Time: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+
+	assert.Equal(t, 3, ring.Len())
+
+	points := ring.Range(start, start.Add(time.Hour))
+	assert.Equal(t, []float64{2, 3, 4}, values(points))
+
+	points = ring.Range(start.Add(3*time.Second), start.Add(3*time.Second))
+	assert.Equal(t, []float64{3}, values(points))
+}
+
+func TestDownsample(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	points := []models.Point{
+		{Time: start.Add(1 * time.Second), Value: 1},
+		{Time: start.Add(8 * time.Second), Value: 2},
+		{Time: start.Add(25 * time.Second), Value: 3},
+	}
+
+	result := Downsample(points, start, 10*time.Second)
+	assert.Equal(t, []models.Point{
+		{Time: start, Value: 2},
+		{Time: start.Add(20 * time.Second), Value: 3},
+	}, result)
+
+	assert.Equal(t, points, Downsample(points, start, 0))
+}
+
+func values(points []models.Point) []float64 {
+	result := make([]float64, 0, len(points))
+	for _, point := range points {
+		result = append(result, point.Value)
+	}
+	return result
+}
+
+func TestRing_RemoveBefore(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	ring := NewRing(4)
+	for i := range 6 {
+		ring.Add(models.Point{Time: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+
+	removed := ring.RemoveBefore(start.Add(4 * time.Second))
+	assert.Equal(t, []float64{2, 3}, values(removed))
+	assert.Equal(t, []float64{4, 5}, values(ring.Range(start, start.Add(time.Hour))))
+
+	ring.Add(models.Point{Time: start.Add(6 * time.Second), Value: 6})
+	assert.Equal(t, []float64{4, 5, 6}, values(ring.Range(start, start.Add(time.Hour))))
+}
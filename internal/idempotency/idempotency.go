@@ -0,0 +1,136 @@
+// В пакете idempotency реализована обработка заголовка Idempotency-Key.
+//
+// Агент передает уникальный ключ для каждого пакета метрик и повторяет его при повторной отправке пакета.
+// Сервер запоминает ключ и ответ на запрос на время ttl. Повторный запрос с тем же ключом не применяется
+// к хранилищу повторно: возвращается сохраненный ответ с заголовком Idempotent-Replayed: true.
+// Если запрос с тем же ключом еще обрабатывается, возвращается 409 Conflict. Резервирование ключа без сохраненного
+// ответа действует ClaimLease, а не ttl: если сервер остановился, не успев сохранить ответ, запрос можно повторить
+// с тем же ключом после истечения этого времени.
+// Ответы с кодом 5xx и 429 Too Many Requests не сохраняются, поэтому такой запрос можно повторить с тем же ключом.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"metrics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+	MaxKeyLength   = 255
+
+	// ClaimLease - время, в течение которого ключ считается занятым обрабатываемым запросом.
+	// Должно превышать время обработки самого долгого запроса.
+	ClaimLease = time.Minute
+)
+
+// Store - хранилище ключей (см. storage.Storage).
+type Store interface {
+	ClaimIdempotencyKey(ctx context.Context, key string, notBefore, leaseNotBefore time.Time) (result *models.IdempotencyResult, claimed bool, err error)
+	CompleteIdempotencyKey(ctx context.Context, key string, result models.IdempotencyResult) (err error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) (err error)
+}
+
+type Idempotency struct {
+	store  Store
+	ttl    time.Duration
+	lease  time.Duration
+	logger *zap.Logger
+}
+
+func NewIdempotencyMW(store Store, ttl time.Duration, logger *zap.Logger) *Idempotency {
+	return &Idempotency{
+		store:  store,
+		ttl:    ttl,
+		lease:  min(ClaimLease, ttl),
+		logger: logger,
+	}
+}
+
+// Deduplicate выполняет h не более одного раза для каждого ключа Idempotency-Key.
+// Запросы без заголовка передаются h без изменений.
+func (i *Idempotency) Deduplicate(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			h(w, r)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			http.Error(w, fmt.Sprintf("длина заголовка %s не может превышать %d символов", Header, MaxKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		// Ключ действует только для эндпоинта, на который был отправлен запрос.
+		key = r.URL.Path + " " + key
+
+		now := time.Now()
+		result, claimed, err := i.store.ClaimIdempotencyKey(r.Context(), key, now.Add(-i.ttl), now.Add(-i.lease))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			if result == nil {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "запрос с этим ключом идемпотентности еще обрабатывается", http.StatusConflict)
+				return
+			}
+			i.logger.Info("повторный запрос, возвращен сохраненный ответ", zap.String("key", key))
+			if result.ContentType != "" {
+				w.Header().Set("Content-Type", result.ContentType)
+			}
+			w.Header().Set(HeaderReplayed, "true")
+			w.WriteHeader(result.StatusCode)
+			w.Write(result.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		h(recorder, r)
+
+		// Ответ сохраняется, даже если клиент уже закрыл соединение: именно в этом случае он повторит запрос.
+		ctx := context.WithoutCancel(r.Context())
+		if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusTooManyRequests {
+			i.store.ReleaseIdempotencyKey(ctx, key)
+			return
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		i.store.CompleteIdempotencyKey(ctx, key, models.IdempotencyResult{
+			StatusCode:  recorder.status,
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+	}
+}
+
+// responseRecorder передает ответ клиенту и запоминает код и тело ответа.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
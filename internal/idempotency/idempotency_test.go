@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"metrics/internal/storage/inmemory"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIdempotency_Deduplicate(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok":true}`))
+	}
+
+	mw := NewIdempotencyMW(inmemory.NewMemStorage(), time.Hour, zap.NewNop())
+	h := mw.Deduplicate(handler)
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	rec := do("a")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderReplayed))
+
+	rec = do("a")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `{"ok":true}`, rec.Body.String())
+	assert.Equal(t, 1, calls)
+
+	do("")
+	do("")
+	assert.Equal(t, 3, calls)
+
+	// Ответ 5xx не сохраняется: запрос с тем же ключом выполняется повторно.
+	status = http.StatusInternalServerError
+	do("b")
+	status = http.StatusOK
+	rec = do("b")
+	assert.Empty(t, rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, 5, calls)
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	store := inmemory.NewMemStorage()
+	mw := NewIdempotencyMW(store, time.Hour, zap.NewNop())
+
+	var inner *httptest.ResponseRecorder
+	h := mw.Deduplicate(func(w http.ResponseWriter, r *http.Request) {
+		// Пока обрабатывается первый запрос, второй с тем же ключом отклоняется.
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.Header.Set(Header, "a")
+		inner = httptest.NewRecorder()
+		mw.Deduplicate(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("повторный запрос не должен выполняться")
+		})(inner, req)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.Header.Set(Header, "a")
+	h(httptest.NewRecorder(), req)
+
+	assert.Equal(t, http.StatusConflict, inner.Code)
+	assert.Equal(t, "1", inner.Header().Get("Retry-After"))
+}
+
+func TestIdempotency_StaleClaim(t *testing.T) {
+	store := inmemory.NewMemStorage()
+	mw := NewIdempotencyMW(store, time.Hour, zap.NewNop())
+
+	// Ключ зарезервирован запросом, ответ на который так и не был сохранен.
+	now := time.Now()
+	_, claimed, err := store.ClaimIdempotencyKey(context.Background(), "/updates/ a", now.Add(-time.Hour), now.Add(-ClaimLease))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	calls := 0
+	h := mw.Deduplicate(func(w http.ResponseWriter, r *http.Request) { calls++ })
+	do := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.Header.Set(Header, "a")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusConflict, do())
+
+	mw.lease = -time.Second
+	assert.Equal(t, http.StatusOK, do())
+	assert.Equal(t, 1, calls)
+
+	// Сохраненный ответ действует ttl, а не время резервирования.
+	assert.Equal(t, http.StatusOK, do())
+	assert.Equal(t, 1, calls)
+}
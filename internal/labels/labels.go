@@ -0,0 +1,181 @@
+// В пакете labels реализована работа с метками (labels) метрик.
+//
+// Серия метрики однозначно определяется именем и набором меток. Для хранения серия представляется
+// ключом в формате Prometheus: name{label1="value1",label2="value2"}, где метки упорядочены по имени.
+// Метрика без меток представляется ключом, совпадающим с ее именем.
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SeriesKey возвращает ключ серии для имени метрики и набора меток.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	return name + "{" + Format(labels) + "}"
+}
+
+// SplitSeriesKey разбирает ключ серии на имя метрики и метки.
+// Если ключ не содержит корректного набора меток, то он целиком считается именем метрики.
+func SplitSeriesKey(key string) (name string, labels map[string]string) {
+	start := strings.IndexByte(key, '{')
+	if start <= 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+
+	labels, err := Parse(key[start+1 : len(key)-1])
+	if err != nil {
+		return key, nil
+	}
+	return key[:start], labels
+}
+
+// Format возвращает метки в виде label1="value1",label2="value2", упорядоченные по имени метки.
+func Format(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escape(labels[name]))
+		sb.WriteByte('"')
+	}
+	return sb.String()
+}
+
+// Parse разбирает метки в формате label1="value1",label2="value2".
+func Parse(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, fmt.Errorf("неверный формат меток: %q", s)
+		}
+		name := s[:eq]
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+
+		var value strings.Builder
+		i := eq + 2
+		closed := false
+		for ; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if s[i] == '"' {
+				closed = true
+				break
+			}
+			value.WriteByte(s[i])
+		}
+		if !closed {
+			return nil, fmt.Errorf("неверный формат меток: не закрыта кавычка в значении метки %s", name)
+		}
+		labels[name] = value.String()
+
+		s = s[i+1:]
+		if s != "" {
+			if s[0] != ',' {
+				return nil, fmt.Errorf("неверный формат меток: ожидается ',' после метки %s", name)
+			}
+			s = s[1:]
+		}
+	}
+
+	return labels, nil
+}
+
+// ValidateName проверяет, что имя метки соответствует правилам Prometheus: [a-zA-Z_][a-zA-Z0-9_]*.
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("имя метки не заполнено")
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf("недопустимое имя метки %q", name)
+		}
+	}
+	return nil
+}
+
+// Validate проверяет имена всех меток.
+func Validate(labels map[string]string) error {
+	for name := range labels {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseMatchers разбирает условия фильтрации вида label=value (например, из параметров запроса ?label=cpu=3).
+func ParseMatchers(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	matchers := make(map[string]string, len(values))
+	for _, value := range values {
+		name, labelValue, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("неверный формат фильтра по метке %q, ожидается label=value", value)
+		}
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+		matchers[name] = labelValue
+	}
+	return matchers, nil
+}
+
+// Match проверяет, что метки серии содержат все метки из matchers с теми же значениями.
+func Match(labels map[string]string, matchers map[string]string) bool {
+	for name, value := range matchers {
+		if labelValue, ok := labels[name]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchKey проверяет, что метки серии с ключом key удовлетворяют matchers.
+func MatchKey(key string, matchers map[string]string) bool {
+	if len(matchers) == 0 {
+		return true
+	}
+	_, labels := SplitSeriesKey(key)
+	return Match(labels, matchers)
+}
+
+func escape(value string) string {
+	if !strings.ContainsAny(value, "\\\"\n") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
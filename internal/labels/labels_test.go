@@ -0,0 +1,42 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	labels := map[string]string{"host": "srv\"1", "cpu": "3"}
+	key := SeriesKey("CPUutilization", labels)
+	assert.Equal(t, `CPUutilization{cpu="3",host="srv\"1"}`, key)
+
+	name, parsed := SplitSeriesKey(key)
+	assert.Equal(t, "CPUutilization", name)
+	assert.Equal(t, labels, parsed)
+
+	assert.Equal(t, "Alloc", SeriesKey("Alloc", nil))
+	name, parsed = SplitSeriesKey("Alloc")
+	assert.Equal(t, "Alloc", name)
+	assert.Nil(t, parsed)
+
+	name, parsed = SplitSeriesKey("broken{cpu=3}")
+	assert.Equal(t, "broken{cpu=3}", name)
+	assert.Nil(t, parsed)
+}
+
+func TestParseMatchers(t *testing.T) {
+	matchers, err := ParseMatchers([]string{"cpu=3", "host="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cpu": "3", "host": ""}, matchers)
+
+	assert.True(t, MatchKey(`CPUutilization{cpu="3",host=""}`, matchers))
+	assert.False(t, MatchKey(`CPUutilization{cpu="3"}`, matchers))
+	assert.True(t, MatchKey("Alloc", nil))
+
+	_, err = ParseMatchers([]string{"cpu"})
+	assert.Error(t, err)
+	_, err = ParseMatchers([]string{"1cpu=3"})
+	assert.Error(t, err)
+}
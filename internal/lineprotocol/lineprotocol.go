@@ -0,0 +1,290 @@
+// В пакете lineprotocol реализован разбор метрик в формате InfluxDB line protocol.
+//
+// Каждая строка имеет вид:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Каждое поле преобразуется в метрику с именем measurement_field: поля с суффиксом i (целые числа)
+// становятся метриками типа counter, остальные числовые и логические поля - метриками типа gauge.
+// Строковые поля пропускаются. Теги строки становятся метками (labels) каждой из ее метрик.
+package lineprotocol
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics/internal/constants"
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+// Point - одна строка line protocol.
+type Point struct {
+	Line        int // номер строки в теле запроса, начиная с 1
+	Measurement string
+	Tags        map[string]string
+	Fields      []models.Metrics
+	Time        time.Time // нулевое значение, если метка времени не передана
+}
+
+// LineError - ошибка разбора одной строки.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("строка %d: %s", e.Line, e.Err)
+}
+
+// ParseError содержит ошибки всех строк, которые не удалось разобрать.
+type ParseError struct {
+	Errors []LineError
+}
+
+func (e *ParseError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, lineErr := range e.Errors {
+		messages = append(messages, lineErr.Error())
+	}
+	return "ошибка разбора line protocol: " + strings.Join(messages, "; ")
+}
+
+// Lines возвращает номера строк с ошибками.
+func (e *ParseError) Lines() []int {
+	lines := make([]int, 0, len(e.Errors))
+	for _, lineErr := range e.Errors {
+		lines = append(lines, lineErr.Line)
+	}
+	return lines
+}
+
+// PrecisionMultiplier возвращает длительность одной единицы метки времени для параметра precision.
+// Поддерживаются значения InfluxDB v1 (n, u, ms, s, m, h) и v2 (ns, us, ms, s). По умолчанию - наносекунды.
+func PrecisionMultiplier(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µ":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("неизвестное значение precision: %s", precision)
+	}
+}
+
+// Parse разбирает тело запроса. Если хотя бы одна строка не разобрана, возвращается *ParseError
+// со списком всех ошибочных строк.
+func Parse(body []byte, precision time.Duration) ([]Point, error) {
+	var points []Point
+	var parseErr ParseError
+
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := ParseLine(line, precision)
+		if err != nil {
+			parseErr.Errors = append(parseErr.Errors, LineError{Line: i + 1, Err: err})
+			continue
+		}
+		point.Line = i + 1
+		points = append(points, point)
+	}
+
+	if len(parseErr.Errors) > 0 {
+		return nil, &parseErr
+	}
+	return points, nil
+}
+
+// ParseLine разбирает одну строку line protocol.
+func ParseLine(line string, precision time.Duration) (point Point, err error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return point, fmt.Errorf("ожидается measurement, поля и необязательная метка времени")
+	}
+
+	series := split(sections[0], ',', false)
+	point.Measurement = unescape(series[0])
+	if point.Measurement == "" {
+		return point, fmt.Errorf("не заполнено имя measurement")
+	}
+
+	for _, tag := range series[1:] {
+		key, value, ok := cut(tag, '=')
+		if !ok || key == "" || value == "" {
+			return point, fmt.Errorf("неверный формат тега %q", tag)
+		}
+		if point.Tags == nil {
+			point.Tags = make(map[string]string)
+		}
+		point.Tags[unescape(key)] = unescape(value)
+	}
+	if err = labels.Validate(point.Tags); err != nil {
+		return point, err
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		key, value, ok := cut(field, '=')
+		if !ok || key == "" || value == "" {
+			return point, fmt.Errorf("неверный формат поля %q", field)
+		}
+
+		metric, skip, err := parseField(point.Measurement+"_"+unescape(key), value)
+		if err != nil {
+			return point, err
+		}
+		if !skip {
+			metric.Labels = point.Tags
+			point.Fields = append(point.Fields, metric)
+		}
+	}
+
+	if len(sections) == 3 {
+		timestamp, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return point, fmt.Errorf("неверный формат метки времени %q", sections[2])
+		}
+		// Время хранится в наносекундах int64 (около ±292 лет от 1970 года), большие значения при умножении переполнились бы.
+		if timestamp > math.MaxInt64/int64(precision) || timestamp < math.MinInt64/int64(precision) {
+			return point, fmt.Errorf("метка времени %q вне допустимого диапазона", sections[2])
+		}
+		point.Time = time.Unix(0, 0).Add(time.Duration(timestamp) * precision)
+	}
+
+	return point, nil
+}
+
+// ToMetrics преобразует точки в метрики. Точки упорядочиваются по времени, поэтому при нескольких значениях
+// одного gauge сохраняется самое позднее из них, а для counter приращения суммируются.
+// Точкам без метки времени присваивается время получения received, как это делает InfluxDB.
+func ToMetrics(points []Point, received time.Time) []models.Metrics {
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	for i := range sorted {
+		if sorted[i].Time.IsZero() {
+			sorted[i].Time = received
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	var metrics []models.Metrics
+	for _, point := range sorted {
+		metrics = append(metrics, point.Fields...)
+	}
+	return metrics
+}
+
+func parseField(name string, value string) (metric models.Metrics, skip bool, err error) {
+	metric.ID = name
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return metric, false, fmt.Errorf("неверный формат строкового поля %s", name)
+		}
+		return metric, true, nil
+	case strings.HasSuffix(value, "i"):
+		delta, err := strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		if err != nil {
+			return metric, false, fmt.Errorf("неверное целое значение поля %s: %s", name, value)
+		}
+		metric.MType = constants.Counter
+		metric.Delta = &delta
+		return metric, false, nil
+	case strings.HasSuffix(value, "u"):
+		unsigned, err := strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 64)
+		if err != nil {
+			return metric, false, fmt.Errorf("неверное беззнаковое значение поля %s: %s", name, value)
+		}
+		gauge := float64(unsigned)
+		metric.MType = constants.Gauge
+		metric.Value = &gauge
+		return metric, false, nil
+	}
+
+	var gauge float64
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		gauge = 1
+	case "f", "F", "false", "False", "FALSE":
+		gauge = 0
+	default:
+		gauge, err = strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(gauge) || math.IsInf(gauge, 0) {
+			return metric, false, fmt.Errorf("неверное значение поля %s: %s", name, value)
+		}
+	}
+
+	metric.MType = constants.Gauge
+	metric.Value = &gauge
+	return metric, false, nil
+}
+
+// split делит строку по неэкранированному разделителю. Если quotes = true, разделители внутри
+// двойных кавычек не учитываются.
+func split(s string, sep byte, quotes bool) []string {
+	var parts []string
+	var quoted bool
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cut делит строку по первому неэкранированному разделителю.
+func cut(s string, sep byte) (before, after string, found bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case ',', ' ', '=', '\\', '"':
+				i++
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package lineprotocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"metrics/internal/constants"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	point, err := ParseLine(`cpu\ load,host=srv\,1,region=eu usage_idle=92.5,procs=12i,up=t,note="a b, c" 1700000000`, time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, "cpu load", point.Measurement)
+	assert.Equal(t, map[string]string{"host": "srv,1", "region": "eu"}, point.Tags)
+	assert.Equal(t, time.Unix(1700000000, 0), point.Time)
+	require.Len(t, point.Fields, 3)
+
+	assert.Equal(t, "cpu load_usage_idle", point.Fields[0].ID)
+	assert.Equal(t, constants.Gauge, point.Fields[0].MType)
+	assert.Equal(t, 92.5, *point.Fields[0].Value)
+	assert.Equal(t, point.Tags, point.Fields[0].Labels)
+
+	assert.Equal(t, "cpu load_procs", point.Fields[1].ID)
+	assert.Equal(t, constants.Counter, point.Fields[1].MType)
+	assert.Equal(t, int64(12), *point.Fields[1].Delta)
+
+	assert.Equal(t, 1.0, *point.Fields[2].Value)
+}
+
+func TestParse_Errors(t *testing.T) {
+	body := "mem used=1\n\nmem used=abc\n# comment\nmem\nmem used=2 notatime\nmem used=3i"
+	_, err := Parse([]byte(body), time.Nanosecond)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, []int{3, 5, 6}, parseErr.Lines())
+
+	// Метка времени, которая не помещается в time.Duration, - ошибка строки, а не переполнение.
+	_, err = Parse([]byte("mem used=1 9300000000\nmem used=2 -200000000\nmem used=3 1700000000"), time.Second)
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, []int{1}, parseErr.Lines())
+	_, err = Parse([]byte("mem used=1 3000000"), time.Hour)
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, []int{1}, parseErr.Lines())
+}
+
+func TestToMetrics_OrderedByTime(t *testing.T) {
+	points, err := Parse([]byte("mem used=2 20\nmem used=1 10\nmem hits=1i\nmem hits=2i"), time.Nanosecond)
+	require.NoError(t, err)
+
+	metrics := ToMetrics(points, time.Unix(100, 0))
+	require.Len(t, metrics, 4)
+	assert.Equal(t, 2.0, *metrics[1].Value)
+
+	// Значение без метки времени получено позже всех точек с явными метками времени.
+	points, err = Parse([]byte("mem used=3\nmem used=1 10\nmem used=2 20"), time.Nanosecond)
+	require.NoError(t, err)
+
+	metrics = ToMetrics(points, time.Unix(100, 0))
+	require.Len(t, metrics, 3)
+	assert.Equal(t, 3.0, *metrics[2].Value)
+}
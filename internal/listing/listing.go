@@ -0,0 +1,174 @@
+// В пакете listing реализованы параметры выборки списка метрик для эндпоинта GET /api/v1/metrics:
+// фильтры по типу и имени, сортировка и постраничный вывод.
+//
+// Фильтры по имени применяются к имени метрики без меток:
+//   - prefix - имя начинается с указанной строки;
+//   - glob - имя целиком соответствует шаблону, где * - любая последовательность символов,
+//     ? - любой символ, [...] - класс символов ([!...] - отрицание);
+//   - regex - имя содержит совпадение с регулярным выражением (синтаксис RE2).
+//
+// Шаблон glob преобразуется в регулярное выражение, поэтому в памяти и в БД он обрабатывается одинаково.
+package listing
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"metrics/internal/constants"
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+// Допустимые значения параметра сортировки. Префикс '-' означает сортировку по убыванию.
+const (
+	SortName     = "name"
+	SortNameDesc = "-name"
+	SortType     = "type"
+	SortTypeDesc = "-type"
+)
+
+// Query - параметры выборки списка метрик.
+type Query struct {
+	Type   string
+	Prefix string
+	Glob   string
+	Regex  string
+	Sort   string
+	Limit  int // 0 - без ограничения
+	Offset int
+
+	globRe  *regexp.Regexp
+	regexRe *regexp.Regexp
+}
+
+// Validate проверяет параметры и компилирует шаблоны.
+func (q *Query) Validate() (err error) {
+	switch q.Type {
+	case "", constants.Gauge, constants.Counter, constants.Histogram:
+	default:
+		return fmt.Errorf("тип %s не поддерживается", q.Type)
+	}
+
+	switch q.Sort {
+	case "":
+		q.Sort = SortName
+	case SortName, SortNameDesc, SortType, SortTypeDesc:
+	default:
+		return fmt.Errorf("неверное значение сортировки %q", q.Sort)
+	}
+
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("limit и offset не могут быть отрицательными")
+	}
+
+	if q.Glob != "" {
+		if q.globRe, err = regexp.Compile(GlobToRegexp(q.Glob)); err != nil {
+			return fmt.Errorf("неверный шаблон glob %q: %w", q.Glob, err)
+		}
+	}
+	if q.Regex != "" {
+		if q.regexRe, err = regexp.Compile(q.Regex); err != nil {
+			return fmt.Errorf("неверное регулярное выражение %q: %w", q.Regex, err)
+		}
+	}
+	return nil
+}
+
+// Match проверяет, что метрика удовлетворяет фильтрам запроса. Запрос должен быть проверен методом Validate.
+func (q *Query) Match(metric models.Metrics) bool {
+	switch {
+	case q.Type != "" && metric.MType != q.Type:
+		return false
+	case q.Prefix != "" && !strings.HasPrefix(metric.ID, q.Prefix):
+		return false
+	case q.globRe != nil && !q.globRe.MatchString(metric.ID):
+		return false
+	case q.regexRe != nil && !q.regexRe.MatchString(metric.ID):
+		return false
+	}
+	return true
+}
+
+// Apply фильтрует, сортирует и ограничивает список метрик. Возвращает страницу и общее количество
+// метрик, удовлетворяющих фильтрам. Запрос должен быть проверен методом Validate.
+func (q *Query) Apply(metrics []models.Metrics) (page []models.Metrics, total int) {
+	filtered := make([]models.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if q.Match(metric) {
+			filtered = append(filtered, metric)
+		}
+	}
+
+	// Порядок совпадает с ORDER BY ... COLLATE "C" в PostgresStorage.
+	sortKey := func(metric models.Metrics) []string {
+		if q.Sort == SortType || q.Sort == SortTypeDesc {
+			return []string{metric.MType, metric.ID, labels.Format(metric.Labels)}
+		}
+		return []string{metric.ID, labels.Format(metric.Labels), metric.MType}
+	}
+	desc := strings.HasPrefix(q.Sort, "-")
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := sortKey(filtered[i]), sortKey(filtered[j])
+		if desc {
+			a, b = b, a
+		}
+		return slices.Compare(a, b) < 0
+	})
+
+	total = len(filtered)
+	start := min(q.Offset, total)
+	end := total
+	if q.Limit > 0 {
+		end = min(start+q.Limit, total)
+	}
+
+	return filtered[start:end], total
+}
+
+// GlobToRegexp преобразует шаблон glob в регулярное выражение, совпадающее с именем целиком.
+// Выражение использует только конструкции, одинаково понимаемые RE2 и PostgreSQL.
+func GlobToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteByte('^')
+	inClass, skip := false, false
+	for i, r := range glob {
+		if skip {
+			skip = false
+			continue
+		}
+		switch {
+		case inClass:
+			if r == ']' {
+				inClass = false
+			}
+			if r == '\\' {
+				sb.WriteString(`\\`)
+				continue
+			}
+			sb.WriteRune(r)
+		case r == '*':
+			sb.WriteString(".*")
+		case r == '?':
+			sb.WriteByte('.')
+		case r == '[':
+			inClass = true
+			sb.WriteRune(r)
+			if strings.HasPrefix(glob[i+1:], "!") {
+				sb.WriteByte('^')
+				skip = true
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteByte('$')
+	return sb.String()
+}
+
+// EscapeLike экранирует спецсимволы шаблона LIKE (символ экранирования - '\').
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,68 @@
+package listing
+
+import (
+	"regexp"
+	"testing"
+
+	"metrics/internal/constants"
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		name  string
+		match bool
+	}{
+		{glob: "Heap*", name: "HeapAlloc", match: true},
+		{glob: "Heap*", name: "MHeap", match: false},
+		{glob: "CPU?", name: "CPU1", match: true},
+		{glob: "a.b", name: "axb", match: false},
+		{glob: "Gauge[0-9]", name: "Gauge7", match: true},
+		{glob: "Gauge[!0-9]", name: "Gauge7", match: false},
+		{glob: "Gauge[!0-9]", name: "GaugeX", match: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+"/"+tt.name, func(t *testing.T) {
+			re := regexp.MustCompile(GlobToRegexp(tt.glob))
+			assert.Equal(t, tt.match, re.MatchString(tt.name))
+		})
+	}
+}
+
+func TestQuery_Apply(t *testing.T) {
+	metrics := []models.Metrics{
+		{ID: "HeapAlloc", MType: constants.Gauge},
+		{ID: "PollCount", MType: constants.Counter},
+		{ID: "HeapSys", MType: constants.Gauge},
+		{ID: "CPUutilization", MType: constants.Gauge, Labels: map[string]string{"cpu": "2"}},
+		{ID: "CPUutilization", MType: constants.Gauge, Labels: map[string]string{"cpu": "1"}},
+	}
+
+	q := Query{Type: constants.Gauge, Sort: SortNameDesc, Limit: 2, Offset: 1}
+	require.NoError(t, q.Validate())
+	page, total := q.Apply(metrics)
+	assert.Equal(t, 4, total)
+	require.Len(t, page, 2)
+	assert.Equal(t, "HeapAlloc", page[0].ID)
+	assert.Equal(t, "2", page[1].Labels["cpu"])
+
+	q = Query{Prefix: "Heap", Regex: "Sys$"}
+	require.NoError(t, q.Validate())
+	page, total = q.Apply(metrics)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "HeapSys", page[0].ID)
+
+	q = Query{Sort: SortType, Offset: 10}
+	require.NoError(t, q.Validate())
+	page, total = q.Apply(metrics)
+	assert.Equal(t, 5, total)
+	assert.Empty(t, page)
+
+	assert.Error(t, (&Query{Regex: "("}).Validate())
+	assert.Error(t, (&Query{Sort: "value"}).Validate())
+	assert.Error(t, (&Query{Type: "summary"}).Validate())
+}
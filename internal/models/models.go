@@ -1,20 +1,152 @@
 // В пакете models хранятся структуры для работы с данными.
 package models
 
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"metrics/internal/constants"
+)
+
+// Ошибки хранилища, по которым определяется код ответа сервера.
+var (
+	ErrMetricNotFound = errors.New("метрика не найдена")
+	ErrMetricExists   = errors.New("метрика уже существует")
+)
+
 // Структура используется сервером для получения данных от агента
 type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID        string            `json:"id"`                  // имя метрики
+	MType     string            `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+	Delta     *int64            `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64          `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *Histogram        `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Labels    map[string]string `json:"labels,omitempty"`    // метки метрики, входят в идентификатор серии вместе с именем
 }
 
 // Структура используется агентом для сбора и отправки данных на сервер
 type MetricsForSend struct {
-	ID    string  `json:"id"`              // имя метрики
-	MType string  `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID        string            `json:"id"`                  // имя метрики
+	MType     string            `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+	Delta     int64             `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     float64           `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *Histogram        `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Labels    map[string]string `json:"labels,omitempty"`    // метки метрики, входят в идентификатор серии вместе с именем
+}
+
+// MarshalJSON передает значение, соответствующее типу метрики (value для gauge, delta для counter),
+// в том числе нулевое: сервер отклоняет gauge без value и counter без delta.
+func (m MetricsForSend) MarshalJSON() ([]byte, error) {
+	metric := Metrics{ID: m.ID, MType: m.MType, Histogram: m.Histogram, Labels: m.Labels}
+	switch m.MType {
+	case constants.Gauge:
+		metric.Value = &m.Value
+	case constants.Counter:
+		metric.Delta = &m.Delta
+	}
+	return json.Marshal(metric)
+}
+
+// Значение метрики типа histogram.
+// Как и counter, histogram накапливается на сервере: при обновлении количество наблюдений в корзинах, сумма и количество складываются.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы корзин по возрастанию (включительно), корзина +Inf не указывается
+	Counts []int64   `json:"counts"` // количество наблюдений в каждой корзине, на одно значение больше, чем границ (последнее - корзина +Inf)
+	Sum    float64   `json:"sum"`    // сумма всех наблюдений
+	Count  int64     `json:"count"`  // количество всех наблюдений
+}
+
+// Point - значение метрики в момент времени, записанное в историю сервером.
+// Для counter сохраняется накопленное значение после обновления.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// MetricsList - страница списка метрик, возвращаемая эндпоинтом GET /api/v1/metrics.
+type MetricsList struct {
+	Total   int       `json:"total"` // количество метрик, удовлетворяющих фильтрам, без учета limit и offset
+	Metrics []Metrics `json:"metrics"`
+}
+
+// Aggregate - свертка точек истории за интервал (минуту или час), начинающийся в Time.
+type Aggregate struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Last  float64   `json:"last"`
+	Count int64     `json:"count"` // количество исходных точек
+}
+
+// Series - история значений серии, возвращаемая эндпоинтом GET /api/v1/range.
+// В зависимости от запрошенного разрешения заполняется Points (исходные точки) или Aggregates.
+type Series struct {
+	ID         string            `json:"id"`
+	MType      string            `json:"type"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Resolution string            `json:"resolution,omitempty"`
+	Points     []Point           `json:"points,omitempty"`
+	Aggregates []Aggregate       `json:"aggregates,omitempty"`
+}
+
+// Политика хранения истории в JSON-конфигурации сервера (см. пакет retention).
+// Длительности задаются в формате time.ParseDuration, например "24h".
+type RetentionPolicy struct {
+	Pattern string `json:"pattern"` // шаблон имени метрики, например "CPU*"
+	Raw     string `json:"raw"`     // срок хранения исходных точек
+	Minute  string `json:"minute"`  // срок хранения минутных агрегатов
+	Hour    string `json:"hour"`    // срок хранения часовых агрегатов
+}
+
+// Правило оповещения в JSON-конфигурации сервера (см. пакет alerting).
+type AlertRule struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"` // например "HeapAlloc > 500MB for 2m" или "rate(PollCount) == 0 for 1m"
+}
+
+// Настройки оповещений в JSON-конфигурации сервера.
+type AlertsConfig struct {
+	Rules    []AlertRule `json:"rules"`
+	Webhooks []string    `json:"webhooks"` // адреса, на которые отправляются оповещения
+	Interval string      `json:"interval"` // интервал проверки правил по таймеру, например "15s"
+}
+
+// Режимы обработки пакета метрик в POST /updates/?mode=.
+const (
+	UpdateModeAtomic     = "atomic"      // пакет сохраняется целиком или не сохраняется вовсе
+	UpdateModeBestEffort = "best-effort" // сохраняются корректные метрики пакета, некорректные пропускаются
+)
+
+// Статусы метрик пакета в ответе POST /updates/.
+const (
+	UpdateStatusOK       = "ok"       // метрика сохранена
+	UpdateStatusRejected = "rejected" // метрика не прошла проверку
+	UpdateStatusSkipped  = "skipped"  // метрика корректна, но не сохранена, так как пакет отклонен целиком
+)
+
+// UpdateResult - результат обработки одной метрики пакета.
+type UpdateResult struct {
+	ID     string `json:"id"`
+	MType  string `json:"type"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UpdatesResponse - ответ на POST /updates/. Results содержит результаты в порядке метрик запроса.
+type UpdatesResponse struct {
+	Mode     string         `json:"mode"`
+	Applied  int            `json:"applied"`
+	Rejected int            `json:"rejected"`
+	Results  []UpdateResult `json:"results"`
+}
+
+// Сохраненный ответ на запрос с заголовком Idempotency-Key. Возвращается на повторные запросы с тем же ключом.
+type IdempotencyResult struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
 }
 
 // Конфигурации сервера с помощью файла в формате JSON
@@ -25,12 +157,34 @@ type JSONConfigServer struct {
 	StoreFile     string `json:"store_file"`     // аналог переменной окружения STORE_FILE или -f
 	DatabaseDSN   string `json:"database_dsn"`   // аналог переменной окружения DATABASE_DSN или флага -d
 	CryptoKey     string `json:"crypto_key"`     // аналог переменной окружения CRYPTO_KEY или флага -crypto-key
+	GRPCAddress   string `json:"grpc_address"`   // аналог переменной окружения GRPC_ADDRESS или флага -g
+	StatsDAddress string `json:"statsd_address"` // аналог переменной окружения STATSD_ADDRESS или флага -statsd-address
+	HistorySize   int    `json:"history_size"`   // аналог переменной окружения HISTORY_SIZE или флага -history-size
+
+	RetentionInterval string            `json:"retention_interval"` // аналог переменной окружения RETENTION_INTERVAL или флага -retention-interval
+	Retention         []RetentionPolicy `json:"retention"`          // политики хранения истории
+	AdminToken        string            `json:"admin_token"`        // аналог переменной окружения ADMIN_TOKEN или флага -admin-token
+	SnapshotDir       string            `json:"snapshot_dir"`       // аналог переменной окружения SNAPSHOT_DIR или флага -snapshot-dir
+	IdempotencyTTL    string            `json:"idempotency_ttl"`    // аналог переменной окружения IDEMPOTENCY_TTL или флага -idempotency-ttl
+	Alerts            AlertsConfig      `json:"alerts"`             // правила оповещений
+	RateLimitRPS      float64           `json:"rate_limit_rps"`     // аналог переменной окружения RATE_LIMIT_RPS или флага -rate-limit-rps
+	RateLimitMetrics  int               `json:"rate_limit_metrics"` // аналог переменной окружения RATE_LIMIT_METRICS или флага -rate-limit-metrics
+	TrustedSubnet     string            `json:"trusted_subnet"`     // аналог переменной окружения TRUSTED_SUBNET или флага -t
+	SignatureSkew     string            `json:"signature_skew"`     // аналог переменной окружения SIGNATURE_SKEW или флага -signature-skew
+	LegacySignature   bool              `json:"legacy_signature"`   // аналог переменной окружения LEGACY_SIGNATURE или флага -legacy-signature
+	TLSCert           string            `json:"tls_cert"`           // аналог переменной окружения TLS_CERT или флага -tls-cert
+	TLSKey            string            `json:"tls_key"`            // аналог переменной окружения TLS_KEY или флага -tls-key
+	TLSClientCA       string            `json:"tls_client_ca"`      // аналог переменной окружения TLS_CLIENT_CA или флага -tls-client-ca
 }
 
 // Конфигурации агента с помощью файла в формате JSON
 type JSONConfigAgent struct {
-	Address        string `json:"address"`         // аналог переменной окружения ADDRESS или флага -a
-	ReportInterval string `json:"report_interval"` // аналог переменной окружения REPORT_INTERVAL или флага -r
-	PollInterval   string `json:"poll_interval"`   // аналог переменной окружения POLL_INTERVAL или флага -p
-	CryptoKey      string `json:"crypto_key"`      // аналог переменной окружения CRYPTO_KEY или флага -crypto-key
+	Address        string `json:"address"`          // аналог переменной окружения ADDRESS или флага -a
+	ReportInterval string `json:"report_interval"`  // аналог переменной окружения REPORT_INTERVAL или флага -r
+	PollInterval   string `json:"poll_interval"`    // аналог переменной окружения POLL_INTERVAL или флага -p
+	CryptoKey      string `json:"crypto_key"`       // аналог переменной окружения CRYPTO_KEY или флага -crypto-key
+	GCPauseBuckets string `json:"gc_pause_buckets"` // аналог переменной окружения GC_PAUSE_BUCKETS или флага -gc-buckets
+	TLSCA          string `json:"tls_ca"`           // аналог переменной окружения TLS_CA или флага -tls-ca
+	TLSCert        string `json:"tls_cert"`         // аналог переменной окружения TLS_CERT или флага -tls-cert
+	TLSKey         string `json:"tls_key"`          // аналог переменной окружения TLS_KEY или флага -tls-key
 }
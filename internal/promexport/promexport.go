@@ -0,0 +1,171 @@
+// Пакет promexport формирует текстовое представление метрик в формате Prometheus (text exposition format 0.0.4).
+package promexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"metrics/internal/constants"
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+// ContentType - значение заголовка Content-Type для ответа в формате Prometheus.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type series struct {
+	name      string
+	key       string
+	id        string
+	labels    string
+	mtype     string
+	value     string
+	histogram models.Histogram
+}
+
+// Write записывает все метрики в формате Prometheus в порядке возрастания имен.
+// Ключи метрик разбираются на имя и метки (см. пакет labels), серии с одинаковым именем
+// объединяются в одно семейство. Имена метрик приводятся к правилам Prometheus. Если после
+// преобразования имена нескольких метрик совпадают, то выводится первая из них (counter раньше gauge,
+// затем по исходному имени), а ключи серий остальных возвращаются в skipped.
+// Гистограммы выводятся в виде серий _bucket (с накопленным количеством наблюдений), _sum и _count.
+func Write(w io.Writer, counters map[string]int64, gauges map[string]float64, histograms map[string]models.Histogram) (skipped []string, err error) {
+	all := make([]series, 0, len(counters)+len(gauges)+len(histograms))
+
+	for key, delta := range counters {
+		all = append(all, newSeries(key, constants.Counter, strconv.FormatInt(delta, 10)))
+	}
+	for key, value := range gauges {
+		all = append(all, newSeries(key, constants.Gauge, FormatValue(value)))
+	}
+	for key, value := range histograms {
+		s := newSeries(key, constants.Histogram, "")
+		s.histogram = value
+		all = append(all, s)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		if all[i].mtype != all[j].mtype {
+			return typeOrder(all[i].mtype) < typeOrder(all[j].mtype)
+		}
+		if all[i].id != all[j].id {
+			return all[i].id < all[j].id
+		}
+		return all[i].labels < all[j].labels
+	})
+
+	bw := bufio.NewWriter(w)
+	var owner *series
+	for i := range all {
+		s := &all[i]
+		if owner != nil && s.name == owner.name {
+			if s.id != owner.id || s.mtype != owner.mtype {
+				skipped = append(skipped, s.key)
+				continue
+			}
+		} else {
+			owner = s
+			if _, err = fmt.Fprintf(bw, "# TYPE %s %s\n", s.name, s.mtype); err != nil {
+				return skipped, err
+			}
+		}
+
+		if s.mtype == constants.Histogram {
+			writeHistogram(bw, s.name, s.labels, s.histogram)
+			continue
+		}
+
+		if _, err = fmt.Fprintf(bw, "%s%s %s\n", s.name, braces(s.labels), s.value); err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, bw.Flush()
+}
+
+func newSeries(key, mtype, value string) series {
+	id, metricLabels := labels.SplitSeriesKey(key)
+	return series{
+		name:   SanitizeName(id),
+		key:    key,
+		id:     id,
+		labels: labels.Format(metricLabels),
+		mtype:  mtype,
+		value:  value,
+	}
+}
+
+func writeHistogram(bw *bufio.Writer, name, seriesLabels string, h models.Histogram) {
+	bucketPrefix := ""
+	if seriesLabels != "" {
+		bucketPrefix = seriesLabels + ","
+	}
+
+	var cumulative int64
+	for i, bound := range h.Bounds {
+		if i < len(h.Counts) {
+			cumulative += h.Counts[i]
+		}
+		fmt.Fprintf(bw, "%s_bucket{%sle=\"%s\"} %d\n", name, bucketPrefix, FormatValue(bound), cumulative)
+	}
+	fmt.Fprintf(bw, "%s_bucket{%sle=\"+Inf\"} %d\n", name, bucketPrefix, h.Count)
+	fmt.Fprintf(bw, "%s_sum%s %s\n", name, braces(seriesLabels), FormatValue(h.Sum))
+	fmt.Fprintf(bw, "%s_count%s %d\n", name, braces(seriesLabels), h.Count)
+}
+
+func braces(seriesLabels string) string {
+	if seriesLabels == "" {
+		return ""
+	}
+	return "{" + seriesLabels + "}"
+}
+
+func typeOrder(mtype string) int {
+	switch mtype {
+	case constants.Counter:
+		return 0
+	case constants.Gauge:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// SanitizeName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+// Недопустимые символы заменяются на '_', а имя, начинающееся с цифры, дополняется префиксом '_'.
+func SanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatValue форматирует значение gauge так, как этого ожидает Prometheus (NaN, +Inf, -Inf).
+func FormatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,66 @@
+package promexport
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "valid", in: "HeapAlloc", want: "HeapAlloc"},
+		{name: "colon", in: "http:requests", want: "http:requests"},
+		{name: "leading digit", in: "1metric", want: "_1metric"},
+		{name: "invalid chars", in: "cpu.usage-3%", want: "cpu_usage_3_"},
+		{name: "unicode", in: "метрика", want: "_______"},
+		{name: "empty", in: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeName(tt.in))
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	counters := map[string]int64{"PollCount": 5, "dup": 1}
+	gauges := map[string]float64{"Alloc": 1.5, "a.b": math.Inf(1), "dup": 2, "NaNValue": math.NaN()}
+
+	var buf bytes.Buffer
+	histograms := map[string]models.Histogram{"GCPause": {Bounds: []float64{1, 5}, Counts: []int64{1, 2, 1}, Sum: 12, Count: 4}}
+	skipped, err := Write(&buf, counters, gauges, histograms)
+	require.NoError(t, err)
+
+	want := "# TYPE Alloc gauge\nAlloc 1.5\n" +
+		"# TYPE GCPause histogram\nGCPause_bucket{le=\"1\"} 1\nGCPause_bucket{le=\"5\"} 3\nGCPause_bucket{le=\"+Inf\"} 4\nGCPause_sum 12\nGCPause_count 4\n" +
+		"# TYPE NaNValue gauge\nNaNValue NaN\n" +
+		"# TYPE PollCount counter\nPollCount 5\n" +
+		"# TYPE a_b gauge\na_b +Inf\n" +
+		"# TYPE dup counter\ndup 1\n"
+	assert.Equal(t, want, buf.String())
+	assert.Equal(t, []string{"dup"}, skipped)
+}
+
+func TestWrite_Labels(t *testing.T) {
+	counters := map[string]int64{`requests{code="500"}`: 1, `requests{code="200"}`: 7}
+	gauges := map[string]float64{`requests{code="404"}`: 3}
+	histograms := map[string]models.Histogram{`latency{path="/"}`: {Bounds: []float64{1}, Counts: []int64{1, 1}, Sum: 3, Count: 2}}
+
+	var buf bytes.Buffer
+	skipped, err := Write(&buf, counters, gauges, histograms)
+	require.NoError(t, err)
+
+	want := "# TYPE latency histogram\nlatency_bucket{path=\"/\",le=\"1\"} 1\nlatency_bucket{path=\"/\",le=\"+Inf\"} 2\nlatency_sum{path=\"/\"} 3\nlatency_count{path=\"/\"} 2\n" +
+		"# TYPE requests counter\nrequests{code=\"200\"} 7\nrequests{code=\"500\"} 1\n"
+	assert.Equal(t, want, buf.String())
+	assert.Equal(t, []string{`requests{code="404"}`}, skipped)
+}
@@ -0,0 +1,124 @@
+// В пакете pubsub реализована рассылка принятых сервером обновлений метрик подписчикам
+// (эндпоинты GET /api/v1/stream и GET /api/v1/stream/ws).
+//
+// У каждого подписчика есть буфер ограниченного размера. Публикация не блокируется: если буфер
+// подписчика заполнен, подписчик считается медленным и отключается - его канал событий закрывается,
+// а Dropped возвращает true. Клиент может переподключиться и продолжить получать обновления.
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"metrics/internal/models"
+)
+
+// Размер буфера подписчика по умолчанию.
+const DefaultBufferSize = 256
+
+// Event - обновление метрики. Для counter и histogram передается итоговое значение после обновления.
+type Event struct {
+	Time time.Time `json:"time"`
+	models.Metrics
+}
+
+// Filter отбирает метрики, обновления которых получает подписчик. nil - все метрики.
+type Filter func(metric models.Metrics) bool
+
+// Subscription - подписка на обновления метрик.
+type Subscription struct {
+	events  chan Event
+	filter  Filter
+	dropped atomic.Bool
+}
+
+// Events возвращает канал событий. Канал закрывается при отписке или отключении медленного подписчика.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped сообщает, что подписчик был отключен из-за переполнения буфера.
+func (s *Subscription) Dropped() bool {
+	return s.dropped.Load()
+}
+
+// Hub рассылает события подписчикам.
+type Hub struct {
+	bufferSize int
+
+	m       sync.Mutex
+	subs    map[*Subscription]struct{}
+	dropped int64 // количество отключенных медленных подписчиков
+}
+
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		bufferSize: bufferSize,
+		subs:       make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe создает подписку. Подписку необходимо завершить методом Unsubscribe.
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	sub := &Subscription{
+		events: make(chan Event, h.bufferSize),
+		filter: filter,
+	}
+	h.m.Lock()
+	h.subs[sub] = struct{}{}
+	h.m.Unlock()
+	return sub
+}
+
+// Unsubscribe завершает подписку. Повторный вызов и вызов для отключенного подписчика безопасны.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// HasSubscribers сообщает, есть ли подписчики. Позволяет не формировать события, если их некому отправлять.
+func (h *Hub) HasSubscribers() bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return len(h.subs) > 0
+}
+
+// Dropped возвращает количество подписчиков, отключенных из-за переполнения буфера.
+func (h *Hub) Dropped() int64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.dropped
+}
+
+// Publish рассылает события подписчикам, фильтры которых им соответствуют. Не блокирует вызывающего.
+func (h *Hub) Publish(events ...Event) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for sub := range h.subs {
+		for _, event := range events {
+			if sub.filter != nil && !sub.filter(event.Metrics) {
+				continue
+			}
+			select {
+			case sub.events <- event:
+				continue
+			default:
+			}
+			// буфер заполнен - отключаем медленного подписчика
+			sub.dropped.Store(true)
+			delete(h.subs, sub)
+			close(sub.events)
+			h.dropped++
+			break
+		}
+	}
+}
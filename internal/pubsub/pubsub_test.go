@@ -0,0 +1,46 @@
+package pubsub
+
+import (
+	"testing"
+
+	"metrics/internal/constants"
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(2)
+
+	all := hub.Subscribe(nil)
+	gauges := hub.Subscribe(func(metric models.Metrics) bool { return metric.MType == constants.Gauge })
+	require.True(t, hub.HasSubscribers())
+
+	hub.Publish(Event{Metrics: models.Metrics{ID: "Alloc", MType: constants.Gauge}}, Event{Metrics: models.Metrics{ID: "PollCount", MType: constants.Counter}})
+	assert.Len(t, all.Events(), 2)
+	require.Len(t, gauges.Events(), 1)
+	assert.Equal(t, "Alloc", (<-gauges.Events()).ID)
+
+	// буфер all заполнен - подписчик отключается, остальные продолжают получать события
+	hub.Publish(Event{Metrics: models.Metrics{ID: "Alloc", MType: constants.Gauge}})
+	assert.True(t, all.Dropped())
+	assert.False(t, gauges.Dropped())
+	assert.Equal(t, int64(1), hub.Dropped())
+
+	count := 0
+	for range all.Events() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+	assert.Len(t, gauges.Events(), 1)
+
+	hub.Unsubscribe(all)
+	hub.Unsubscribe(gauges)
+	hub.Unsubscribe(gauges)
+	assert.False(t, hub.HasSubscribers())
+	_, ok := <-gauges.Events()
+	assert.True(t, ok)
+	_, ok = <-gauges.Events()
+	assert.False(t, ok)
+}
@@ -0,0 +1,266 @@
+// В пакете ratelimit реализовано ограничение частоты запросов на обновление метрик по алгоритму token bucket.
+//
+// Для каждого клиента ведутся два счетчика: количество запросов в секунду и количество метрик в минуту.
+// Клиент определяется по токену из заголовка Authorization или по заголовку X-Agent-ID, если подпись запроса
+// проверена (см. authsign.Verified), иначе - по IP-адресу. Количество отслеживаемых клиентов ограничено MaxClients.
+// На запрос сверх ограничения возвращается 429 Too Many Requests с заголовком Retry-After,
+// а отказ учитывается в метрике RateLimitRejected с меткой limit="requests" или limit="metrics".
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics/internal/authsign"
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// RejectedMetric - имя метрики сервера с количеством отклоненных запросов.
+const RejectedMetric = "RateLimitRejected"
+
+// MaxClients - наибольшее количество клиентов со своими счетчиками. Новые клиенты сверх этого количества
+// делят общие счетчики, чтобы поток запросов с разных адресов не увеличивал потребление памяти.
+const MaxClients = 10000
+
+// overflowClient - идентификатор общих счетчиков для клиентов сверх MaxClients.
+const overflowClient = "overflow"
+
+// Значения метки limit метрики RejectedMetric.
+const (
+	LimitRequests = "requests"
+	LimitMetrics  = "metrics"
+)
+
+// Counter - хранилище, в котором учитываются отклоненные запросы (см. controller.Controller).
+type Counter interface {
+	UpdateMetric(ctx context.Context, metric models.Metrics) (statusCode int, err error)
+}
+
+// Bucket - счетчик token bucket: tokens пополняются со скоростью rate в секунду, но не более burst.
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket возвращает заполненный счетчик.
+func NewBucket(rate, burst float64, now time.Time) *Bucket {
+	return &Bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// Take забирает n токенов. Если токенов недостаточно, счетчик не меняется и возвращается время,
+// через которое они появятся. Запрос больше burst выполняется, когда счетчик заполнен полностью.
+func (b *Bucket) Take(n float64, now time.Time) (ok bool, wait time.Duration) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+	n = math.Min(n, b.burst)
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, 0
+	}
+	return false, time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+type client struct {
+	requests *Bucket
+	metrics  *Bucket
+	seen     time.Time
+}
+
+type RateLimit struct {
+	requestRate  float64
+	requestBurst float64
+	metricRate   float64
+	metricBurst  float64
+	idle         time.Duration // время, за которое заполняются оба счетчика клиента
+
+	counter Counter
+	logger  *zap.Logger
+	now     func() time.Time
+
+	m         sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+func NewRateLimitMW(cfg *config.Config, counter Counter, logger *zap.Logger) *RateLimit {
+	l := &RateLimit{
+		requestRate: cfg.Server.RateLimitRPS,
+		metricRate:  float64(cfg.Server.RateLimitMetrics) / 60,
+		metricBurst: float64(cfg.Server.RateLimitMetrics),
+		counter:     counter,
+		logger:      logger,
+		now:         time.Now,
+		clients:     make(map[string]*client),
+	}
+	if l.requestRate > 0 {
+		l.requestBurst = math.Max(1, l.requestRate)
+		l.idle = time.Duration(l.requestBurst / l.requestRate * float64(time.Second))
+	}
+	if l.metricRate > 0 {
+		l.idle = max(l.idle, time.Minute)
+	}
+	return l
+}
+
+// Limit пропускает запрос к h, если клиент не превысил ограничения.
+// Количество метрик определяется по телу запроса, поэтому Limit должен вызываться после распаковки и расшифровки.
+func (l *RateLimit) Limit(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if l.requestRate <= 0 && l.metricRate <= 0 {
+			h(w, r)
+			return
+		}
+
+		var n float64
+		if l.metricRate > 0 {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			n = float64(CountMetrics(r.Header.Get("Content-Type"), body))
+		}
+
+		id := ClientID(r)
+		limit, wait := l.take(id, n)
+		if limit != "" {
+			l.logger.Warn("превышено ограничение запросов", zap.String("client", id), zap.String("limit", limit), zap.Duration("retry_after", wait))
+			delta := int64(1)
+			l.counter.UpdateMetric(context.WithoutCancel(r.Context()), models.Metrics{
+				ID:     RejectedMetric,
+				MType:  constants.Counter,
+				Delta:  &delta,
+				Labels: map[string]string{"limit": limit},
+			})
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(wait, time.Second).Seconds()))))
+			http.Error(w, "превышено ограничение запросов", http.StatusTooManyRequests)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// take списывает запрос и n метрик со счетчиков клиента id. Если ограничение превышено,
+// возвращается его название и время ожидания.
+func (l *RateLimit) take(id string, n float64) (limit string, wait time.Duration) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+	l.sweep(now, false)
+
+	c, ok := l.clients[id]
+	if !ok && len(l.clients) >= MaxClients {
+		l.sweep(now, true)
+		if len(l.clients) >= MaxClients {
+			id = overflowClient
+			c, ok = l.clients[id]
+		}
+	}
+	if !ok {
+		c = &client{}
+		if l.requestRate > 0 {
+			c.requests = NewBucket(l.requestRate, l.requestBurst, now)
+		}
+		if l.metricRate > 0 {
+			c.metrics = NewBucket(l.metricRate, l.metricBurst, now)
+		}
+		l.clients[id] = c
+	}
+	c.seen = now
+
+	if c.requests != nil {
+		if ok, wait := c.requests.Take(1, now); !ok {
+			return LimitRequests, wait
+		}
+	}
+	if c.metrics != nil && n > 0 {
+		if ok, wait := c.metrics.Take(n, now); !ok {
+			return LimitMetrics, wait
+		}
+	}
+	return "", 0
+}
+
+// sweep не чаще раза в минуту (или сразу, если force) удаляет клиентов, счетчики которых уже заполнились полностью.
+func (l *RateLimit) sweep(now time.Time, force bool) {
+	if !force && now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for id, c := range l.clients {
+		if now.Sub(c.seen) > l.idle {
+			delete(l.clients, id)
+		}
+	}
+}
+
+// ClientID возвращает идентификатор клиента: хеш токена из заголовка Authorization или значение
+// заголовка X-Agent-ID, если подпись запроса проверена, иначе IP-адрес клиента. Без проверки подписи
+// заголовкам не доверяем: иначе клиент обходил бы ограничение, меняя их в каждом запросе.
+func ClientID(r *http.Request) string {
+	if authsign.Verified(r.Context()) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + hex.EncodeToString(sum[:8])
+		}
+		if agent := r.Header.Get(constants.HeaderAgentID); agent != "" {
+			return "agent:" + agent
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// CountMetrics возвращает количество метрик в теле запроса: длину массива JSON (POST /updates/)
+// или количество непустых строк (JSON, NDJSON, InfluxDB line protocol, CSV без строки заголовка).
+// Запрос без тела (POST /update/{metricType}/{metricName}/{metricValue}) содержит одну метрику.
+func CountMetrics(contentType string, body []byte) int {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return 1
+	}
+	if body[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err == nil {
+			return max(1, len(items))
+		}
+		return 1
+	}
+
+	n := 0
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' {
+			n++
+		}
+	}
+	if strings.HasPrefix(contentType, "text/csv") && n > 1 {
+		n--
+	}
+	return max(1, n)
+}
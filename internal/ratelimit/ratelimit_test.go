@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"metrics/internal/authsign"
+	"metrics/internal/config"
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type counter struct {
+	rejected map[string]int64
+}
+
+func (c *counter) UpdateMetric(ctx context.Context, metric models.Metrics) (int, error) {
+	c.rejected[metric.Labels["limit"]] += *metric.Delta
+	return 0, nil
+}
+
+func TestBucket_Take(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(2, 2, now)
+
+	ok, _ := b.Take(2, now)
+	assert.True(t, ok)
+	ok, wait := b.Take(1, now)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = b.Take(1, now.Add(500*time.Millisecond))
+	assert.True(t, ok)
+
+	// Запрос больше burst выполняется при полном счетчике.
+	ok, _ = b.Take(10, now.Add(time.Hour))
+	assert.True(t, ok)
+}
+
+func TestRateLimit_Limit(t *testing.T) {
+	now := time.Now()
+	c := &counter{rejected: make(map[string]int64)}
+	cfg := &config.Config{Server: config.ServerConfig{RateLimitRPS: 1, RateLimitMetrics: 3}}
+	l := NewRateLimitMW(cfg, c, zap.NewNop())
+	l.now = func() time.Time { return now }
+
+	var body string
+	h := l.Limit(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	do := func(addr, payload string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(payload))
+		req.RemoteAddr = addr + ":1234"
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	rec := do("10.0.0.1", `[{"id":"a"},{"id":"b"}]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"id":"a"},{"id":"b"}]`, body)
+
+	rec = do("10.0.0.1", `[]`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// Другой клиент ограничивается независимо.
+	rec = do("10.0.0.2", `[{"id":"a"}]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	now = now.Add(time.Second)
+	rec = do("10.0.0.1", `[{"id":"a"},{"id":"b"}]`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "19", rec.Header().Get("Retry-After"))
+
+	assert.Equal(t, map[string]int64{LimitRequests: 1, LimitMetrics: 1}, c.rejected)
+}
+
+func TestClientID(t *testing.T) {
+	cfg := &config.Config{SecretKey: "key", Server: config.ServerConfig{SignatureSkew: time.Minute}}
+	verify := authsign.NewVerifyMW(cfg, zap.NewNop())
+
+	var id string
+	h := verify.Verify(func(w http.ResponseWriter, r *http.Request) { id = ClientID(r) })
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Agent-ID", "host")
+	req.Header.Set("Authorization", "Bearer secret")
+
+	// Без проверенной подписи заголовкам не доверяем.
+	assert.Equal(t, "ip:10.0.0.1", ClientID(req))
+
+	require.NoError(t, authsign.SignRequest(req, nil, []byte(cfg.SecretKey)))
+	h(httptest.NewRecorder(), req)
+	assert.True(t, strings.HasPrefix(id, "token:"))
+	assert.NotContains(t, id, "secret")
+
+	req.Header.Del("Authorization")
+	require.NoError(t, authsign.SignRequest(req, nil, []byte(cfg.SecretKey)))
+	h(httptest.NewRecorder(), req)
+	assert.Equal(t, "agent:host", id)
+}
+
+func TestRateLimit_MaxClients(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{RateLimitRPS: 1}}
+	l := NewRateLimitMW(cfg, &counter{rejected: make(map[string]int64)}, zap.NewNop())
+
+	for i := 0; i < MaxClients; i++ {
+		limit, _ := l.take(fmt.Sprintf("ip:%d", i), 0)
+		assert.Empty(t, limit)
+	}
+
+	// Новые клиенты сверх MaxClients делят общий счетчик.
+	limit, _ := l.take("ip:new", 0)
+	assert.Empty(t, limit)
+	limit, _ = l.take("ip:other", 0)
+	assert.Equal(t, LimitRequests, limit)
+	assert.Len(t, l.clients, MaxClients+1)
+}
+
+func TestCountMetrics(t *testing.T) {
+	assert.Equal(t, 1, CountMetrics("", nil))
+	assert.Equal(t, 3, CountMetrics("application/json", []byte(`[{},{},{}]`)))
+	assert.Equal(t, 1, CountMetrics("application/json", []byte(`{"id":"a"}`)))
+	assert.Equal(t, 2, CountMetrics("text/plain", []byte("# comment\ncpu value=1\n\nmem value=2\n")))
+	assert.Equal(t, 2, CountMetrics("text/csv", []byte("id,type,labels,value,delta,histogram\na,gauge,,1,,\nb,gauge,,2,,\n")))
+}
@@ -0,0 +1,138 @@
+// В пакете retention реализованы политики хранения истории метрик и свертка точек в агрегаты.
+//
+// Политика задается для шаблона имени метрики (синтаксис path.Match) и определяет:
+//   - raw - сколько хранятся исходные точки; более старые точки сворачиваются в минутные агрегаты;
+//   - minute - сколько хранятся минутные агрегаты; более старые сворачиваются в часовые;
+//   - hour - сколько хранятся часовые агрегаты; более старые удаляются.
+//
+// Нулевая длительность означает хранение без ограничения. Для серии применяется первая подходящая политика,
+// серии, для которых политика не найдена, не изменяются.
+package retention
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"metrics/internal/models"
+)
+
+// Разрешения агрегатов.
+const (
+	Minute = time.Minute
+	Hour   = time.Hour
+)
+
+// Policy - политика хранения истории метрик, имена которых соответствуют шаблону Pattern.
+type Policy struct {
+	Pattern string
+	Raw     time.Duration
+	Minute  time.Duration
+	Hour    time.Duration
+}
+
+// Policies - список политик в порядке приоритета.
+type Policies []Policy
+
+// ParsePolicies преобразует политики из JSON-конфигурации сервера.
+func ParsePolicies(configs []models.RetentionPolicy) (Policies, error) {
+	policies := make(Policies, 0, len(configs))
+	for _, cfg := range configs {
+		if _, err := path.Match(cfg.Pattern, ""); err != nil || cfg.Pattern == "" {
+			return nil, fmt.Errorf("неверный шаблон политики хранения %q", cfg.Pattern)
+		}
+
+		policy := Policy{Pattern: cfg.Pattern}
+		for _, field := range []struct {
+			name  string
+			value string
+			dst   *time.Duration
+		}{
+			{name: "raw", value: cfg.Raw, dst: &policy.Raw},
+			{name: "minute", value: cfg.Minute, dst: &policy.Minute},
+			{name: "hour", value: cfg.Hour, dst: &policy.Hour},
+		} {
+			if field.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(field.value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("неверное значение %s политики хранения %q: %s", field.name, cfg.Pattern, field.value)
+			}
+			*field.dst = d
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// Find возвращает первую политику, шаблон которой соответствует имени метрики.
+func (p Policies) Find(name string) (Policy, bool) {
+	for _, policy := range p {
+		if ok, _ := path.Match(policy.Pattern, name); ok {
+			return policy, true
+		}
+	}
+	return Policy{}, false
+}
+
+// Cutoffs возвращает границы, до которых точки и агрегаты подлежат свертке или удалению на момент now.
+// Границы свертки выровнены по разрешению агрегата, чтобы агрегат не разбивался между запусками.
+// Нулевое время означает, что данные этого уровня не обрабатываются.
+func (p Policy) Cutoffs(now time.Time) (raw, minute, hour time.Time) {
+	if p.Raw > 0 {
+		raw = now.Add(-p.Raw).Truncate(Minute)
+	}
+	if p.Minute > 0 {
+		minute = now.Add(-p.Minute).Truncate(Hour)
+	}
+	if p.Hour > 0 {
+		hour = now.Add(-p.Hour)
+	}
+	return
+}
+
+// Rollup сворачивает упорядоченные по времени точки в агрегаты с разрешением step.
+func Rollup(points []models.Point, step time.Duration) []models.Aggregate {
+	aggregates := []models.Aggregate{}
+	for _, point := range points {
+		aggregate := models.Aggregate{
+			Time:  point.Time.Truncate(step),
+			Min:   point.Value,
+			Max:   point.Value,
+			Avg:   point.Value,
+			Last:  point.Value,
+			Count: 1,
+		}
+		aggregates = Append(aggregates, aggregate)
+	}
+	return aggregates
+}
+
+// RollupAggregates сворачивает упорядоченные по времени агрегаты в агрегаты с более крупным разрешением step.
+func RollupAggregates(aggregates []models.Aggregate, step time.Duration) []models.Aggregate {
+	result := []models.Aggregate{}
+	for _, aggregate := range aggregates {
+		aggregate.Time = aggregate.Time.Truncate(step)
+		result = Append(result, aggregate)
+	}
+	return result
+}
+
+// Append добавляет агрегат в конец упорядоченного списка.
+// Если последний агрегат списка относится к тому же интервалу, то агрегаты объединяются.
+func Append(aggregates []models.Aggregate, aggregate models.Aggregate) []models.Aggregate {
+	n := len(aggregates)
+	if n == 0 || !aggregates[n-1].Time.Equal(aggregate.Time) {
+		return append(aggregates, aggregate)
+	}
+
+	last := &aggregates[n-1]
+	count := last.Count + aggregate.Count
+	last.Avg = (last.Avg*float64(last.Count) + aggregate.Avg*float64(aggregate.Count)) / float64(count)
+	last.Min = min(last.Min, aggregate.Min)
+	last.Max = max(last.Max, aggregate.Max)
+	last.Last = aggregate.Last
+	last.Count = count
+	return aggregates
+}
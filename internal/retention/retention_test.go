@@ -0,0 +1,64 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies([]models.RetentionPolicy{
+		{Pattern: "CPU*", Raw: "1h", Minute: "24h"},
+		{Pattern: "*", Raw: "10m", Hour: "720h"},
+	})
+	require.NoError(t, err)
+
+	policy, ok := policies.Find("CPUutilization")
+	require.True(t, ok)
+	assert.Equal(t, Policy{Pattern: "CPU*", Raw: time.Hour, Minute: 24 * time.Hour}, policy)
+
+	policy, ok = policies.Find("Alloc")
+	require.True(t, ok)
+	assert.Equal(t, 10*time.Minute, policy.Raw)
+
+	_, ok = Policies{}.Find("Alloc")
+	assert.False(t, ok)
+
+	_, err = ParsePolicies([]models.RetentionPolicy{{Pattern: "[", Raw: "1h"}})
+	assert.Error(t, err)
+	_, err = ParsePolicies([]models.RetentionPolicy{{Pattern: "*", Raw: "day"}})
+	assert.Error(t, err)
+}
+
+func TestCutoffs(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 34, 56, 0, time.UTC)
+	raw, minute, hour := Policy{Raw: time.Hour, Minute: 24 * time.Hour}.Cutoffs(now)
+
+	assert.Equal(t, time.Date(2024, 1, 1, 11, 34, 0, 0, time.UTC), raw)
+	assert.Equal(t, time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC), minute)
+	assert.True(t, hour.IsZero())
+}
+
+func TestRollup(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	points := []models.Point{
+		{Time: start.Add(10 * time.Second), Value: 4},
+		{Time: start.Add(20 * time.Second), Value: 2},
+		{Time: start.Add(70 * time.Second), Value: 6},
+	}
+
+	minutes := Rollup(points, Minute)
+	assert.Equal(t, []models.Aggregate{
+		{Time: start, Min: 2, Max: 4, Avg: 3, Last: 2, Count: 2},
+		{Time: start.Add(time.Minute), Min: 6, Max: 6, Avg: 6, Last: 6, Count: 1},
+	}, minutes)
+
+	hours := RollupAggregates(minutes, Hour)
+	assert.Equal(t, []models.Aggregate{
+		{Time: start, Min: 2, Max: 6, Avg: 4, Last: 6, Count: 3},
+	}, hours)
+}
@@ -6,6 +6,7 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"metrics/internal/authsign"
@@ -13,7 +14,9 @@ import (
 	"metrics/internal/models"
 )
 
-func SendMetric(serverAddress string, metricType string, metricName string, metricValue interface{}) error {
+// SendMetric отправляет одну метрику на сервер. Если задан secretKey, запрос подписывается этим ключом
+// (см. authsign.SignRequest), а без верной подписи ответа сервера отправка считается неудачной.
+func SendMetric(serverAddress string, secretKey string, metricType string, metricName string, metricValue interface{}) error {
 
 	metricForSend := models.Metrics{
 		ID:    metricName,
@@ -91,6 +94,11 @@ func SendMetric(serverAddress string, metricType string, metricName string, metr
 
 	request.Header.Set("Content-Encoding", "gzip")
 	request.Header.Set("Accept-Encoding", "")
+	if secretKey != "" {
+		if err := authsign.SignRequest(request, jsonData, []byte(secretKey)); err != nil {
+			return fmt.Errorf("failed to sign request: %v", err)
+		}
+	}
 
 	resp, err := http.DefaultClient.Do(request)
 	if err != nil {
@@ -100,6 +108,10 @@ func SendMetric(serverAddress string, metricType string, metricName string, metr
 
 	defer resp.Body.Close()
 
+	if err = verifyResponse(resp, secretKey); err != nil {
+		return err
+	}
+
 	// switch metricType {
 	// case "gauge":
 	// 	fmt.Printf("Sent metric: %s/%s/%v -/%v, response status: %s\n", metricType, metricName, floatValue, *metricForSend.Value, resp.Status)
@@ -111,7 +123,7 @@ func SendMetric(serverAddress string, metricType string, metricName string, metr
 
 }
 
-func SendMetrics(serverAddress string, metrics map[string]interface{}) (err error) {
+func SendMetrics(serverAddress string, secretKey string, metrics map[string]interface{}) (err error) {
 	for metricName, metricValue := range metrics {
 		var metricType string
 		if metricName == constants.PollCount {
@@ -119,7 +131,7 @@ func SendMetrics(serverAddress string, metrics map[string]interface{}) (err erro
 		} else {
 			metricType = constants.Gauge
 		}
-		err := SendMetric(serverAddress, metricType, metricName, metricValue)
+		err := SendMetric(serverAddress, secretKey, metricType, metricName, metricValue)
 
 		if err != nil {
 			addText := fmt.Sprintf("Ошибка при отправке метрики %s\n", metricName)
@@ -139,10 +151,6 @@ func SendMetricsBatch(serverAddress string, secretKey string, metrics []models.M
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %v", err)
 	}
-	var hash string
-	if secretKey != "" {
-		hash = authsign.CalculateHash(jsonData, []byte(secretKey))
-	}
 
 	var buf bytes.Buffer
 	gzipWriter := gzip.NewWriter(&buf)
@@ -166,8 +174,10 @@ func SendMetricsBatch(serverAddress string, secretKey string, metrics []models.M
 
 	request.Header.Set("Content-Encoding", "gzip")
 	request.Header.Set("Accept-Encoding", "")
-	if hash != "" {
-		request.Header.Set(constants.HeaderSig, hash)
+	if secretKey != "" {
+		if err := authsign.SignRequest(request, jsonData, []byte(secretKey)); err != nil {
+			return fmt.Errorf("failed to sign request: %v", err)
+		}
 	}
 
 	resp, err := http.DefaultClient.Do(request)
@@ -178,5 +188,21 @@ func SendMetricsBatch(serverAddress string, secretKey string, metrics []models.M
 
 	defer resp.Body.Close()
 
+	return verifyResponse(resp, secretKey)
+}
+
+// verifyResponse проверяет подпись ответа сервера: ответ подписывается тем же ключом, что и запрос.
+// Если ключ не задан, ответ не проверяется.
+func verifyResponse(resp *http.Response, secretKey string) error {
+	if secretKey == "" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if !authsign.VerifySig(resp.Header.Get(constants.HeaderSig), body, []byte(secretKey)) {
+		return fmt.Errorf("invalid response signature")
+	}
 	return nil
 }
@@ -1,11 +1,18 @@
 package sender
 
 import (
+	"compress/gzip"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"metrics/internal/authsign"
+	"metrics/internal/constants"
+	"metrics/internal/models"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSendMetric_SuccessGauge(t *testing.T) {
@@ -28,7 +35,7 @@ func TestSendMetric_SuccessGauge(t *testing.T) {
 	metricValue := 45.67
 
 	// Выполним вызов функции SendMetric
-	err := SendMetric(serverAddress, metricType, metricName, metricValue)
+	err := SendMetric(serverAddress, "", metricType, metricName, metricValue)
 
 	// Проверим, что ошибок нет
 	assert.NoError(t, err)
@@ -54,7 +61,7 @@ func TestSendMetric_SuccessCounter(t *testing.T) {
 	metricValue := "asd"
 
 	// Выполним вызов функции SendMetric
-	err := SendMetric(serverAddress, metricType, metricName, metricValue)
+	err := SendMetric(serverAddress, "", metricType, metricName, metricValue)
 
 	// Проверим, что ошибок нет
 	assert.NoError(t, err)
@@ -142,3 +149,77 @@ func TestSendMetric_SuccessCounter(t *testing.T) {
 // 		})
 // 	}
 // }
+
+func TestSendMetricsBatch_ResponseSignature(t *testing.T) {
+	const key = "secret"
+	metrics := []models.MetricsForSend{{ID: "PollCount", MType: "counter", Delta: 1}}
+
+	tests := []struct {
+		name    string
+		sign    func(body []byte) string
+		wantErr bool
+	}{
+		{name: "valid", sign: func(body []byte) string { return authsign.CalculateHash(body, []byte(key)) }},
+		{name: "invalid", sign: func(body []byte) string { return authsign.CalculateHash(body, []byte("other")) }, wantErr: true},
+		{name: "missing", sign: func(body []byte) string { return "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body := []byte(`{"applied":1}`)
+				w.Header().Set(constants.HeaderSig, tt.sign(body))
+				w.Write(body)
+			}))
+			defer ts.Close()
+
+			err := SendMetricsBatch(ts.URL[len("http://"):], key, metrics)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestSendMetric_ResponseSignature(t *testing.T) {
+	const key = "secret"
+
+	tests := []struct {
+		name    string
+		sign    func(body []byte) string
+		wantErr bool
+	}{
+		{name: "valid", sign: func(body []byte) string { return authsign.CalculateHash(body, []byte(key)) }},
+		{name: "invalid", sign: func(body []byte) string { return authsign.CalculateHash(body, []byte("other")) }, wantErr: true},
+		{name: "missing", sign: func(body []byte) string { return "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body := []byte(`{"id":"Alloc","type":"gauge","value":1}`)
+				w.Header().Set(constants.HeaderSig, tt.sign(body))
+				w.Write(body)
+			}))
+			defer ts.Close()
+
+			err := SendMetric(ts.URL[len("http://"):], key, constants.Gauge, "Alloc", 1.0)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestSendMetric_SignsRequest(t *testing.T) {
+	const key = "secret"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		assert.True(t, authsign.VerifyRequestSig(r.Header.Get(constants.HeaderSig), r.Method, r.URL.RequestURI(),
+			r.Header.Get(constants.HeaderSigTimestamp), r.Header.Get(constants.HeaderSigNonce), body, []byte(key)))
+
+		w.Header().Set(constants.HeaderSig, authsign.CalculateHash(nil, []byte(key)))
+	}))
+	defer ts.Close()
+
+	require.NoError(t, SendMetric(ts.URL[len("http://"):], key, constants.Counter, constants.PollCount, int64(1)))
+}
@@ -0,0 +1,211 @@
+// В пакете snapshot реализовано хранение снимков метрик в каталоге на диске.
+//
+// Снимок - файл <имя>.json с метриками в формате файла хранения (по объекту JSON на строку, см. пакет filetransfer),
+// поэтому снимок можно использовать и как файл для восстановления при старте сервера (флаги -f и -r).
+// Файл сначала записывается во временный файл и затем публикуется под своим именем, поэтому
+// в каталоге никогда не бывает частично записанных снимков.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"metrics/internal/exchange"
+	"metrics/internal/models"
+)
+
+// Расширение файлов снимков.
+const Ext = ".json"
+
+var (
+	ErrNotFound    = errors.New("снимок не найден")
+	ErrExists      = errors.New("снимок с таким именем уже существует")
+	ErrInvalidName = errors.New("имя снимка может содержать только латинские буквы, цифры и символы . _ - и не может начинаться с точки")
+)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,127}$`)
+
+// Info - сведения о снимке.
+type Info struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// Store - каталог снимков.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultName возвращает имя снимка по времени создания.
+func DefaultName(now time.Time) string {
+	return "snapshot-" + now.UTC().Format("20060102T150405.000Z")
+}
+
+// ValidateName проверяет имя снимка.
+func ValidateName(name string) error {
+	if !nameRe.MatchString(name) {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// Save записывает снимок name. Существующий снимок не перезаписывается.
+func (s *Store) Save(name string, metrics []models.Metrics) (info Info, err error) {
+	if err = ValidateName(name); err != nil {
+		return info, err
+	}
+	if err = os.MkdirAll(s.dir, 0755); err != nil {
+		return info, fmt.Errorf("ошибка при создании каталога снимков: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-"+name+"-*")
+	if err != nil {
+		return info, fmt.Errorf("ошибка при создании снимка: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = write(tmp, metrics); err != nil {
+		tmp.Close()
+		return info, fmt.Errorf("ошибка при записи снимка: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return info, fmt.Errorf("ошибка при записи снимка: %w", err)
+	}
+
+	// os.Link завершается ошибкой, если файл уже существует, поэтому одновременное создание
+	// снимков с одним именем не приводит к перезаписи.
+	path := s.path(name)
+	if err = os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return info, ErrExists
+		}
+		return info, fmt.Errorf("ошибка при сохранении снимка: %w", err)
+	}
+
+	return s.stat(name)
+}
+
+func write(file *os.File, metrics []models.Metrics) error {
+	writer, err := exchange.NewWriter(file, exchange.FormatNDJSON)
+	if err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		if err = writer.Write(metric); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Load читает метрики из снимка name.
+func (s *Store) Load(name string) ([]models.Metrics, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metrics, err := exchange.Read(file, exchange.FormatNDJSON)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении снимка %s: %w", name, err)
+	}
+	return metrics, nil
+}
+
+// List возвращает снимки, упорядоченные по времени создания (сначала новые).
+func (s *Store) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []Info{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), Ext)
+		if !ok || !entry.Type().IsRegular() || ValidateName(name) != nil {
+			continue
+		}
+		info, err := s.stat(name)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].Created.Equal(infos[j].Created) {
+			return infos[i].Created.After(infos[j].Created)
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// Delete удаляет снимок name.
+func (s *Store) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	err := os.Remove(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Prune удаляет снимки, кроме keep самых новых (keep <= 0 - без ограничения по количеству),
+// а также снимки, созданные раньше olderThan (нулевое время - без ограничения по времени).
+// Возвращает имена удаленных снимков.
+func (s *Store) Prune(keep int, olderThan time.Time) (deleted []string, err error) {
+	infos, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted = []string{}
+	for i, info := range infos {
+		if (keep > 0 && i >= keep) || (!olderThan.IsZero() && info.Created.Before(olderThan)) {
+			if err = s.Delete(info.Name); err != nil && !errors.Is(err, ErrNotFound) {
+				return deleted, err
+			}
+			deleted = append(deleted, info.Name)
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+Ext)
+}
+
+func (s *Store) stat(name string) (info Info, err error) {
+	fi, err := os.Stat(s.path(name))
+	if err != nil {
+		return info, err
+	}
+	return Info{Name: name, Size: fi.Size(), Created: fi.ModTime()}, nil
+}
@@ -0,0 +1,63 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	store := NewStore(dir)
+
+	infos, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+
+	value := 1.5
+	metrics := []models.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}}
+	for _, name := range []string{"a", "b", "c"} {
+		_, err = store.Save(name, metrics)
+		require.NoError(t, err)
+	}
+	_, err = store.Save("a", nil)
+	assert.ErrorIs(t, err, ErrExists)
+	_, err = store.Save("../a", nil)
+	assert.ErrorIs(t, err, ErrInvalidName)
+
+	loaded, err := store.Load("a")
+	require.NoError(t, err)
+	assert.Equal(t, metrics, loaded)
+	_, err = store.Load("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a"+Ext), old, old))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "b"+Ext), old.Add(time.Hour), old.Add(time.Hour)))
+
+	infos, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+	assert.Equal(t, []string{"c", "b", "a"}, []string{infos[0].Name, infos[1].Name, infos[2].Name})
+
+	deleted, err := store.Prune(2, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, deleted)
+
+	deleted, err = store.Prune(0, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, deleted)
+
+	require.NoError(t, store.Delete("c"))
+	assert.ErrorIs(t, store.Delete("c"), ErrNotFound)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,93 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"metrics/internal/constants"
+)
+
+// Sample - одно значение, полученное из строки формата StatsD.
+type Sample struct {
+	Name     string
+	MType    string  // constants.Gauge или constants.Counter
+	Value    float64 // значение gauge или приращение counter
+	Relative bool    // для gauge: значение со знаком изменяет текущее значение метрики, а не заменяет его
+}
+
+// Delta возвращает приращение counter в виде целого числа.
+func (s Sample) Delta() int64 {
+	return int64(math.Round(s.Value))
+}
+
+// Parse разбирает пакет StatsD, который может содержать несколько строк вида
+// name:value|type[|@sample_rate][|#tags].
+// Поддерживаются типы c (counter) и g (gauge). Строки с ошибками пропускаются и возвращаются в errs.
+func Parse(packet []byte) (samples []Sample, errs []error) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sample, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, errs
+}
+
+// ParseLine разбирает одну строку формата StatsD.
+func ParseLine(line string) (sample Sample, err error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return sample, fmt.Errorf("statsd: неверный формат строки %q", line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return sample, fmt.Errorf("statsd: не указан тип метрики в строке %q", line)
+	}
+
+	rawValue := parts[0]
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return sample, fmt.Errorf("statsd: неверное значение метрики в строке %q", line)
+	}
+
+	rate := 1.0
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err = strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return sample, fmt.Errorf("statsd: неверная частота выборки в строке %q", line)
+			}
+		case strings.HasPrefix(part, "#"):
+			// теги не поддерживаются и игнорируются
+		default:
+			return sample, fmt.Errorf("statsd: неизвестный параметр %q в строке %q", part, line)
+		}
+	}
+
+	sample.Name = name
+
+	switch parts[1] {
+	case "c":
+		sample.MType = constants.Counter
+		sample.Value = value / rate
+	case "g":
+		sample.MType = constants.Gauge
+		sample.Value = value
+		sample.Relative = strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")
+	default:
+		return sample, fmt.Errorf("statsd: тип %q не поддерживается в строке %q", parts[1], line)
+	}
+
+	return sample, nil
+}
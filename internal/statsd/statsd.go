@@ -0,0 +1,146 @@
+// В пакете statsd реализован UDP-сервер, принимающий метрики в формате StatsD.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/controller"
+	"metrics/internal/filetransfer"
+	"metrics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Максимальный размер UDP-пакета.
+const maxPacketSize = 65535
+
+type Listener struct {
+	config     *config.Config
+	fileWriter *filetransfer.FileWriter
+	logger     *zap.Logger
+	controller *controller.Controller
+
+	mu     sync.Mutex // защищает conn и closed
+	conn   net.PacketConn
+	closed bool
+
+	// gaugeMu делает чтение и запись относительного изменения gauge (+N/-N) атомарными
+	// для пакетов, обрабатываемых одновременно.
+	gaugeMu sync.Mutex
+}
+
+func NewListener(cfg *config.Config, fileWriter *filetransfer.FileWriter, logger *zap.Logger, controller *controller.Controller) *Listener {
+	return &Listener{
+		config:     cfg,
+		fileWriter: fileWriter,
+		logger:     logger,
+		controller: controller,
+	}
+}
+
+// ListenAndServe открывает UDP-порт и обрабатывает входящие пакеты до вызова Close.
+func (l *Listener) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", l.config.Server.StatsDAddress)
+	if err != nil {
+		return err
+	}
+	return l.Serve(conn)
+}
+
+// Serve обрабатывает пакеты, полученные через conn, до вызова Close.
+func (l *Listener) Serve(conn net.PacketConn) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	l.conn = conn
+	l.mu.Unlock()
+
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		l.HandlePacket(context.Background(), buf[:n])
+	}
+}
+
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+// HandlePacket разбирает пакет и передает полученные значения в контроллер.
+func (l *Listener) HandlePacket(ctx context.Context, packet []byte) {
+	samples, errs := Parse(packet)
+	for _, err := range errs {
+		l.logger.Warn(err.Error())
+	}
+
+	for _, sample := range samples {
+		metric, err := l.apply(ctx, sample)
+		if err != nil {
+			continue
+		}
+
+		if l.config.IsSyncStore() && l.fileWriter != nil {
+			l.fileWriter.WriteMetrics(metric)
+		}
+	}
+}
+
+// apply сохраняет значение sample. Относительное изменение gauge вычисляется от текущего значения
+// и сохраняется под блокировкой, чтобы одновременные пакеты не теряли изменения друг друга.
+func (l *Listener) apply(ctx context.Context, sample Sample) (models.Metrics, error) {
+	if sample.MType == constants.Gauge && sample.Relative {
+		l.gaugeMu.Lock()
+		defer l.gaugeMu.Unlock()
+	}
+
+	metric := l.toMetric(ctx, sample)
+	_, err := l.controller.UpdateMetric(ctx, metric)
+	return metric, err
+}
+
+func (l *Listener) toMetric(ctx context.Context, sample Sample) models.Metrics {
+	metric := models.Metrics{
+		ID:    sample.Name,
+		MType: sample.MType,
+	}
+
+	switch sample.MType {
+	case constants.Counter:
+		delta := sample.Delta()
+		metric.Delta = &delta
+	case constants.Gauge:
+		value := sample.Value
+		if sample.Relative {
+			current := models.Metrics{ID: sample.Name, MType: constants.Gauge}
+			// если метрика еще не существует, то изменение считается от нуля
+			if _, err := l.controller.GetOneMetric(ctx, &current); err == nil {
+				value += *current.Value
+			}
+		}
+		metric.Value = &value
+	}
+
+	return metric
+}
@@ -0,0 +1,99 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"metrics/internal/config"
+	"metrics/internal/constants"
+	"metrics/internal/controller"
+	"metrics/internal/storage/inmemory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{name: "counter", line: "hits:1|c", want: Sample{Name: "hits", MType: constants.Counter, Value: 1}},
+		{name: "counter with rate", line: "hits:1|c|@0.1", want: Sample{Name: "hits", MType: constants.Counter, Value: 10}},
+		{name: "gauge", line: "temp:3.2|g", want: Sample{Name: "temp", MType: constants.Gauge, Value: 3.2}},
+		{name: "relative gauge", line: "temp:+2|g", want: Sample{Name: "temp", MType: constants.Gauge, Value: 2, Relative: true}},
+		{name: "negative gauge", line: "temp:-2|g|#env:prod", want: Sample{Name: "temp", MType: constants.Gauge, Value: -2, Relative: true}},
+		{name: "timer", line: "latency:320|ms", wantErr: true},
+		{name: "no type", line: "hits:1", wantErr: true},
+		{name: "bad value", line: "hits:abc|c", wantErr: true},
+		{name: "bad rate", line: "hits:1|c|@2", wantErr: true},
+		{name: "no name", line: ":1|c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListener_HandlePacket(t *testing.T) {
+	storage := inmemory.NewMemStorage()
+	listener := NewListener(&config.Config{}, nil, zap.NewNop(), controller.NewController(storage, zap.NewNop()))
+	ctx := context.Background()
+
+	listener.HandlePacket(ctx, []byte("hits:1|c\nhits:2|c|@0.5\ntemp:+2|g\ntemp:+3|g\nbad line\nload:1.5|g"))
+
+	hits, err := storage.GetCounter(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), hits)
+
+	temp, err := storage.GetGauge(ctx, "temp")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, temp)
+
+	load, err := storage.GetGauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, load)
+}
+
+func TestListener_ConcurrentRelativeGauge(t *testing.T) {
+	storage := inmemory.NewMemStorage()
+	listener := NewListener(&config.Config{}, nil, zap.NewNop(), controller.NewController(storage, zap.NewNop()))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			listener.HandlePacket(ctx, []byte("temp:+1|g"))
+		}()
+	}
+	wg.Wait()
+
+	temp, err := storage.GetGauge(ctx, "temp")
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, temp)
+}
+
+func TestListener_Close(t *testing.T) {
+	listener := NewListener(&config.Config{}, nil, zap.NewNop(), nil)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- listener.Serve(conn) }()
+	require.NoError(t, listener.Close())
+	assert.NoError(t, <-done)
+}
@@ -4,26 +4,70 @@ package inmemory
 import (
 	"context"
 	"fmt"
+	"maps"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"metrics/internal/constants"
 	"metrics/internal/filetransfer"
+	"metrics/internal/histogram"
+	"metrics/internal/history"
+	"metrics/internal/labels"
+	"metrics/internal/listing"
 	"metrics/internal/models"
+	"metrics/internal/retention"
 )
 
+// Ключами хранилища являются ключи серий (см. пакет labels): имя метрики вместе с метками.
+// Каждое обновление gauge и counter записывается в историю серии - кольцевой буфер на historySize точек.
+// Точки, удаленные из истории политиками хранения, сворачиваются в минутные и часовые агрегаты.
 type MemStorage struct {
-	gauge   map[string]float64
-	counter map[string]int64
-	m       sync.RWMutex
+	gauge       map[string]float64
+	counter     map[string]int64
+	histogram   map[string]models.Histogram
+	history     map[string]*history.Ring
+	rollups     map[string]*rollups
+	historySize int
+	idempotency map[string]*idempotencyEntry
+	m           sync.RWMutex
+}
+
+// Ключ Idempotency-Key. Пока запрос обрабатывается, result равен nil.
+type idempotencyEntry struct {
+	result  *models.IdempotencyResult
+	created time.Time
+}
+
+// Агрегаты истории одной серии, упорядоченные по времени.
+type rollups struct {
+	minute []models.Aggregate
+	hour   []models.Aggregate
 }
 
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		gauge:   make(map[string]float64),
-		counter: make(map[string]int64),
+		gauge:       make(map[string]float64),
+		counter:     make(map[string]int64),
+		histogram:   make(map[string]models.Histogram),
+		history:     make(map[string]*history.Ring),
+		rollups:     make(map[string]*rollups),
+		historySize: constants.DefaultHistorySize,
+		idempotency: make(map[string]*idempotencyEntry),
 	}
 }
 
+// SetHistorySize задает количество точек, хранимых в истории каждой серии.
+// Действует для серий, история которых еще не создана.
+func (ms *MemStorage) SetHistorySize(size int) {
+	ms.m.Lock()
+	if size > 0 {
+		ms.historySize = size
+	}
+	ms.m.Unlock()
+}
+
 func (ms *MemStorage) SetGauge(ctx context.Context, key string, value float64) (err error) {
 	if key == "" {
 		err = fmt.Errorf("имя метрики обязательно для заполнения")
@@ -31,6 +75,7 @@ func (ms *MemStorage) SetGauge(ctx context.Context, key string, value float64) (
 	}
 	ms.m.Lock()
 	ms.gauge[key] = value
+	ms.addPoint(constants.Gauge, key, value)
 	ms.m.Unlock()
 	return
 }
@@ -50,6 +95,7 @@ func (ms *MemStorage) SetCounter(ctx context.Context, key string, value *int64)
 	} else {
 		ms.counter[key] = *value
 	}
+	ms.addPoint(constants.Counter, key, float64(ms.counter[key]))
 	ms.m.Unlock()
 	return
 }
@@ -65,6 +111,40 @@ func (ms *MemStorage) SetCounterFromFile(ctx context.Context, key string, value
 	return
 }
 
+// SetHistogram добавляет значения гистограммы к уже сохраненной и возвращает в value итоговое значение.
+func (ms *MemStorage) SetHistogram(ctx context.Context, key string, value *models.Histogram) (err error) {
+	if key == "" {
+		err = fmt.Errorf("имя метрики обязательно для заполнения")
+		return err
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	stored, ok := ms.histogram[key]
+	if ok {
+		if err = histogram.Merge(&stored, *value); err != nil {
+			return err
+		}
+	} else {
+		stored = histogram.Clone(*value)
+	}
+	ms.histogram[key] = stored
+	*value = histogram.Clone(stored)
+	return
+}
+
+func (ms *MemStorage) SetHistogramFromFile(ctx context.Context, key string, value models.Histogram) (err error) {
+	if key == "" {
+		err = fmt.Errorf("имя метрики обязательно для заполнения")
+		return err
+	}
+	ms.m.Lock()
+	ms.histogram[key] = histogram.Clone(value)
+	ms.m.Unlock()
+	return
+}
+
 func (ms *MemStorage) GetGauge(ctx context.Context, key string) (value float64, err error) {
 	ms.m.Lock()
 	value, ok := ms.gauge[key]
@@ -86,13 +166,304 @@ func (ms *MemStorage) GetCounter(ctx context.Context, key string) (value int64,
 	return
 }
 
-func (ms *MemStorage) GetAllGauge(ctx context.Context) map[string]float64 {
-	return ms.gauge
+func (ms *MemStorage) GetHistogram(ctx context.Context, key string) (value models.Histogram, err error) {
+	ms.m.Lock()
+	stored, ok := ms.histogram[key]
+	ms.m.Unlock()
+	if !ok {
+		err = fmt.Errorf("значение метрики %s типа histogram не найдено", key)
+		return
+	}
+	return histogram.Clone(stored), nil
+}
+
+// GetRange возвращает точки истории серии key типа mtype за интервал [from, to].
+// Если история серии отсутствует, возвращается пустой список.
+func (ms *MemStorage) GetRange(ctx context.Context, mtype string, key string, from, to time.Time) (points []models.Point, err error) {
+	ms.m.RLock()
+	ring, ok := ms.history[historyKey(mtype, key)]
+	ms.m.RUnlock()
+	if !ok {
+		return []models.Point{}, nil
+	}
+	return ring.Range(from, to), nil
+}
+
+// GetRanges возвращает историю серий keys типа mtype за интервал [from, to] одним обращением к хранилищу.
+// Серии без истории в результат не попадают.
+func (ms *MemStorage) GetRanges(ctx context.Context, mtype string, keys []string, from, to time.Time) (points map[string][]models.Point, err error) {
+	points = make(map[string][]models.Point, len(keys))
+
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+
+	for _, key := range keys {
+		if ring, ok := ms.history[historyKey(mtype, key)]; ok {
+			if series := ring.Range(from, to); len(series) > 0 {
+				points[key] = series
+			}
+		}
+	}
+	return points, nil
+}
+
+// GetAggregates возвращает агрегаты истории серии key типа mtype с разрешением resolution
+// (retention.Minute или retention.Hour), начало которых лежит в интервале [from, to].
+func (ms *MemStorage) GetAggregates(ctx context.Context, mtype string, key string, resolution time.Duration, from, to time.Time) (aggregates []models.Aggregate, err error) {
+	aggregates = []models.Aggregate{}
+
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+
+	series, ok := ms.rollups[historyKey(mtype, key)]
+	if !ok {
+		return aggregates, nil
+	}
+
+	var stored []models.Aggregate
+	switch resolution {
+	case retention.Minute:
+		stored = series.minute
+	case retention.Hour:
+		stored = series.hour
+	default:
+		return nil, fmt.Errorf("разрешение %s не поддерживается", resolution)
+	}
+
+	for _, aggregate := range stored {
+		if aggregate.Time.Before(from) || aggregate.Time.After(to) {
+			continue
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	return aggregates, nil
+}
+
+// ApplyRetention применяет политики хранения к истории всех серий на момент now.
+func (ms *MemStorage) ApplyRetention(ctx context.Context, policies retention.Policies, now time.Time) (err error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	for hkey, ring := range ms.history {
+		_, key, _ := strings.Cut(hkey, ":")
+		name, _ := labels.SplitSeriesKey(key)
+		policy, ok := policies.Find(name)
+		if !ok {
+			continue
+		}
+
+		rawCutoff, minuteCutoff, hourCutoff := policy.Cutoffs(now)
+
+		series, ok := ms.rollups[hkey]
+		if !ok {
+			series = &rollups{}
+		}
+
+		if !rawCutoff.IsZero() {
+			for _, aggregate := range retention.Rollup(ring.RemoveBefore(rawCutoff), retention.Minute) {
+				series.minute = retention.Append(series.minute, aggregate)
+			}
+		}
+
+		if !minuteCutoff.IsZero() {
+			var old []models.Aggregate
+			old, series.minute = splitAggregates(series.minute, minuteCutoff)
+			for _, aggregate := range retention.RollupAggregates(old, retention.Hour) {
+				series.hour = retention.Append(series.hour, aggregate)
+			}
+		}
+
+		if !hourCutoff.IsZero() {
+			_, series.hour = splitAggregates(series.hour, hourCutoff)
+		}
+
+		if len(series.minute) > 0 || len(series.hour) > 0 {
+			ms.rollups[hkey] = series
+		} else {
+			delete(ms.rollups, hkey)
+		}
+	}
+	return nil
+}
+
+// splitAggregates делит упорядоченные агрегаты на начавшиеся раньше t и остальные.
+func splitAggregates(aggregates []models.Aggregate, t time.Time) (before, after []models.Aggregate) {
+	i := 0
+	for i < len(aggregates) && aggregates[i].Time.Before(t) {
+		i++
+	}
+	return aggregates[:i], append([]models.Aggregate(nil), aggregates[i:]...)
+}
+
+// DeleteMetric удаляет серию key типа mtype вместе с ее историей.
+func (ms *MemStorage) DeleteMetric(ctx context.Context, mtype string, key string) (err error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	if !ms.exists(mtype, key) {
+		return fmt.Errorf("%w: %s типа %s", models.ErrMetricNotFound, key, mtype)
+	}
+	ms.delete(mtype, key)
+	return nil
+}
+
+// DeleteMetrics удаляет все серии, имена которых соответствуют шаблону glob (см. пакет listing).
+// Если mtype не пустой, удаляются только серии этого типа. Возвращает количество удаленных серий.
+func (ms *MemStorage) DeleteMetrics(ctx context.Context, mtype string, pattern string) (deleted int, err error) {
+	re, err := regexp.Compile(listing.GlobToRegexp(pattern))
+	if err != nil {
+		return 0, err
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	for _, t := range []string{constants.Gauge, constants.Counter, constants.Histogram} {
+		if mtype != "" && mtype != t {
+			continue
+		}
+		for _, key := range ms.keys(t) {
+			if name, _ := labels.SplitSeriesKey(key); re.MatchString(name) {
+				ms.delete(t, key)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// ResetCounter обнуляет значение counter.
+func (ms *MemStorage) ResetCounter(ctx context.Context, key string) (err error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	if _, ok := ms.counter[key]; !ok {
+		return fmt.Errorf("%w: %s типа counter", models.ErrMetricNotFound, key)
+	}
+	ms.counter[key] = 0
+	ms.addPoint(constants.Counter, key, 0)
+	return nil
+}
 
+// RenameMetric переименовывает серию key типа mtype в newKey вместе с историей.
+func (ms *MemStorage) RenameMetric(ctx context.Context, mtype string, key string, newKey string) (err error) {
+	if newKey == "" {
+		return fmt.Errorf("имя метрики обязательно для заполнения")
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	if !ms.exists(mtype, key) {
+		return fmt.Errorf("%w: %s типа %s", models.ErrMetricNotFound, key, mtype)
+	}
+	if ms.exists(mtype, newKey) {
+		return fmt.Errorf("%w: %s типа %s", models.ErrMetricExists, newKey, mtype)
+	}
+
+	switch mtype {
+	case constants.Gauge:
+		ms.gauge[newKey] = ms.gauge[key]
+	case constants.Counter:
+		ms.counter[newKey] = ms.counter[key]
+	case constants.Histogram:
+		ms.histogram[newKey] = ms.histogram[key]
+	}
+	if ring, ok := ms.history[historyKey(mtype, key)]; ok {
+		ms.history[historyKey(mtype, newKey)] = ring
+	}
+	if series, ok := ms.rollups[historyKey(mtype, key)]; ok {
+		ms.rollups[historyKey(mtype, newKey)] = series
+	}
+	ms.delete(mtype, key)
+	return nil
+}
+
+// exists проверяет наличие серии. Вызывается под блокировкой ms.m.
+func (ms *MemStorage) exists(mtype string, key string) (ok bool) {
+	switch mtype {
+	case constants.Gauge:
+		_, ok = ms.gauge[key]
+	case constants.Counter:
+		_, ok = ms.counter[key]
+	case constants.Histogram:
+		_, ok = ms.histogram[key]
+	}
+	return ok
+}
+
+// keys возвращает ключи всех серий типа mtype. Вызывается под блокировкой ms.m.
+func (ms *MemStorage) keys(mtype string) (keys []string) {
+	switch mtype {
+	case constants.Gauge:
+		for key := range ms.gauge {
+			keys = append(keys, key)
+		}
+	case constants.Counter:
+		for key := range ms.counter {
+			keys = append(keys, key)
+		}
+	case constants.Histogram:
+		for key := range ms.histogram {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// delete удаляет серию и ее историю. Вызывается под блокировкой ms.m.
+func (ms *MemStorage) delete(mtype string, key string) {
+	switch mtype {
+	case constants.Gauge:
+		delete(ms.gauge, key)
+	case constants.Counter:
+		delete(ms.counter, key)
+	case constants.Histogram:
+		delete(ms.histogram, key)
+	}
+	delete(ms.history, historyKey(mtype, key))
+	delete(ms.rollups, historyKey(mtype, key))
+}
+
+// addPoint записывает значение в историю серии. Вызывается под блокировкой ms.m.
+func (ms *MemStorage) addPoint(mtype string, key string, value float64) {
+	hkey := historyKey(mtype, key)
+	ring, ok := ms.history[hkey]
+	if !ok {
+		ring = history.NewRing(ms.historySize)
+		ms.history[hkey] = ring
+	}
+	ring.Add(models.Point{Time: time.Now(), Value: value})
 }
 
+func historyKey(mtype string, key string) string {
+	return mtype + ":" + key
+}
+
+// GetAllGauge возвращает копию значений gauge: вызывающий может обходить ее одновременно с обновлением метрик.
+func (ms *MemStorage) GetAllGauge(ctx context.Context) map[string]float64 {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	return maps.Clone(ms.gauge)
+}
+
+// GetAllCounter возвращает копию значений counter (см. GetAllGauge).
 func (ms *MemStorage) GetAllCounter(ctx context.Context) map[string]int64 {
-	return ms.counter
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	return maps.Clone(ms.counter)
+}
+
+func (ms *MemStorage) GetAllHistogram(ctx context.Context) map[string]models.Histogram {
+	histograms := make(map[string]models.Histogram)
+
+	ms.m.Lock()
+	for key, value := range ms.histogram {
+		histograms[key] = histogram.Clone(value)
+	}
+	ms.m.Unlock()
+
+	return histograms
 }
 
 func (ms *MemStorage) GetAll(ctx context.Context) map[string]interface{} {
@@ -107,6 +478,10 @@ func (ms *MemStorage) GetAll(ctx context.Context) map[string]interface{} {
 	for key, value := range ms.counter {
 		allMetrics[key] = value
 	}
+
+	for key, value := range ms.histogram {
+		allMetrics[key] = histogram.Clone(value)
+	}
 	ms.m.Unlock()
 
 	return allMetrics
@@ -118,19 +493,33 @@ func (ms *MemStorage) GetAllMetricsInJSON() []models.Metrics {
 
 	ms.m.Lock()
 	for key, value := range ms.gauge {
-
+		name, metricLabels := labels.SplitSeriesKey(key)
 		metric := models.Metrics{
-			ID:    key,
-			MType: constants.Gauge,
-			Value: &value}
+			ID:     name,
+			MType:  constants.Gauge,
+			Value:  &value,
+			Labels: metricLabels}
 		metrics = append(metrics, metric)
 	}
 
 	for key, value := range ms.counter {
+		name, metricLabels := labels.SplitSeriesKey(key)
 		metric := models.Metrics{
-			ID:    key,
-			MType: constants.Counter,
-			Delta: &value}
+			ID:     name,
+			MType:  constants.Counter,
+			Delta:  &value,
+			Labels: metricLabels}
+		metrics = append(metrics, metric)
+	}
+
+	for key, value := range ms.histogram {
+		value = histogram.Clone(value)
+		name, metricLabels := labels.SplitSeriesKey(key)
+		metric := models.Metrics{
+			ID:        name,
+			MType:     constants.Histogram,
+			Histogram: &value,
+			Labels:    metricLabels}
 		metrics = append(metrics, metric)
 	}
 	ms.m.Unlock()
@@ -138,6 +527,99 @@ func (ms *MemStorage) GetAllMetricsInJSON() []models.Metrics {
 	return metrics
 }
 
+// ListMetrics возвращает страницу списка метрик, удовлетворяющих запросу, и общее количество таких метрик.
+func (ms *MemStorage) ListMetrics(ctx context.Context, query *listing.Query) (metrics []models.Metrics, total int, err error) {
+	metrics, total = query.Apply(ms.GetAllMetricsInJSON())
+	return metrics, total, nil
+}
+
+// WalkMetrics вызывает fn для каждой метрики в порядке возрастания имен и меток.
+// Метрики берутся из снимка хранилища, поэтому fn может обращаться к хранилищу.
+func (ms *MemStorage) WalkMetrics(ctx context.Context, fn func(metric models.Metrics) error) error {
+	query := listing.Query{}
+	if err := query.Validate(); err != nil {
+		return err
+	}
+	metrics, _ := query.Apply(ms.GetAllMetricsInJSON())
+	for _, metric := range metrics {
+		if err := fn(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceMetrics заменяет значения всех метрик на metrics. Если metrics содержит неверные данные,
+// хранилище не изменяется. История серий сохраняется, новые значения добавляются в историю.
+func (ms *MemStorage) ReplaceMetrics(ctx context.Context, metrics []models.Metrics) error {
+	replacement := NewMemStorage()
+	if err := replacement.SaveMetrics(ctx, metrics); err != nil {
+		return err
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.gauge = replacement.gauge
+	ms.counter = replacement.counter
+	ms.histogram = replacement.histogram
+	for key, value := range ms.gauge {
+		ms.addPoint(constants.Gauge, key, value)
+	}
+	for key, value := range ms.counter {
+		ms.addPoint(constants.Counter, key, float64(value))
+	}
+	return nil
+}
+
+// ClaimIdempotencyKey резервирует ключ для обработки запроса. Если ключ уже зарезервирован
+// не раньше notBefore, возвращается сохраненный ответ (nil, если запрос еще обрабатывается) и claimed = false.
+// Ключ без сохраненного ответа, зарезервированный раньше leaseNotBefore, резервируется заново.
+func (ms *MemStorage) ClaimIdempotencyKey(ctx context.Context, key string, notBefore, leaseNotBefore time.Time) (result *models.IdempotencyResult, claimed bool, err error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	if entry, ok := ms.idempotency[key]; ok && !entry.created.Before(notBefore) {
+		if entry.result != nil || !entry.created.Before(leaseNotBefore) {
+			return entry.result, false, nil
+		}
+	}
+	ms.idempotency[key] = &idempotencyEntry{created: time.Now()}
+	return nil, true, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с ключом key.
+func (ms *MemStorage) CompleteIdempotencyKey(ctx context.Context, key string, result models.IdempotencyResult) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	if entry, ok := ms.idempotency[key]; ok {
+		entry.result = &result
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey снимает резервирование ключа, чтобы запрос можно было повторить.
+func (ms *MemStorage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ms.m.Lock()
+	delete(ms.idempotency, key)
+	ms.m.Unlock()
+	return nil
+}
+
+// ExpireIdempotencyKeys удаляет ключи, зарезервированные раньше before.
+func (ms *MemStorage) ExpireIdempotencyKeys(ctx context.Context, before time.Time) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	for key, entry := range ms.idempotency {
+		if entry.created.Before(before) {
+			delete(ms.idempotency, key)
+		}
+	}
+	return nil
+}
+
 func (ms *MemStorage) UploadData(filePath string) {
 
 	fileReader, err := filetransfer.NewFileReader(filePath)
@@ -154,11 +636,16 @@ func (ms *MemStorage) UploadData(filePath string) {
 
 	if len(metrics) > 0 {
 		for _, metric := range metrics {
+			key := labels.SeriesKey(metric.ID, metric.Labels)
 			switch metric.MType {
 			case constants.Gauge:
-				ms.SetGauge(context.Background(), metric.ID, *metric.Value)
+				ms.SetGauge(context.Background(), key, *metric.Value)
 			case constants.Counter:
-				ms.SetCounterFromFile(context.Background(), metric.ID, *metric.Delta)
+				ms.SetCounterFromFile(context.Background(), key, *metric.Delta)
+			case constants.Histogram:
+				if metric.Histogram != nil {
+					ms.SetHistogramFromFile(context.Background(), key, *metric.Histogram)
+				}
 			}
 		}
 	}
@@ -168,24 +655,93 @@ func (ms *MemStorage) CheckConnection(ctx context.Context) (err error) {
 	return fmt.Errorf("in-memory storage is used")
 }
 
+// SaveMetrics сохраняет metrics и возвращает в них итоговые значения counter и histogram.
+// Пакет применяется целиком: если какая-либо из метрик неверна, хранилище не изменяется.
 func (ms *MemStorage) SaveMetrics(ctx context.Context, metrics []models.Metrics) (err error) {
-	for _, metric := range metrics {
-		var zero float64 = 0
+	type point struct {
+		mtype string
+		key   string
+		value float64
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	// Новые значения накапливаются отдельно и переносятся в хранилище только после проверки всего пакета.
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	histograms := make(map[string]models.Histogram)
+	points := make([]point, 0, len(metrics))
+	results := make([]models.Metrics, len(metrics))
+
+	for i, metric := range metrics {
+		if metric.ID == "" {
+			return fmt.Errorf("имя метрики обязательно для заполнения")
+		}
+		key := labels.SeriesKey(metric.ID, metric.Labels)
 		switch metric.MType {
 		case constants.Gauge:
-			if metric.Value == nil {
-				metric.Value = &zero
-			}
-			if err = ms.SetGauge(ctx, metric.ID, *metric.Value); err != nil {
-				return err
+			var value float64
+			if metric.Value != nil {
+				value = *metric.Value
 			}
+			gauges[key] = value
+			points = append(points, point{constants.Gauge, key, value})
 		case constants.Counter:
-			if err = ms.SetCounter(ctx, metric.ID, metric.Delta); err != nil {
-				return err
+			if metric.Delta == nil {
+				return fmt.Errorf("значение метрики %s типа counter не заполнено", metric.ID)
+			}
+			total, ok := counters[key]
+			if !ok {
+				total = ms.counter[key]
+			}
+			total += *metric.Delta
+			counters[key] = total
+			results[i].Delta = &total
+			points = append(points, point{constants.Counter, key, float64(total)})
+		case constants.Histogram:
+			if metric.Histogram == nil {
+				return fmt.Errorf("значение метрики %s типа histogram не заполнено", metric.ID)
 			}
+			stored, ok := histograms[key]
+			if !ok {
+				stored, ok = ms.histogram[key]
+				stored = histogram.Clone(stored)
+			}
+			if ok {
+				if err = histogram.Merge(&stored, *metric.Histogram); err != nil {
+					return err
+				}
+			} else {
+				stored = histogram.Clone(*metric.Histogram)
+			}
+			histograms[key] = stored
+			total := histogram.Clone(stored)
+			results[i].Histogram = &total
 		default:
 			return fmt.Errorf("неверный формат для обновления метрик (недопустимый тип): %s", metric.MType)
 		}
 	}
+
+	for key, value := range gauges {
+		ms.gauge[key] = value
+	}
+	for key, value := range counters {
+		ms.counter[key] = value
+	}
+	for key, value := range histograms {
+		ms.histogram[key] = value
+	}
+	for _, p := range points {
+		ms.addPoint(p.mtype, p.key, p.value)
+	}
+	for i, result := range results {
+		switch {
+		case result.Delta != nil:
+			*metrics[i].Delta = *result.Delta
+		case result.Histogram != nil:
+			*metrics[i].Histogram = *result.Histogram
+		}
+	}
 	return
 }
@@ -0,0 +1,178 @@
+package inmemory
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics/internal/constants"
+	"metrics/internal/filetransfer"
+	"metrics/internal/models"
+	"metrics/internal/retention"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStorage_ApplyRetention(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+
+	for _, value := range []float64{1, 5, 3} {
+		require.NoError(t, ms.SetGauge(ctx, "Alloc", value))
+		require.NoError(t, ms.SetGauge(ctx, "Other", value))
+	}
+
+	policies := retention.Policies{{Pattern: "Alloc", Raw: time.Hour}}
+	now := time.Now().Add(2 * time.Hour)
+	require.NoError(t, ms.ApplyRetention(ctx, policies, now))
+
+	from, to := now.Add(-24*time.Hour), now
+
+	points, err := ms.GetRange(ctx, constants.Gauge, "Alloc", from, to)
+	require.NoError(t, err)
+	assert.Empty(t, points)
+
+	aggregates, err := ms.GetAggregates(ctx, constants.Gauge, "Alloc", retention.Minute, from, to)
+	require.NoError(t, err)
+	var count int64
+	for _, aggregate := range aggregates {
+		count += aggregate.Count
+		assert.LessOrEqual(t, aggregate.Min, aggregate.Max)
+	}
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, 3.0, aggregates[len(aggregates)-1].Last)
+
+	points, err = ms.GetRange(ctx, constants.Gauge, "Other", from, to)
+	require.NoError(t, err)
+	assert.Len(t, points, 3)
+}
+
+func TestMemStorage_GetRanges(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+
+	require.NoError(t, ms.SetGauge(ctx, "Alloc", 1))
+	require.NoError(t, ms.SetGauge(ctx, "Alloc", 2))
+	require.NoError(t, ms.SetGauge(ctx, `CPU{cpu="1"}`, 3))
+
+	now := time.Now()
+	points, err := ms.GetRanges(ctx, constants.Gauge, []string{"Alloc", `CPU{cpu="1"}`, "Missing"}, now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, points, 2)
+	assert.Len(t, points["Alloc"], 2)
+	assert.Equal(t, 3.0, points[`CPU{cpu="1"}`][0].Value)
+}
+
+func TestMemStorage_AdminOperations(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+
+	delta := int64(5)
+	require.NoError(t, ms.SetCounter(ctx, "PollCount", &delta))
+	require.NoError(t, ms.SetGauge(ctx, "Heap", 1))
+	require.NoError(t, ms.SetGauge(ctx, `CPU{cpu="1"}`, 1))
+	require.NoError(t, ms.SetGauge(ctx, `CPU{cpu="2"}`, 2))
+
+	require.NoError(t, ms.ResetCounter(ctx, "PollCount"))
+	value, err := ms.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), value)
+	assert.ErrorIs(t, ms.ResetCounter(ctx, "Unknown"), models.ErrMetricNotFound)
+
+	require.NoError(t, ms.RenameMetric(ctx, constants.Gauge, "Heap", "HeapAlloc"))
+	_, err = ms.GetGauge(ctx, "Heap")
+	assert.Error(t, err)
+	points, err := ms.GetRange(ctx, constants.Gauge, "HeapAlloc", time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, points, 1)
+	assert.ErrorIs(t, ms.RenameMetric(ctx, constants.Gauge, `CPU{cpu="1"}`, `CPU{cpu="2"}`), models.ErrMetricExists)
+
+	deleted, err := ms.DeleteMetrics(ctx, "", "CPU*")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	require.NoError(t, ms.DeleteMetric(ctx, constants.Gauge, "HeapAlloc"))
+	assert.ErrorIs(t, ms.DeleteMetric(ctx, constants.Gauge, "HeapAlloc"), models.ErrMetricNotFound)
+
+	// После перезаписи файла удаленные метрики не восстанавливаются.
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	writer, err := filetransfer.NewFileWriter(path)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteMetrics(models.Metrics{ID: "HeapAlloc", MType: constants.Gauge, Value: new(float64)}))
+	require.NoError(t, writer.Rewrite(ms.GetAllMetricsInJSON()...))
+	require.NoError(t, writer.Close())
+
+	restored := NewMemStorage()
+	restored.UploadData(path)
+	assert.Empty(t, restored.GetAllGauge(ctx))
+	assert.Equal(t, map[string]int64{"PollCount": 0}, restored.GetAllCounter(ctx))
+}
+
+func TestMemStorage_ReplaceMetrics(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	require.NoError(t, ms.SetGauge(ctx, "Alloc", 1))
+	require.NoError(t, ms.SetGauge(ctx, "Old", 1))
+
+	value := 2.0
+	delta := int64(5)
+	require.NoError(t, ms.ReplaceMetrics(ctx, []models.Metrics{
+		{ID: "Alloc", MType: constants.Gauge, Value: &value},
+		{ID: "PollCount", MType: constants.Counter, Delta: &delta},
+	}))
+
+	var keys []string
+	require.NoError(t, ms.WalkMetrics(ctx, func(metric models.Metrics) error {
+		keys = append(keys, metric.ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"Alloc", "PollCount"}, keys)
+
+	points, err := ms.GetRange(ctx, constants.Gauge, "Alloc", time.Now().Add(-time.Minute), time.Now())
+	require.NoError(t, err)
+	assert.Len(t, points, 2)
+
+	// при ошибке хранилище не изменяется
+	require.Error(t, ms.ReplaceMetrics(ctx, []models.Metrics{{ID: "Bad", MType: "unknown"}}))
+	counter, err := ms.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+}
+
+func TestMemStorage_SaveMetricsAtomic(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	require.NoError(t, ms.SaveMetrics(ctx, []models.Metrics{
+		{ID: "Latency", MType: constants.Histogram, Histogram: &models.Histogram{Bounds: []float64{1, 2}, Counts: []int64{1, 0, 0}, Count: 1}},
+	}))
+
+	value := 2.0
+	delta := int64(5)
+	err := ms.SaveMetrics(ctx, []models.Metrics{
+		{ID: "Alloc", MType: constants.Gauge, Value: &value},
+		{ID: "PollCount", MType: constants.Counter, Delta: &delta},
+		{ID: "Latency", MType: constants.Histogram, Histogram: &models.Histogram{Bounds: []float64{5}, Counts: []int64{1, 0}, Count: 1}},
+	})
+	require.Error(t, err)
+
+	// пакет с неверной метрикой не применяется целиком
+	_, err = ms.GetGauge(ctx, "Alloc")
+	assert.Error(t, err)
+	_, err = ms.GetCounter(ctx, "PollCount")
+	assert.Error(t, err)
+	points, err := ms.GetRange(ctx, constants.Gauge, "Alloc", time.Now().Add(-time.Minute), time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, points)
+	assert.Equal(t, int64(5), delta)
+
+	// итоговые значения возвращаются с учетом предыдущих метрик пакета
+	first, second := int64(2), int64(3)
+	require.NoError(t, ms.SaveMetrics(ctx, []models.Metrics{
+		{ID: "PollCount", MType: constants.Counter, Delta: &first},
+		{ID: "PollCount", MType: constants.Counter, Delta: &second},
+	}))
+	assert.Equal(t, int64(2), first)
+	assert.Equal(t, int64(5), second)
+}
@@ -4,20 +4,55 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"metrics/internal/config"
 	"metrics/internal/constants"
+	"metrics/internal/histogram"
+	"metrics/internal/labels"
+	"metrics/internal/listing"
 	"metrics/internal/models"
+	"metrics/internal/retention"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"go.uber.org/zap"
 )
 
+// Запросы обновления gauge и counter. Вместе с обновлением текущего значения серии
+// итоговое значение записывается в таблицу истории metrics_history. Запрос обновления counter
+// возвращает итоговое значение счетчика.
+const (
+	queryUpsertGauge = `
+	WITH saved AS (
+		INSERT INTO metrics (id, labels, mtype, value)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id, labels) DO UPDATE
+		SET mtype = EXCLUDED.mtype, value = EXCLUDED.value
+		RETURNING id, labels, mtype, value
+	)
+	INSERT INTO metrics_history (id, labels, mtype, value)
+	SELECT id, labels, mtype, value FROM saved;
+	`
+	queryUpsertCounter = `
+	WITH saved AS (
+		INSERT INTO metrics (id, labels, mtype, delta)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id, labels) DO UPDATE
+		SET mtype = EXCLUDED.mtype, delta = metrics.delta + EXCLUDED.delta
+		RETURNING id, labels, mtype, delta
+	)
+	INSERT INTO metrics_history (id, labels, mtype, value)
+	SELECT id, labels, mtype, delta::DOUBLE PRECISION FROM saved
+	RETURNING (SELECT delta FROM saved);
+	`
+)
+
 type PostgresStorage struct {
 	db     *sql.DB
 	config *config.Config
@@ -51,15 +86,60 @@ func (ps *PostgresStorage) Bootstrap(ctx context.Context) error {
 	}
 	defer tx.Rollback()
 
+	// Серия метрики определяется именем (id) и метками (labels). В таблицах, созданных до появления меток,
+	// первичный ключ состоит только из id и пересоздается.
 	query := `
 	CREATE TABLE IF NOT EXISTS metrics (
-		id VARCHAR(50) PRIMARY KEY,
+		id VARCHAR(50) NOT NULL,
+		labels TEXT NOT NULL DEFAULT '',
 		mtype VARCHAR(10) NOT NULL,
 		value DOUBLE PRECISION DEFAULT 0,
-		delta BIGINT DEFAULT 0
+		delta BIGINT DEFAULT 0,
+		PRIMARY KEY (id, labels)
+	);
+	ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram JSONB;
+	ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT '';
+	DO $$
+	BEGIN
+		IF (SELECT count(*) FROM information_schema.key_column_usage
+			WHERE table_name = 'metrics' AND constraint_name = 'metrics_pkey') = 1 THEN
+			ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+			ALTER TABLE metrics ADD PRIMARY KEY (id, labels);
+		END IF;
+	END $$;
+	CREATE TABLE IF NOT EXISTS metrics_history (
+		id VARCHAR(50) NOT NULL,
+		labels TEXT NOT NULL DEFAULT '',
+		mtype VARCHAR(10) NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+	);
+	CREATE INDEX IF NOT EXISTS metrics_history_series_idx ON metrics_history (id, labels, mtype, created_at);
+	CREATE TABLE IF NOT EXISTS metrics_rollup (
+		id VARCHAR(50) NOT NULL,
+		labels TEXT NOT NULL DEFAULT '',
+		mtype VARCHAR(10) NOT NULL,
+		resolution INTEGER NOT NULL,
+		bucket TIMESTAMPTZ NOT NULL,
+		min DOUBLE PRECISION NOT NULL,
+		max DOUBLE PRECISION NOT NULL,
+		avg DOUBLE PRECISION NOT NULL,
+		last DOUBLE PRECISION NOT NULL,
+		count BIGINT NOT NULL,
+		PRIMARY KEY (id, labels, mtype, resolution, bucket)
+	);
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		status INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		body BYTEA,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
 	);`
 
-	tx.ExecContext(ctx, query)
+	// При ошибке миграции сервер не должен запускаться на старой схеме: ON CONFLICT (id, labels) не совпадет с ключом.
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("ошибка при создании таблиц: %w", err)
+	}
 
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("error creating tables: %v", err)
@@ -73,17 +153,13 @@ func (ps *PostgresStorage) SetGauge(ctx context.Context, key string, value float
 		err = fmt.Errorf("имя метрики обязательно для заполнения")
 		return
 	}
-	query := `
-	INSERT INTO metrics (id, mtype, value)
-	VALUES ($1, $2, $3) 
-	ON CONFLICT (id) DO UPDATE
-	SET mtype = EXCLUDED.mtype, value = EXCLUDED.value;
-	`
+	query := queryUpsertGauge
+	id, metricLabels := splitKey(key)
 
 	retries := 0
 	for retries < 4 {
 		ps.m.Lock()
-		_, err = ps.db.ExecContext(ctx, query, key, constants.Gauge, value)
+		_, err = ps.db.ExecContext(ctx, query, id, metricLabels, constants.Gauge, value)
 		ps.m.Unlock()
 		if err == nil {
 			return nil
@@ -108,23 +184,17 @@ func (ps *PostgresStorage) SetCounter(ctx context.Context, key string, value *in
 		return
 	}
 
-	query := `
-	INSERT INTO metrics (id, mtype, delta)
-	VALUES ($1, $2, $3) 
-	ON CONFLICT (id) DO UPDATE
-	SET mtype = EXCLUDED.mtype, delta = metrics.delta + EXCLUDED.delta;
-	`
+	query := queryUpsertCounter
+	id, metricLabels := splitKey(key)
 
 	retries := 0
 	for retries < 4 {
+		var total int64
 		ps.m.Lock()
-		_, err = ps.db.ExecContext(ctx, query, key, constants.Counter, value)
+		err = ps.db.QueryRowContext(ctx, query, id, metricLabels, constants.Counter, value).Scan(&total)
 		ps.m.Unlock()
 		if err == nil {
-			val, err := ps.GetCounter(ctx, key)
-			if err == nil {
-				*value = val
-			}
+			*value = total
 			return nil
 		}
 		if !isRetriableError(err) {
@@ -144,15 +214,95 @@ func (ps *PostgresStorage) SetCounter(ctx context.Context, key string, value *in
 	return err
 }
 
+// SetHistogram добавляет значения гистограммы к уже сохраненной и возвращает в value итоговое значение.
+func (ps *PostgresStorage) SetHistogram(ctx context.Context, key string, value *models.Histogram) (err error) {
+	if key == "" {
+		err = fmt.Errorf("имя метрики обязательно для заполнения")
+		return
+	}
+
+	retries := 0
+	for retries < 4 {
+		err = ps.withTx(ctx, func(tx *sql.Tx) error {
+			return ps.saveHistogram(ctx, tx, key, value)
+		})
+		if err == nil {
+			return nil
+		}
+		if !isRetriableError(err) {
+			return err
+		}
+		retries++
+		if retries == 4 {
+			err = fmt.Errorf("ошибка при сохранении histogram в бд: %s, %w", key, err)
+			ps.logger.Error(err.Error())
+			return err
+		}
+		time.Sleep(time.Duration(retries*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+	}
+	return err
+}
+
+// saveHistogram объединяет гистограмму с сохраненной в рамках транзакции tx.
+// Строка метрики блокируется до конца транзакции, чтобы параллельные обновления не потерялись.
+func (ps *PostgresStorage) saveHistogram(ctx context.Context, tx *sql.Tx, key string, value *models.Histogram) error {
+	querySelect := `
+	SELECT histogram FROM metrics WHERE id = $1 AND labels = $2 AND mtype = $3 FOR UPDATE;
+	`
+	queryUpsert := `
+	INSERT INTO metrics (id, labels, mtype, histogram)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id, labels) DO UPDATE
+	SET mtype = EXCLUDED.mtype, histogram = EXCLUDED.histogram;
+	`
+	id, metricLabels := splitKey(key)
+
+	var data []byte
+	ps.m.Lock()
+	err := tx.QueryRowContext(ctx, querySelect, id, metricLabels, constants.Histogram).Scan(&data)
+	ps.m.Unlock()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ошибка при чтении histogram из бд: %s, %w", key, err)
+	}
+
+	merged := histogram.Clone(*value)
+	if data != nil {
+		var stored models.Histogram
+		if err = json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("ошибка преобразования histogram %s из JSON: %w", key, err)
+		}
+		if err = histogram.Merge(&stored, *value); err != nil {
+			return err
+		}
+		merged = stored
+	}
+
+	data, err = json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	ps.m.Lock()
+	_, err = tx.ExecContext(ctx, queryUpsert, id, metricLabels, constants.Histogram, data)
+	ps.m.Unlock()
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении histogram в бд: %s, %w", key, err)
+	}
+
+	*value = merged
+	return nil
+}
+
 func (ps *PostgresStorage) GetGauge(ctx context.Context, key string) (value float64, err error) {
 	query := `
-	SELECT value FROM metrics WHERE id = $1 AND mtype = $2;
+	SELECT value FROM metrics WHERE id = $1 AND labels = $2 AND mtype = $3;
 	`
+	id, metricLabels := splitKey(key)
 
 	retries := 0
 	for retries < 4 {
 		ps.m.Lock()
-		row := ps.db.QueryRowContext(ctx, query, key, constants.Gauge)
+		row := ps.db.QueryRowContext(ctx, query, id, metricLabels, constants.Gauge)
 		ps.m.Unlock()
 		err = row.Scan(&value)
 		if err == nil {
@@ -180,13 +330,14 @@ func (ps *PostgresStorage) GetGauge(ctx context.Context, key string) (value floa
 
 func (ps *PostgresStorage) GetCounter(ctx context.Context, key string) (value int64, err error) {
 	query := `
-	SELECT delta FROM metrics WHERE id = $1 AND mtype = $2;
+	SELECT delta FROM metrics WHERE id = $1 AND labels = $2 AND mtype = $3;
 	`
+	id, metricLabels := splitKey(key)
 
 	retries := 0
 	for retries < 4 {
 		ps.m.Lock()
-		row := ps.db.QueryRowContext(ctx, query, key, constants.Counter)
+		row := ps.db.QueryRowContext(ctx, query, id, metricLabels, constants.Counter)
 		ps.m.Unlock()
 		err = row.Scan(&value)
 		if err == nil {
@@ -212,9 +363,327 @@ func (ps *PostgresStorage) GetCounter(ctx context.Context, key string) (value in
 	return
 }
 
+func (ps *PostgresStorage) GetHistogram(ctx context.Context, key string) (value models.Histogram, err error) {
+	query := `
+	SELECT histogram FROM metrics WHERE id = $1 AND labels = $2 AND mtype = $3;
+	`
+	id, metricLabels := splitKey(key)
+
+	var data []byte
+
+	retries := 0
+	for retries < 4 {
+		ps.m.Lock()
+		row := ps.db.QueryRowContext(ctx, query, id, metricLabels, constants.Histogram)
+		ps.m.Unlock()
+		err = row.Scan(&data)
+		if err == nil {
+			break
+		}
+		if !isRetriableError(err) {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = fmt.Errorf("значение метрики %s типа histogram не найдено (%w)", key, err)
+				return
+			}
+			err = fmt.Errorf("ошибка при сканировании значения: %w", err)
+			return
+		}
+		retries++
+		if retries == 4 {
+			err = fmt.Errorf("ошибка при чтении histogram из бд: %s, %w", key, err)
+			ps.logger.Error(err.Error())
+			return
+		}
+		time.Sleep(time.Duration(retries*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+	}
+
+	if err = json.Unmarshal(data, &value); err != nil {
+		err = fmt.Errorf("ошибка преобразования histogram %s из JSON: %w", key, err)
+	}
+	return
+}
+
+// GetRange возвращает точки истории серии key типа mtype за интервал [from, to].
+func (ps *PostgresStorage) GetRange(ctx context.Context, mtype string, key string, from, to time.Time) (points []models.Point, err error) {
+	query := `
+	SELECT created_at, value FROM metrics_history
+	WHERE id = $1 AND labels = $2 AND mtype = $3 AND created_at BETWEEN $4 AND $5
+	ORDER BY created_at;
+	`
+	id, metricLabels := splitKey(key)
+
+	var rows *sql.Rows
+
+	retries := 0
+	for retries < 4 {
+		ps.m.Lock()
+		rows, err = ps.db.QueryContext(ctx, query, id, metricLabels, mtype, from, to)
+		ps.m.Unlock()
+		if err == nil {
+			break
+		}
+		if !isRetriableError(err) {
+			err = fmt.Errorf("ошибка при чтении истории %s из бд: %w", key, err)
+			return
+		}
+		retries++
+		if retries == 4 {
+			err = fmt.Errorf("ошибка при чтении истории %s из бд: %w", key, err)
+			ps.logger.Error(err.Error())
+			return
+		}
+		time.Sleep(time.Duration(retries*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+	}
+
+	defer rows.Close()
+
+	points = []models.Point{}
+	for rows.Next() {
+		var point models.Point
+		if err = rows.Scan(&point.Time, &point.Value); err != nil {
+			err = fmt.Errorf("ошибка при сканировании значения: %w", err)
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// GetRanges возвращает историю серий keys типа mtype за интервал [from, to] одним запросом.
+// Серии без истории в результат не попадают.
+func (ps *PostgresStorage) GetRanges(ctx context.Context, mtype string, keys []string, from, to time.Time) (points map[string][]models.Point, err error) {
+	query := `
+	SELECT id, labels, created_at, value FROM metrics_history
+	WHERE mtype = $1 AND created_at BETWEEN $2 AND $3
+	ORDER BY id, labels, created_at;
+	`
+	requested := make(map[string]string, len(keys))
+	for _, key := range keys {
+		requested[seriesKey(splitKey(key))] = key
+	}
+
+	var rows *sql.Rows
+
+	retries := 0
+	for retries < 4 {
+		ps.m.Lock()
+		rows, err = ps.db.QueryContext(ctx, query, mtype, from, to)
+		ps.m.Unlock()
+		if err == nil {
+			break
+		}
+		if !isRetriableError(err) {
+			err = fmt.Errorf("ошибка при чтении истории %s из бд: %w", mtype, err)
+			return
+		}
+		retries++
+		if retries == 4 {
+			err = fmt.Errorf("ошибка при чтении истории %s из бд: %w", mtype, err)
+			ps.logger.Error(err.Error())
+			return
+		}
+		time.Sleep(time.Duration(retries*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+	}
+
+	defer rows.Close()
+
+	points = make(map[string][]models.Point, len(keys))
+	for rows.Next() {
+		var id, metricLabels string
+		var point models.Point
+		if err = rows.Scan(&id, &metricLabels, &point.Time, &point.Value); err != nil {
+			err = fmt.Errorf("ошибка при сканировании значения: %w", err)
+			return nil, err
+		}
+		if key, ok := requested[seriesKey(id, metricLabels)]; ok {
+			points[key] = append(points[key], point)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// GetAggregates возвращает агрегаты истории серии key типа mtype с разрешением resolution
+// (retention.Minute или retention.Hour), начало которых лежит в интервале [from, to].
+func (ps *PostgresStorage) GetAggregates(ctx context.Context, mtype string, key string, resolution time.Duration, from, to time.Time) (aggregates []models.Aggregate, err error) {
+	if resolution != retention.Minute && resolution != retention.Hour {
+		return nil, fmt.Errorf("разрешение %s не поддерживается", resolution)
+	}
+
+	query := `
+	SELECT bucket, min, max, avg, last, count FROM metrics_rollup
+	WHERE id = $1 AND labels = $2 AND mtype = $3 AND resolution = $4 AND bucket BETWEEN $5 AND $6
+	ORDER BY bucket;
+	`
+	id, metricLabels := splitKey(key)
+
+	var rows *sql.Rows
+
+	retries := 0
+	for retries < 4 {
+		ps.m.Lock()
+		rows, err = ps.db.QueryContext(ctx, query, id, metricLabels, mtype, int64(resolution.Seconds()), from, to)
+		ps.m.Unlock()
+		if err == nil {
+			break
+		}
+		if !isRetriableError(err) {
+			err = fmt.Errorf("ошибка при чтении агрегатов %s из бд: %w", key, err)
+			return
+		}
+		retries++
+		if retries == 4 {
+			err = fmt.Errorf("ошибка при чтении агрегатов %s из бд: %w", key, err)
+			ps.logger.Error(err.Error())
+			return
+		}
+		time.Sleep(time.Duration(retries*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+	}
+
+	defer rows.Close()
+
+	aggregates = []models.Aggregate{}
+	for rows.Next() {
+		var a models.Aggregate
+		if err = rows.Scan(&a.Time, &a.Min, &a.Max, &a.Avg, &a.Last, &a.Count); err != nil {
+			err = fmt.Errorf("ошибка при сканировании значения: %w", err)
+			return nil, err
+		}
+		aggregates = append(aggregates, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return aggregates, nil
+}
+
+// ApplyRetention применяет политики хранения к истории всех серий на момент now.
+// Каждая серия обрабатывается в отдельной транзакции: точки сворачиваются в агрегаты и удаляются.
+func (ps *PostgresStorage) ApplyRetention(ctx context.Context, policies retention.Policies, now time.Time) error {
+	querySeries := `
+	SELECT id, labels, mtype FROM metrics_history
+	UNION
+	SELECT id, labels, mtype FROM metrics_rollup;
+	`
+	// Свертка исходных точек в минутные агрегаты. Агрегат, уже сохраненный для той же минуты, объединяется с новым.
+	queryRollupRaw := `
+	INSERT INTO metrics_rollup AS r (id, labels, mtype, resolution, bucket, min, max, avg, last, count)
+	SELECT id, labels, mtype, $4::INTEGER, to_timestamp(floor(extract(epoch FROM created_at) / $4::INTEGER) * $4::INTEGER),
+		min(value), max(value), avg(value), (array_agg(value ORDER BY created_at DESC))[1], count(*)
+	FROM metrics_history
+	WHERE id = $1 AND labels = $2 AND mtype = $3 AND created_at < $5
+	GROUP BY 1, 2, 3, 4, 5
+	ON CONFLICT (id, labels, mtype, resolution, bucket) DO UPDATE
+	SET min = LEAST(r.min, EXCLUDED.min), max = GREATEST(r.max, EXCLUDED.max),
+		avg = (r.avg * r.count + EXCLUDED.avg * EXCLUDED.count) / (r.count + EXCLUDED.count),
+		last = EXCLUDED.last, count = r.count + EXCLUDED.count;
+	`
+	queryDeleteRaw := `
+	DELETE FROM metrics_history WHERE id = $1 AND labels = $2 AND mtype = $3 AND created_at < $4;
+	`
+	// Свертка минутных агрегатов в часовые.
+	queryRollupMinute := `
+	INSERT INTO metrics_rollup AS r (id, labels, mtype, resolution, bucket, min, max, avg, last, count)
+	SELECT id, labels, mtype, $5::INTEGER, to_timestamp(floor(extract(epoch FROM bucket) / $5::INTEGER) * $5::INTEGER),
+		min(min), max(max), sum(avg * count) / sum(count), (array_agg(last ORDER BY bucket DESC))[1], sum(count)
+	FROM metrics_rollup
+	WHERE id = $1 AND labels = $2 AND mtype = $3 AND resolution = $4 AND bucket < $6
+	GROUP BY 1, 2, 3, 4, 5
+	ON CONFLICT (id, labels, mtype, resolution, bucket) DO UPDATE
+	SET min = LEAST(r.min, EXCLUDED.min), max = GREATEST(r.max, EXCLUDED.max),
+		avg = (r.avg * r.count + EXCLUDED.avg * EXCLUDED.count) / (r.count + EXCLUDED.count),
+		last = EXCLUDED.last, count = r.count + EXCLUDED.count;
+	`
+	queryDeleteRollup := `
+	DELETE FROM metrics_rollup WHERE id = $1 AND labels = $2 AND mtype = $3 AND resolution = $4 AND bucket < $5;
+	`
+
+	type series struct {
+		id, labels, mtype string
+	}
+
+	ps.m.Lock()
+	rows, err := ps.db.QueryContext(ctx, querySeries)
+	ps.m.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ошибка при чтении серий истории из бд: %w", err)
+		ps.logger.Error(err.Error())
+		return err
+	}
+
+	var list []series
+	for rows.Next() {
+		var s series
+		if err = rows.Scan(&s.id, &s.labels, &s.mtype); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	minute := int64(retention.Minute.Seconds())
+	hour := int64(retention.Hour.Seconds())
+
+	for _, s := range list {
+		policy, ok := policies.Find(s.id)
+		if !ok {
+			continue
+		}
+		rawCutoff, minuteCutoff, hourCutoff := policy.Cutoffs(now)
+
+		err = ps.withTx(ctx, func(tx *sql.Tx) error {
+			ps.m.Lock()
+			defer ps.m.Unlock()
+
+			if !rawCutoff.IsZero() {
+				if _, err := tx.ExecContext(ctx, queryRollupRaw, s.id, s.labels, s.mtype, minute, rawCutoff); err != nil {
+					return fmt.Errorf("ошибка при свертке истории %s: %w", s.id, err)
+				}
+				if _, err := tx.ExecContext(ctx, queryDeleteRaw, s.id, s.labels, s.mtype, rawCutoff); err != nil {
+					return fmt.Errorf("ошибка при удалении истории %s: %w", s.id, err)
+				}
+			}
+			if !minuteCutoff.IsZero() {
+				if _, err := tx.ExecContext(ctx, queryRollupMinute, s.id, s.labels, s.mtype, minute, hour, minuteCutoff); err != nil {
+					return fmt.Errorf("ошибка при свертке агрегатов %s: %w", s.id, err)
+				}
+				if _, err := tx.ExecContext(ctx, queryDeleteRollup, s.id, s.labels, s.mtype, minute, minuteCutoff); err != nil {
+					return fmt.Errorf("ошибка при удалении агрегатов %s: %w", s.id, err)
+				}
+			}
+			if !hourCutoff.IsZero() {
+				if _, err := tx.ExecContext(ctx, queryDeleteRollup, s.id, s.labels, s.mtype, hour, hourCutoff); err != nil {
+					return fmt.Errorf("ошибка при удалении агрегатов %s: %w", s.id, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (ps *PostgresStorage) GetAllGauge(ctx context.Context) map[string]float64 {
 	query := `
-	SELECT id, value FROM metrics WHERE mtype = $1
+	SELECT id, labels, value FROM metrics WHERE mtype = $1
 	`
 
 	var rows *sql.Rows
@@ -245,13 +714,13 @@ func (ps *PostgresStorage) GetAllGauge(ctx context.Context) map[string]float64 {
 	gaugeMetrics := make(map[string]float64)
 
 	for rows.Next() {
-		var id string
+		var id, metricLabels string
 		var value float64
 
-		if err := rows.Scan(&id, &value); err != nil {
+		if err := rows.Scan(&id, &metricLabels, &value); err != nil {
 			return nil
 		}
-		gaugeMetrics[id] = value
+		gaugeMetrics[seriesKey(id, metricLabels)] = value
 	}
 
 	if err := rows.Err(); err != nil {
@@ -263,7 +732,7 @@ func (ps *PostgresStorage) GetAllGauge(ctx context.Context) map[string]float64 {
 
 func (ps *PostgresStorage) GetAllCounter(ctx context.Context) map[string]int64 {
 	query := `
-	SELECT id, delta FROM metrics WHERE mtype = $1
+	SELECT id, labels, delta FROM metrics WHERE mtype = $1
 	`
 
 	var rows *sql.Rows
@@ -293,13 +762,13 @@ func (ps *PostgresStorage) GetAllCounter(ctx context.Context) map[string]int64 {
 
 	counterMetrics := make(map[string]int64)
 	for rows.Next() {
-		var id string
+		var id, metricLabels string
 		var value int64
 
-		if err := rows.Scan(&id, &value); err != nil {
+		if err := rows.Scan(&id, &metricLabels, &value); err != nil {
 			return nil
 		}
-		counterMetrics[id] = value
+		counterMetrics[seriesKey(id, metricLabels)] = value
 	}
 
 	if err := rows.Err(); err != nil {
@@ -309,10 +778,62 @@ func (ps *PostgresStorage) GetAllCounter(ctx context.Context) map[string]int64 {
 	return counterMetrics
 }
 
+func (ps *PostgresStorage) GetAllHistogram(ctx context.Context) map[string]models.Histogram {
+	query := `
+	SELECT id, labels, histogram FROM metrics WHERE mtype = $1
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	retries := 0
+	for retries < 4 {
+		ps.m.Lock()
+		rows, err = ps.db.QueryContext(ctx, query, constants.Histogram)
+		ps.m.Unlock()
+		if err == nil {
+			break
+		}
+		if !isRetriableError(err) {
+			return nil
+		}
+		retries++
+		if retries == 4 {
+			err = fmt.Errorf("ошибка при чтении метрик histogram из бд: %w", err)
+			ps.logger.Error(err.Error())
+			return nil
+		}
+		time.Sleep(time.Duration(retries*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+	}
+
+	defer rows.Close()
+
+	histogramMetrics := make(map[string]models.Histogram)
+	for rows.Next() {
+		var id, metricLabels string
+		var data []byte
+
+		if err := rows.Scan(&id, &metricLabels, &data); err != nil {
+			return nil
+		}
+		var value models.Histogram
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil
+		}
+		histogramMetrics[seriesKey(id, metricLabels)] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil
+	}
+
+	return histogramMetrics
+}
+
 func (ps *PostgresStorage) GetAll(ctx context.Context) map[string]interface{} {
 
 	query := `
-	SELECT id, delta FROM metrics
+	SELECT id, labels, delta FROM metrics
 	`
 	var rows *sql.Rows
 	var err error
@@ -340,13 +861,13 @@ func (ps *PostgresStorage) GetAll(ctx context.Context) map[string]interface{} {
 
 	metrics := make(map[string]interface{})
 	for rows.Next() {
-		var id string
+		var id, metricLabels string
 		var value int64
 
-		if err := rows.Scan(&id, &value); err != nil {
+		if err := rows.Scan(&id, &metricLabels, &value); err != nil {
 			return nil
 		}
-		metrics[id] = value
+		metrics[seriesKey(id, metricLabels)] = value
 	}
 
 	if err := rows.Err(); err != nil {
@@ -363,72 +884,103 @@ func (ps *PostgresStorage) CheckConnection(ctx context.Context) (err error) {
 	return ps.db.PingContext(context)
 }
 
+// SaveMetrics в одной транзакции сохраняет metrics и возвращает в них итоговые значения counter и histogram.
 func (ps *PostgresStorage) SaveMetrics(ctx context.Context, metrics []models.Metrics) error {
 	return ps.withTx(ctx, func(tx *sql.Tx) error {
-		queryGauge := `
-		INSERT INTO metrics (id, mtype, value)
-		VALUES ($1, $2, $3) 
-		ON CONFLICT (id) DO UPDATE
-		SET mtype = EXCLUDED.mtype, value = EXCLUDED.value;
-		`
-		queryCounter := `
-		INSERT INTO metrics (id, mtype, delta)
-		VALUES ($1, $2, $3) 
-		ON CONFLICT (id) DO UPDATE
-		SET mtype = EXCLUDED.mtype, delta = metrics.delta + EXCLUDED.delta;
-		`
-
-		for i := 0; i <= ps.config.GetRetryCount(); i++ {
-
-			var error error
-
-			for _, metric := range metrics {
-				if metric.ID == "" {
-					error = fmt.Errorf("ошибка при сохранении в БД. Пустое имя метрики: %v", metric)
-					break
+		return ps.saveMetrics(ctx, tx, metrics)
+	})
+}
+
+// ReplaceMetrics в одной транзакции удаляет текущие значения всех метрик и сохраняет metrics.
+// История серий сохраняется.
+func (ps *PostgresStorage) ReplaceMetrics(ctx context.Context, metrics []models.Metrics) error {
+	return ps.withTx(ctx, func(tx *sql.Tx) error {
+		ps.m.Lock()
+		_, err := tx.ExecContext(ctx, "DELETE FROM metrics;")
+		ps.m.Unlock()
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении метрик из бд: %w", err)
+		}
+		return ps.saveMetrics(ctx, tx, metrics)
+	})
+}
+
+func (ps *PostgresStorage) saveMetrics(ctx context.Context, tx *sql.Tx, metrics []models.Metrics) error {
+	queryGauge := queryUpsertGauge
+	queryCounter := queryUpsertCounter
+
+	// Итоговые значения counter и histogram записываются в metrics только после успешного сохранения всего пакета,
+	// чтобы повторная попытка не учла их дважды.
+	totals := make([]int64, len(metrics))
+	histograms := make([]models.Histogram, len(metrics))
+
+	for i := 0; i <= ps.config.GetRetryCount(); i++ {
+
+		var error error
+
+		for j, metric := range metrics {
+			if metric.ID == "" {
+				error = fmt.Errorf("ошибка при сохранении в БД. Пустое имя метрики: %v", metric)
+				break
+			}
+			var zero float64 = 0
+			metricLabels := labels.Format(metric.Labels)
+			switch metric.MType {
+			case constants.Gauge:
+				if metric.Value == nil {
+					metric.Value = &zero
 				}
-				var zero float64 = 0
-				switch metric.MType {
-				case constants.Gauge:
-					if metric.Value == nil {
-						metric.Value = &zero
-					}
-					ps.m.Lock()
-					_, error = tx.ExecContext(ctx, queryGauge, metric.ID, metric.MType, &metric.Value)
-					ps.m.Unlock()
-					if error != nil {
-						error = fmt.Errorf("ошибка при сохранении %s в бд: %s, %v, %w", metric.MType, metric.ID, &metric.Value, error)
-					}
-				case constants.Counter:
-					ps.m.Lock()
-					_, error = tx.ExecContext(ctx, queryCounter, metric.ID, metric.MType, &metric.Delta)
-					ps.m.Unlock()
-					if error != nil {
-						error = fmt.Errorf("ошибка при сохранении %s в бд: %s, %v, %v, %w", metric.MType, metric.ID, &metric.Delta, metric.Delta, error)
-					}
-				default:
-					error = fmt.Errorf("неверный формат для обновления метрик (недопустимый тип): %s", metric.MType)
+				ps.m.Lock()
+				_, error = tx.ExecContext(ctx, queryGauge, metric.ID, metricLabels, metric.MType, &metric.Value)
+				ps.m.Unlock()
+				if error != nil {
+					error = fmt.Errorf("ошибка при сохранении %s в бд: %s, %v, %w", metric.MType, metric.ID, &metric.Value, error)
 				}
+			case constants.Counter:
+				ps.m.Lock()
+				error = tx.QueryRowContext(ctx, queryCounter, metric.ID, metricLabels, metric.MType, &metric.Delta).Scan(&totals[j])
+				ps.m.Unlock()
 				if error != nil {
+					error = fmt.Errorf("ошибка при сохранении %s в бд: %s, %v, %v, %w", metric.MType, metric.ID, &metric.Delta, metric.Delta, error)
+				}
+			case constants.Histogram:
+				if metric.Histogram == nil {
+					error = fmt.Errorf("ошибка при сохранении в БД. Не заполнено значение гистограммы: %s", metric.ID)
 					break
 				}
+				histograms[j] = histogram.Clone(*metric.Histogram)
+				error = ps.saveHistogram(ctx, tx, labels.SeriesKey(metric.ID, metric.Labels), &histograms[j])
+			default:
+				error = fmt.Errorf("неверный формат для обновления метрик (недопустимый тип): %s", metric.MType)
 			}
-			if error == nil {
+			if error != nil {
 				break
 			}
-			if !isRetriableError(error) {
-				ps.logger.Error(error.Error())
-				return error
-			}
-			if i == ps.config.GetRetryCount() {
-				ps.logger.Error(error.Error())
-				return error
-			}
-			time.Sleep(time.Duration(i*2+1) * time.Second) // Backoff: 1s, 3s, 5s
+		}
+		if error == nil {
+			break
+		}
+		if !isRetriableError(error) {
+			ps.logger.Error(error.Error())
+			return error
+		}
+		if i == ps.config.GetRetryCount() {
+			ps.logger.Error(error.Error())
+			return error
+		}
+		time.Sleep(time.Duration(i*2+1) * time.Second) // Backoff: 1s, 3s, 5s
 
+	}
+
+	for j, metric := range metrics {
+		switch metric.MType {
+		case constants.Counter:
+			*metric.Delta = totals[j]
+		case constants.Histogram:
+			*metric.Histogram = histograms[j]
 		}
-		return nil
-	})
+	}
+	return nil
 }
 
 // func (ps *PostgresStorage) SaveMetrics(ctx context.Context, metrics []models.Metrics) error {
@@ -524,6 +1076,377 @@ func (ps *PostgresStorage) GetAllMetricsInJSON() []models.Metrics {
 	return metrics
 }
 
+// ListMetrics возвращает страницу списка метрик, удовлетворяющих запросу, и общее количество таких метрик.
+// Фильтры по типу и префиксу, сортировка и постраничный вывод выполняются в БД. Шаблоны glob и регулярные
+// выражения проверяются в Go (синтаксис RE2), так как оператор ~ в PostgreSQL понимает другой диалект;
+// в этом случае страница и количество вычисляются методом listing.Query.Apply. Количество и страница
+// читаются в одной транзакции REPEATABLE READ и поэтому согласованы между собой.
+func (ps *PostgresStorage) ListMetrics(ctx context.Context, query *listing.Query) (metrics []models.Metrics, total int, err error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if query.Type != "" {
+		where("mtype = $%d", query.Type)
+	}
+	if query.Prefix != "" {
+		where(`id LIKE ($%d || '%%') ESCAPE '\'`, listing.EscapeLike(query.Prefix))
+	}
+	filterInGo := query.Glob != "" || query.Regex != ""
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Порядок совпадает с listing.Query.Apply, поэтому строки сравниваются побайтно (COLLATE "C").
+	columns := []string{"id", "labels", "mtype"}
+	if query.Sort == listing.SortType || query.Sort == listing.SortTypeDesc {
+		columns = []string{"mtype", "id", "labels"}
+	}
+	direction := ""
+	if strings.HasPrefix(query.Sort, "-") {
+		direction = " DESC"
+	}
+	for i, column := range columns {
+		columns[i] = column + ` COLLATE "C"` + direction
+	}
+
+	pageClause := ""
+	pageArgs := append([]any{}, args...)
+	if !filterInGo && query.Limit > 0 {
+		pageArgs = append(pageArgs, query.Limit)
+		pageClause += fmt.Sprintf(" LIMIT $%d", len(pageArgs))
+	}
+	if !filterInGo && query.Offset > 0 {
+		pageArgs = append(pageArgs, query.Offset)
+		pageClause += fmt.Sprintf(" OFFSET $%d", len(pageArgs))
+	}
+
+	queryCount := "SELECT count(*) FROM metrics " + whereClause
+	querySelect := "SELECT id, labels, mtype, value, delta, histogram FROM metrics " + whereClause +
+		" ORDER BY " + strings.Join(columns, ", ") + pageClause
+
+	ps.m.Lock()
+	defer ps.m.Unlock()
+
+	tx, err := ps.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		err = fmt.Errorf("begin transaction: %w", err)
+		ps.logger.Error(err.Error())
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	if !filterInGo {
+		if err = tx.QueryRowContext(ctx, queryCount, args...).Scan(&total); err != nil {
+			err = fmt.Errorf("ошибка при чтении списка метрик из бд: %w", err)
+			ps.logger.Error(err.Error())
+			return nil, 0, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, querySelect, pageArgs...)
+	if err != nil {
+		err = fmt.Errorf("ошибка при чтении списка метрик из бд: %w", err)
+		ps.logger.Error(err.Error())
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	metrics = []models.Metrics{}
+	for rows.Next() {
+		metric, err := scanMetric(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+
+	if filterInGo {
+		metrics, total = query.Apply(metrics)
+	}
+
+	return metrics, total, nil
+}
+
+// WalkMetrics вызывает fn для каждой метрики в порядке возрастания имен и меток.
+// Строки читаются из БД по мере обработки, а не загружаются целиком.
+func (ps *PostgresStorage) WalkMetrics(ctx context.Context, fn func(metric models.Metrics) error) error {
+	query := `SELECT id, labels, mtype, value, delta, histogram FROM metrics ORDER BY id COLLATE "C", labels COLLATE "C", mtype COLLATE "C";`
+
+	ps.m.Lock()
+	rows, err := ps.db.QueryContext(ctx, query)
+	ps.m.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ошибка при чтении метрик из бд: %w", err)
+		ps.logger.Error(err.Error())
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		metric, err := scanMetric(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(metric); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanMetric читает метрику из строки с колонками id, labels, mtype, value, delta, histogram.
+func scanMetric(rows *sql.Rows) (metric models.Metrics, err error) {
+	var metricLabels string
+	var value sql.NullFloat64
+	var delta sql.NullInt64
+	var data []byte
+
+	if err = rows.Scan(&metric.ID, &metricLabels, &metric.MType, &value, &delta, &data); err != nil {
+		return metric, fmt.Errorf("ошибка при сканировании значения: %w", err)
+	}
+
+	_, metric.Labels = labels.SplitSeriesKey(seriesKey(metric.ID, metricLabels))
+
+	switch metric.MType {
+	case constants.Gauge:
+		metric.Value = &value.Float64
+	case constants.Counter:
+		metric.Delta = &delta.Int64
+	case constants.Histogram:
+		var h models.Histogram
+		if err = json.Unmarshal(data, &h); err != nil {
+			return metric, fmt.Errorf("ошибка преобразования histogram %s из JSON: %w", metric.ID, err)
+		}
+		metric.Histogram = &h
+	}
+	return metric, nil
+}
+
+// DeleteMetric удаляет серию key типа mtype вместе с ее историей.
+func (ps *PostgresStorage) DeleteMetric(ctx context.Context, mtype string, key string) error {
+	id, metricLabels := splitKey(key)
+
+	return ps.withTx(ctx, func(tx *sql.Tx) error {
+		ps.m.Lock()
+		defer ps.m.Unlock()
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM metrics WHERE id = $1 AND labels = $2 AND mtype = $3;`, id, metricLabels, mtype)
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении метрики %s из бд: %w", key, err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return fmt.Errorf("%w: %s типа %s", models.ErrMetricNotFound, key, mtype)
+		}
+
+		for _, table := range []string{"metrics_history", "metrics_rollup"} {
+			query := "DELETE FROM " + table + " WHERE id = $1 AND labels = $2 AND mtype = $3;"
+			if _, err = tx.ExecContext(ctx, query, id, metricLabels, mtype); err != nil {
+				return fmt.Errorf("ошибка при удалении истории метрики %s из бд: %w", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMetrics удаляет все серии, имена которых соответствуют шаблону glob (см. пакет listing).
+// Если mtype не пустой, удаляются только серии этого типа. Возвращает количество удаленных серий.
+func (ps *PostgresStorage) DeleteMetrics(ctx context.Context, mtype string, pattern string) (deleted int, err error) {
+	condition := "id ~ $1 AND ($2 = '' OR mtype = $2)"
+	args := []any{listing.GlobToRegexp(pattern), mtype}
+
+	err = ps.withTx(ctx, func(tx *sql.Tx) error {
+		ps.m.Lock()
+		defer ps.m.Unlock()
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM metrics WHERE "+condition+";", args...)
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении метрик %s из бд: %w", pattern, err)
+		}
+		affected, _ := result.RowsAffected()
+		deleted = int(affected)
+
+		for _, table := range []string{"metrics_history", "metrics_rollup"} {
+			if _, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE "+condition+";", args...); err != nil {
+				return fmt.Errorf("ошибка при удалении истории метрик %s из бд: %w", pattern, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// ResetCounter обнуляет значение counter. Нулевое значение записывается в историю.
+func (ps *PostgresStorage) ResetCounter(ctx context.Context, key string) error {
+	query := `
+	WITH saved AS (
+		UPDATE metrics SET delta = 0
+		WHERE id = $1 AND labels = $2 AND mtype = $3
+		RETURNING id, labels, mtype, delta
+	)
+	INSERT INTO metrics_history (id, labels, mtype, value)
+	SELECT id, labels, mtype, delta::DOUBLE PRECISION FROM saved
+	RETURNING (SELECT delta FROM saved);
+	`
+	id, metricLabels := splitKey(key)
+
+	ps.m.Lock()
+	result, err := ps.db.ExecContext(ctx, query, id, metricLabels, constants.Counter)
+	ps.m.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ошибка при сбросе counter %s в бд: %w", key, err)
+		ps.logger.Error(err.Error())
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: %s типа counter", models.ErrMetricNotFound, key)
+	}
+	return nil
+}
+
+// ClaimIdempotencyKey резервирует ключ для обработки запроса. Ключ, зарезервированный раньше notBefore,
+// и ключ без сохраненного ответа, зарезервированный раньше leaseNotBefore, резервируются заново. Если ключ уже зарезервирован, возвращается сохраненный ответ
+// (nil, если запрос еще обрабатывается) и claimed = false.
+func (ps *PostgresStorage) ClaimIdempotencyKey(ctx context.Context, key string, notBefore, leaseNotBefore time.Time) (result *models.IdempotencyResult, claimed bool, err error) {
+	queryClaim := `
+	INSERT INTO idempotency_keys (key) VALUES ($1)
+	ON CONFLICT (key) DO UPDATE
+	SET status = 0, content_type = '', body = NULL, created_at = clock_timestamp()
+	WHERE idempotency_keys.created_at < $2 OR (idempotency_keys.status = 0 AND idempotency_keys.created_at < $3)
+	RETURNING key;
+	`
+	querySelect := `SELECT status, content_type, body FROM idempotency_keys WHERE key = $1;`
+
+	ps.m.Lock()
+	defer ps.m.Unlock()
+
+	var claimedKey string
+	err = ps.db.QueryRowContext(ctx, queryClaim, key, notBefore, leaseNotBefore).Scan(&claimedKey)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("ошибка при сохранении ключа идемпотентности в бд: %w", err)
+		ps.logger.Error(err.Error())
+		return nil, false, err
+	}
+
+	var saved models.IdempotencyResult
+	err = ps.db.QueryRowContext(ctx, querySelect, key).Scan(&saved.StatusCode, &saved.ContentType, &saved.Body)
+	if err != nil {
+		err = fmt.Errorf("ошибка при чтении ключа идемпотентности из бд: %w", err)
+		ps.logger.Error(err.Error())
+		return nil, false, err
+	}
+	if saved.StatusCode == 0 {
+		return nil, false, nil
+	}
+	return &saved, false, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с ключом key.
+func (ps *PostgresStorage) CompleteIdempotencyKey(ctx context.Context, key string, result models.IdempotencyResult) error {
+	query := `UPDATE idempotency_keys SET status = $2, content_type = $3, body = $4 WHERE key = $1;`
+
+	ps.m.Lock()
+	_, err := ps.db.ExecContext(ctx, query, key, result.StatusCode, result.ContentType, result.Body)
+	ps.m.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ошибка при сохранении ответа для ключа идемпотентности в бд: %w", err)
+		ps.logger.Error(err.Error())
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey снимает резервирование ключа, чтобы запрос можно было повторить.
+func (ps *PostgresStorage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ps.m.Lock()
+	_, err := ps.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1;`, key)
+	ps.m.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ошибка при удалении ключа идемпотентности из бд: %w", err)
+		ps.logger.Error(err.Error())
+	}
+	return err
+}
+
+// ExpireIdempotencyKeys удаляет ключи, зарезервированные раньше before.
+func (ps *PostgresStorage) ExpireIdempotencyKeys(ctx context.Context, before time.Time) error {
+	ps.m.Lock()
+	_, err := ps.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1;`, before)
+	ps.m.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ошибка при удалении устаревших ключей идемпотентности из бд: %w", err)
+		ps.logger.Error(err.Error())
+	}
+	return err
+}
+
+// RenameMetric переименовывает серию key типа mtype в newKey вместе с историей.
+func (ps *PostgresStorage) RenameMetric(ctx context.Context, mtype string, key string, newKey string) error {
+	id, metricLabels := splitKey(key)
+	newID, newLabels := splitKey(newKey)
+	if newID == "" {
+		return fmt.Errorf("имя метрики обязательно для заполнения")
+	}
+
+	return ps.withTx(ctx, func(tx *sql.Tx) error {
+		ps.m.Lock()
+		defer ps.m.Unlock()
+
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM metrics WHERE id = $1 AND labels = $2);`, newID, newLabels).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("ошибка при переименовании метрики %s в бд: %w", key, err)
+		}
+		if exists {
+			return fmt.Errorf("%w: %s", models.ErrMetricExists, newKey)
+		}
+
+		for i, table := range []string{"metrics", "metrics_history", "metrics_rollup"} {
+			query := "UPDATE " + table + " SET id = $4, labels = $5 WHERE id = $1 AND labels = $2 AND mtype = $3;"
+			result, err := tx.ExecContext(ctx, query, id, metricLabels, mtype, newID, newLabels)
+			if err != nil {
+				return fmt.Errorf("ошибка при переименовании метрики %s в бд: %w", key, err)
+			}
+			if affected, _ := result.RowsAffected(); i == 0 && affected == 0 {
+				return fmt.Errorf("%w: %s типа %s", models.ErrMetricNotFound, key, mtype)
+			}
+		}
+		return nil
+	})
+}
+
+// splitKey делит ключ серии на имя метрики и метки в том виде, в котором они хранятся в столбце labels.
+func splitKey(key string) (id string, metricLabels string) {
+	id, parsed := labels.SplitSeriesKey(key)
+	return id, labels.Format(parsed)
+}
+
+// seriesKey собирает ключ серии из значений столбцов id и labels.
+func seriesKey(id string, metricLabels string) string {
+	if metricLabels == "" {
+		return id
+	}
+	return id + "{" + metricLabels + "}"
+}
+
 func isRetriableError(err error) bool {
 	var pgerr *pgconn.PgError
 	if errors.As(err, &pgerr) {
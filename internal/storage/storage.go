@@ -3,9 +3,12 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"metrics/internal/config"
+	"metrics/internal/listing"
 	"metrics/internal/models"
+	"metrics/internal/retention"
 	"metrics/internal/storage/inmemory"
 	"metrics/internal/storage/postgres"
 
@@ -16,13 +19,31 @@ import (
 type Storage interface {
 	SetGauge(ctx context.Context, key string, value float64) (err error)
 	SetCounter(ctx context.Context, key string, value *int64) (err error)
+	SetHistogram(ctx context.Context, key string, value *models.Histogram) (err error)
 	SaveMetrics(ctx context.Context, metrics []models.Metrics) (err error)
+	ReplaceMetrics(ctx context.Context, metrics []models.Metrics) (err error)
+	WalkMetrics(ctx context.Context, fn func(metric models.Metrics) error) (err error)
 	GetAllGauge(ctx context.Context) map[string]float64
 	GetAllCounter(ctx context.Context) map[string]int64
+	GetAllHistogram(ctx context.Context) map[string]models.Histogram
 	GetGauge(ctx context.Context, key string) (value float64, err error)
 	GetCounter(ctx context.Context, key string) (value int64, err error)
+	GetHistogram(ctx context.Context, key string) (value models.Histogram, err error)
+	GetRange(ctx context.Context, mtype string, key string, from, to time.Time) (points []models.Point, err error)
+	GetRanges(ctx context.Context, mtype string, keys []string, from, to time.Time) (points map[string][]models.Point, err error)
+	GetAggregates(ctx context.Context, mtype string, key string, resolution time.Duration, from, to time.Time) (aggregates []models.Aggregate, err error)
+	ApplyRetention(ctx context.Context, policies retention.Policies, now time.Time) (err error)
 	CheckConnection(ctx context.Context) (err error)
 	GetAllMetricsInJSON() []models.Metrics
+	ListMetrics(ctx context.Context, query *listing.Query) (metrics []models.Metrics, total int, err error)
+	DeleteMetric(ctx context.Context, mtype string, key string) (err error)
+	DeleteMetrics(ctx context.Context, mtype string, pattern string) (deleted int, err error)
+	ResetCounter(ctx context.Context, key string) (err error)
+	RenameMetric(ctx context.Context, mtype string, key string, newKey string) (err error)
+	ClaimIdempotencyKey(ctx context.Context, key string, notBefore, leaseNotBefore time.Time) (result *models.IdempotencyResult, claimed bool, err error)
+	CompleteIdempotencyKey(ctx context.Context, key string, result models.IdempotencyResult) (err error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) (err error)
+	ExpireIdempotencyKeys(ctx context.Context, before time.Time) (err error)
 }
 
 type StorageFactory struct{}
@@ -38,6 +59,7 @@ func (f *StorageFactory) NewStorage(cfg *config.Config, logger *zap.Logger) (Sto
 		return postgres, err
 	} else {
 		inmemory := inmemory.NewMemStorage()
+		inmemory.SetHistorySize(cfg.Server.HistorySize)
 		if cfg.IsRestoreEnabled() {
 			inmemory.UploadData(cfg.Server.FileStoragePath)
 		}
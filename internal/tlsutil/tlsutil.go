@@ -0,0 +1,72 @@
+// В пакете tlsutil собираются настройки TLS для сервера и агента.
+// Сертификат и ключ в формате PEM можно получить с помощью cmd/cryptokeygen (cert.pem и private_key.pem).
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ServerConfig возвращает настройки TLS сервера с сертификатом certPath и ключом keyPath.
+// Если задан clientCAPath, сервер требует клиентский сертификат, подписанный одним из сертификатов из этого файла (mTLS).
+func ServerConfig(certPath, keyPath, clientCAPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при загрузке сертификата сервера: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCAPath != "" {
+		config.ClientCAs, err = LoadCertPool(clientCAPath)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// ClientConfig возвращает настройки TLS клиента. Если caPath не задан, сертификат сервера проверяется
+// по системным корневым сертификатам. Если заданы certPath и keyPath, клиент предъявляет сертификат серверу.
+func ClientConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caPath != "" {
+		pool, err := LoadCertPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при загрузке сертификата клиента: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// LoadCertPool читает сертификаты в формате PEM из файла path.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении сертификатов %s: %w", path, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("в файле %s нет сертификатов в формате PEM", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,49 @@
+// В пакете trustedsubnet реализована проверка адреса агента по доверенной подсети.
+// Агент передает адрес своего сетевого интерфейса в заголовке X-Real-IP. Если в настройках сервера
+// задана доверенная подсеть (trusted_subnet), запросы с адресом вне подсети или без заголовка отклоняются с кодом 403.
+package trustedsubnet
+
+import (
+	"net"
+	"net/http"
+
+	"metrics/internal/config"
+
+	"go.uber.org/zap"
+)
+
+const HeaderRealIP = "X-Real-IP"
+
+type TrustedSubnet struct {
+	config *config.Config
+	logger *zap.Logger
+}
+
+func NewTrustedSubnetMW(cfg *config.Config, logger *zap.Logger) *TrustedSubnet {
+	return &TrustedSubnet{
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Check пропускает запрос к h, только если адрес из заголовка X-Real-IP входит в доверенную подсеть.
+// Если подсеть в настройках сервера не задана, запрос передается h без проверки.
+func (t *TrustedSubnet) Check(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !t.config.IsTrustedSubnetEnabled() {
+			h(w, r)
+			return
+		}
+
+		realIP := r.Header.Get(HeaderRealIP)
+		ip := net.ParseIP(realIP)
+		if ip == nil || !t.config.Server.TrustedSubnet.Contains(ip) {
+			t.logger.Warn("адрес агента вне доверенной подсети",
+				zap.String("real_ip", realIP), zap.String("remote", r.RemoteAddr), zap.String("path", r.URL.Path))
+			http.Error(w, "адрес агента вне доверенной подсети", http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	}
+}
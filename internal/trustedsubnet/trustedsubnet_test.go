@@ -0,0 +1,46 @@
+package trustedsubnet
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"metrics/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTrustedSubnet_Check(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		subnet *net.IPNet
+		realIP string
+		want   int
+	}{
+		{name: "disabled", subnet: nil, realIP: "", want: http.StatusOK},
+		{name: "inside", subnet: subnet, realIP: "192.168.1.10", want: http.StatusOK},
+		{name: "outside", subnet: subnet, realIP: "10.0.0.1", want: http.StatusForbidden},
+		{name: "missing", subnet: subnet, realIP: "", want: http.StatusForbidden},
+		{name: "invalid", subnet: subnet, realIP: "192.168.1", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := NewTrustedSubnetMW(&config.Config{Server: config.ServerConfig{TrustedSubnet: tt.subnet}}, zap.NewNop())
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tt.realIP != "" {
+				req.Header.Set(HeaderRealIP, tt.realIP)
+			}
+			rec := httptest.NewRecorder()
+			mw.Check(ok)(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// В пакете validation реализована проверка входных данных сервера: имен, типов и значений метрик,
+// а также ограничение размера тела запроса.
+//
+// Ошибки проверки возвращаются клиенту с кодом 400 в формате JSON: {"error": "описание ошибки"}.
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"metrics/internal/constants"
+	"metrics/internal/histogram"
+	"metrics/internal/labels"
+	"metrics/internal/models"
+)
+
+const (
+	MaxNameLength int   = 50        // размер столбца id в БД (VARCHAR(50))
+	MaxBodySize   int64 = 10 << 20  // размер тела запроса на обновление или получение метрик
+	MaxImportSize int64 = 128 << 20 // размер тела запроса POST /api/v1/import
+)
+
+// Name проверяет имя метрики: имя должно быть не длиннее MaxNameLength
+// и состоять из латинских букв, цифр и символов '_', '.', ':', '-'.
+func Name(name string) error {
+	if name == "" {
+		return fmt.Errorf("имя метрики не заполнено")
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("длина имени метрики превышает %d символов", MaxNameLength)
+	}
+	for _, r := range name {
+		if !isNameChar(r) {
+			return fmt.Errorf("имя метрики %q содержит недопустимый символ %q", name, r)
+		}
+	}
+	return nil
+}
+
+func isNameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '_' || r == '.' || r == ':' || r == '-'
+}
+
+// Type проверяет, что тип метрики поддерживается сервером.
+func Type(mtype string) error {
+	switch mtype {
+	case constants.Gauge, constants.Counter, constants.Histogram:
+		return nil
+	case "":
+		return fmt.Errorf("тип метрики не заполнен")
+	default:
+		return fmt.Errorf("тип %s не поддерживается", mtype)
+	}
+}
+
+// Value проверяет, что значение gauge - конечное число.
+func Value(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("значение метрики должно быть конечным числом")
+	}
+	return nil
+}
+
+// Series проверяет тип, имя и метки серии.
+func Series(mtype string, name string, mlabels map[string]string) error {
+	if err := Name(name); err != nil {
+		return err
+	}
+	if err := Type(mtype); err != nil {
+		return err
+	}
+	return labels.Validate(mlabels)
+}
+
+// Metric проверяет метрику перед сохранением: кроме серии проверяется, что для gauge заполнено
+// конечное значение value, для counter - delta, а для histogram - корректная гистограмма.
+func Metric(metric models.Metrics) error {
+	if err := Series(metric.MType, metric.ID, metric.Labels); err != nil {
+		return err
+	}
+	switch metric.MType {
+	case constants.Gauge:
+		if metric.Value == nil {
+			return fmt.Errorf("значение value метрики типа %s не заполнено", metric.MType)
+		}
+		return Value(*metric.Value)
+	case constants.Counter:
+		if metric.Delta == nil {
+			return fmt.Errorf("значение delta метрики типа %s не заполнено", metric.MType)
+		}
+	case constants.Histogram:
+		return histogram.Validate(metric.Histogram)
+	}
+	return nil
+}
+
+// ErrorResponse - тело ответа с ошибкой.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// WriteError отправляет клиенту ошибку в формате JSON.
+func WriteError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+}
+
+// LimitBody считывает тело запроса размером не более limit байт и передает запрос h.
+// Тело считывается после распаковки, поэтому ограничение действует и для сжатых запросов.
+// Если тело больше limit, возвращается 413 Request Entity Too Large.
+func LimitBody(limit int64, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("размер тела запроса превышает %d байт", limit))
+				return
+			}
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("ошибка при чтении тела запроса: %s", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h(w, r)
+	}
+}
@@ -0,0 +1,76 @@
+package validation
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"metrics/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestName(t *testing.T) {
+	for _, name := range []string{"Alloc", "cpu_usage", "app.requests", "http:latency-ms", strings.Repeat("a", MaxNameLength)} {
+		assert.NoError(t, Name(name), name)
+	}
+	for _, name := range []string{"", "with space", "a/b", `a{b="c"}`, "имя", strings.Repeat("a", MaxNameLength+1)} {
+		assert.Error(t, Name(name), name)
+	}
+}
+
+func TestMetric(t *testing.T) {
+	value := 1.5
+	nan := math.NaN()
+	inf := math.Inf(1)
+	delta := int64(1)
+
+	tests := []struct {
+		name    string
+		metric  models.Metrics
+		wantErr bool
+	}{
+		{name: "gauge", metric: models.Metrics{ID: "g", MType: "gauge", Value: &value}},
+		{name: "counter", metric: models.Metrics{ID: "c", MType: "counter", Delta: &delta}},
+		{name: "gauge without value", metric: models.Metrics{ID: "g", MType: "gauge"}, wantErr: true},
+		{name: "counter without delta", metric: models.Metrics{ID: "c", MType: "counter"}, wantErr: true},
+		{name: "NaN", metric: models.Metrics{ID: "g", MType: "gauge", Value: &nan}, wantErr: true},
+		{name: "Inf", metric: models.Metrics{ID: "g", MType: "gauge", Value: &inf}, wantErr: true},
+		{name: "histogram without value", metric: models.Metrics{ID: "h", MType: "histogram"}, wantErr: true},
+		{name: "unknown type", metric: models.Metrics{ID: "g", MType: "summary", Value: &value}, wantErr: true},
+		{name: "invalid label", metric: models.Metrics{ID: "g", MType: "gauge", Value: &value, Labels: map[string]string{"1a": "b"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Metric(tt.metric)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	h := LimitBody(4, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Write(body)
+	})
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader("abcd")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "abcd", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader("abcde")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Error)
+}
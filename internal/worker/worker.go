@@ -8,6 +8,16 @@ import (
 	"time"
 )
 
+// TickGoFunc вызывает task в отдельной горутине по каждому срабатыванию ticker.
+// В отличие от TriggerGoFunc, не обрабатывает сигналы завершения работы сервиса.
+func TickGoFunc(ticker *time.Ticker, task func()) {
+	go func(ticker *time.Ticker) {
+		for range ticker.C {
+			task()
+		}
+	}(ticker)
+}
+
 func TriggerGoFunc(ticker *time.Ticker, task func()) {
 
 	signalChannel := make(chan os.Signal, 1)